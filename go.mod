@@ -4,6 +4,7 @@ go 1.12
 
 require (
 	github.com/ajg/form v1.5.1 // indirect
+	github.com/asdine/storm v2.1.2+incompatible
 	github.com/astaxie/beego v1.11.1
 	github.com/blocktree/go-owcdrivers v1.1.25 // indirect
 	github.com/blocktree/go-owcrypt v1.0.4
@@ -36,6 +37,8 @@ require (
 	github.com/yudai/gojsondiff v1.0.0 // indirect
 	github.com/yudai/golcs v0.0.0-20170316035057-ecda9a501e82 // indirect
 	github.com/yudai/pp v2.0.1+incompatible // indirect
+	go.etcd.io/bbolt v1.3.5 // indirect
+	golang.org/x/sys v0.10.0 // indirect
 	gopkg.in/gavv/httpexpect.v1 v1.1.1 // indirect
 	gopkg.in/yaml.v2 v2.2.4 // indirect
 	moul.io/http2curl v1.0.0 // indirect
@@ -4,6 +4,7 @@ import (
 	"encoding/hex"
 	"errors"
 	"github.com/blocktree/openwallet/openwallet"
+	"github.com/mr-tron/base58"
 	"regexp"
 )
 
@@ -68,3 +69,12 @@ func (dec *AddressDecoderV2) AddressVerify(address string, opts ...interface{})
 }
 
 var prefix = []byte{0x30}
+
+//implicitAccountPublicKey 隐式账户对应的公钥，格式 ed25519:<base58>
+func implicitAccountPublicKey(accountID string) (string, error) {
+	pub, err := hex.DecodeString(accountID)
+	if err != nil || len(pub) != 32 {
+		return "", ErrorInvalidAddress
+	}
+	return "ed25519:" + base58.Encode(pub), nil
+}
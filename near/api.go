@@ -1,38 +1,40 @@
 package near
 
 import (
-	"errors"
+	"context"
 	"fmt"
-	"github.com/blocktree/openwallet/log"
 	"github.com/imroc/req"
 	"github.com/tidwall/gjson"
+	"time"
 )
 
 type Client struct {
 	BaseURL string
 	Debug   bool
+	Metrics *Metrics //监控指标，为nil时不记录
+	Logger  *Logger  //结构化日志，为nil时不记录
 }
 
 func (c *Client) Get(path string, queryparams []interface{}) (*gjson.Result, error) {
+	return c.GetContext(context.Background(), path, queryparams)
+}
+
+//GetContext 上下文取消时中断请求
+func (c *Client) GetContext(ctx context.Context, path string, queryparams []interface{}) (*gjson.Result, error) {
+	start := time.Now()
+	result, err := c.getContext(ctx, path, queryparams)
+	c.observe(path, start, err)
+	return result, err
+}
+
+func (c *Client) getContext(ctx context.Context, path string, queryparams []interface{}) (*gjson.Result, error) {
 	authHeader := req.Header{
 		"Accept":       "application/json",
 		"Content-Type": "application/json",
 	}
 
-	if c.Debug {
-		log.Debug("Start Request API...")
-	}
 	requestPath := fmt.Sprintf("%s%s", c.BaseURL, path)
-	r, err := req.Get(requestPath, authHeader)
-
-	if c.Debug {
-		log.Debug("Request API Completed")
-	}
-
-	if c.Debug {
-		log.Debugf("%+v\n", r)
-	}
-
+	r, err := req.Get(requestPath, authHeader, ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -43,6 +45,18 @@ func (c *Client) Get(path string, queryparams []interface{}) (*gjson.Result, err
 }
 
 func (c *Client) Call(method string, params []interface{}) (*gjson.Result, error) {
+	return c.CallContext(context.Background(), method, params)
+}
+
+//CallContext 上下文取消时中断请求
+func (c *Client) CallContext(ctx context.Context, method string, params []interface{}) (*gjson.Result, error) {
+	start := time.Now()
+	result, err := c.callContext(ctx, method, params)
+	c.observe(method, start, err)
+	return result, err
+}
+
+func (c *Client) callContext(ctx context.Context, method string, params []interface{}) (*gjson.Result, error) {
 	authHeader := req.Header{
 		"Accept":       "application/json",
 		"Content-Type": "application/json",
@@ -53,16 +67,7 @@ func (c *Client) Call(method string, params []interface{}) (*gjson.Result, error
 	body["method"] = method
 	body["params"] = params
 
-	if c.Debug {
-		log.Debugf("url : %+v", c.BaseURL)
-	}
-
-	r, err := req.Post(c.BaseURL, req.BodyJSON(&body), authHeader)
-
-	if c.Debug {
-		log.Debugf("%+v\n", r)
-	}
-
+	r, err := req.Post(c.BaseURL, req.BodyJSON(&body), authHeader, ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -70,7 +75,6 @@ func (c *Client) Call(method string, params []interface{}) (*gjson.Result, error
 	resp := gjson.ParseBytes(r.Bytes())
 	err = isError(&resp)
 	if err != nil {
-		log.Info("scan near resp info", resp.String())
 		return nil, err
 	}
 
@@ -80,6 +84,18 @@ func (c *Client) Call(method string, params []interface{}) (*gjson.Result, error
 }
 
 func (c *Client) Call2(method string, params map[string]interface{}) (*gjson.Result, error) {
+	return c.Call2Context(context.Background(), method, params)
+}
+
+//Call2Context 上下文取消时中断请求
+func (c *Client) Call2Context(ctx context.Context, method string, params map[string]interface{}) (*gjson.Result, error) {
+	start := time.Now()
+	result, err := c.call2Context(ctx, method, params)
+	c.observe(method, start, err)
+	return result, err
+}
+
+func (c *Client) call2Context(ctx context.Context, method string, params map[string]interface{}) (*gjson.Result, error) {
 	authHeader := req.Header{
 		"Accept":       "application/json",
 		"Content-Type": "application/json",
@@ -90,16 +106,7 @@ func (c *Client) Call2(method string, params map[string]interface{}) (*gjson.Res
 	body["method"] = method
 	body["params"] = params
 
-	if c.Debug {
-		log.Debugf("url : %+v", c.BaseURL)
-	}
-
-	r, err := req.Post(c.BaseURL, req.BodyJSON(&body), authHeader)
-
-	if c.Debug {
-		log.Debugf("%+v\n", r)
-	}
-
+	r, err := req.Post(c.BaseURL, req.BodyJSON(&body), authHeader, ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -115,11 +122,39 @@ func (c *Client) Call2(method string, params map[string]interface{}) (*gjson.Res
 	return &result, nil
 }
 
+//observe 记录请求耗时和错误，按方法和节点地址区分。日志只记录请求元数据，不输出请求和响应内容
+func (c *Client) observe(method string, start time.Time, err error) {
+	if c.Metrics != nil {
+		c.Metrics.ObserveRPC(method, c.BaseURL, start, err)
+	}
+	fields := []LogField{F("method", method), F("endpoint", c.BaseURL), F("duration", time.Since(start))}
+	if err != nil {
+		c.Logger.Warn("rpc request failed", append(fields, F("error", err))...)
+		return
+	}
+	if c.Debug {
+		c.Logger.Debug("rpc request", fields...)
+	}
+}
+
+//RPCError 节点返回的错误
+type RPCError struct {
+	Code    int64
+	Message string
+	Data    gjson.Result //节点的详细错误信息，例如超时、交易无效原因
+}
+
+//Error 实现error接口
+func (e *RPCError) Error() string {
+	errInfo := fmt.Sprintf("[%d]%s", e.Code, e.Message)
+	if e.Data.Exists() {
+		errInfo = fmt.Sprintf("%s: %s", errInfo, e.Data.String())
+	}
+	return errInfo
+}
+
 //isError 是否报错
 func isError(result *gjson.Result) error {
-	var (
-		err error
-	)
 
 	if !result.Get("error").IsObject() {
 
@@ -130,10 +165,9 @@ func isError(result *gjson.Result) error {
 		return nil
 	}
 
-	errInfo := fmt.Sprintf("[%d]%s",
-		result.Get("error.code").Int(),
-		result.Get("error.message").String())
-	err = errors.New(errInfo)
-
-	return err
+	return &RPCError{
+		Code:    result.Get("error.code").Int(),
+		Message: result.Get("error.message").String(),
+		Data:    result.Get("error.data"),
+	}
 }
@@ -0,0 +1,188 @@
+package near
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/asdine/storm"
+	"github.com/asdine/storm/q"
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+const (
+	blockHeaderBucket     = "block_header"  //已扫区块头
+	scanCursorBucket      = "scan_cursor"   //扫描进度
+	currentBlockHeaderKey = "current_block" //当前已扫区块
+	defaultBlockCacheSize = uint64(1000)    //默认缓存区块数量
+)
+
+//BlockchainStore 内置的区块链数据存储，未设置外部BlockchainDAI时默认使用。
+//每次写入在一个数据库事务中完成，进程崩溃不会留下写了一半的数据。
+type BlockchainStore struct {
+	dbFile         string
+	mu             sync.Mutex
+	blockCacheSize uint64
+}
+
+//NewBlockchainStore 区块链数据存储
+func NewBlockchainStore(dbFile string) *BlockchainStore {
+	store := BlockchainStore{}
+	store.dbFile = dbFile
+	store.blockCacheSize = defaultBlockCacheSize
+	return &store
+}
+
+//update 在写事务中操作币种的数据
+func (store *BlockchainStore) update(symbol string, fn func(node storm.Node) error) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	db, err := storm.Open(store.dbFile)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.From(symbol).Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+//view 读取币种的数据
+func (store *BlockchainStore) view(symbol string, fn func(node storm.Node) error) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	db, err := storm.Open(store.dbFile)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return fn(db.From(symbol))
+}
+
+//SaveCurrentBlockHead 记录扫描进度
+func (store *BlockchainStore) SaveCurrentBlockHead(header *openwallet.BlockHeader) error {
+	return store.update(header.Symbol, func(node storm.Node) error {
+		return node.Set(scanCursorBucket, currentBlockHeaderKey, header)
+	})
+}
+
+//GetCurrentBlockHead 获取扫描进度，未记录时返回高度为0的区块头
+func (store *BlockchainStore) GetCurrentBlockHead(symbol string) (*openwallet.BlockHeader, error) {
+	header := &openwallet.BlockHeader{}
+	err := store.view(symbol, func(node storm.Node) error {
+		err := node.Get(scanCursorBucket, currentBlockHeaderKey, header)
+		if err == storm.ErrNotFound {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
+//SaveLocalBlockHead 保存区块头，只保留最近blockCacheSize个高度
+func (store *BlockchainStore) SaveLocalBlockHead(header *openwallet.BlockHeader) error {
+	return store.update(header.Symbol, func(node storm.Node) error {
+		if err := node.Set(blockHeaderBucket, header.Height, header); err != nil {
+			return err
+		}
+		if header.Height <= store.blockCacheSize {
+			return nil
+		}
+		err := node.Delete(blockHeaderBucket, header.Height-store.blockCacheSize)
+		if err != nil && err != storm.ErrNotFound {
+			return err
+		}
+		return nil
+	})
+}
+
+//GetLocalBlockHeadByHeight 获取本地区块头
+func (store *BlockchainStore) GetLocalBlockHeadByHeight(height uint64, symbol string) (*openwallet.BlockHeader, error) {
+	header := &openwallet.BlockHeader{}
+	err := store.view(symbol, func(node storm.Node) error {
+		return node.Get(blockHeaderBucket, height, header)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
+//SaveUnscanRecord 保存未扫记录
+func (store *BlockchainStore) SaveUnscanRecord(record *openwallet.UnscanRecord) error {
+	if record == nil {
+		return fmt.Errorf("the unscan record to save is nil")
+	}
+	return store.update(record.Symbol, func(node storm.Node) error {
+		return node.Save(record)
+	})
+}
+
+//DeleteUnscanRecordByHeight 删除区块的全部未扫记录
+func (store *BlockchainStore) DeleteUnscanRecordByHeight(height uint64, symbol string) error {
+	return store.update(symbol, func(node storm.Node) error {
+		var list []*openwallet.UnscanRecord
+		err := node.Select(q.Eq("BlockHeight", height)).Find(&list)
+		if err != nil && err != storm.ErrNotFound {
+			return err
+		}
+		for _, r := range list {
+			if err := node.DeleteStruct(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+//DeleteUnscanRecordByID 删除未扫记录
+func (store *BlockchainStore) DeleteUnscanRecordByID(id string, symbol string) error {
+	return store.update(symbol, func(node storm.Node) error {
+		return node.DeleteStruct(&openwallet.UnscanRecord{ID: id})
+	})
+}
+
+//GetTransactionsByTxID 内置存储不保存交易记录
+func (store *BlockchainStore) GetTransactionsByTxID(txid, symbol string) ([]*openwallet.Transaction, error) {
+	return nil, fmt.Errorf("GetTransactionsByTxID is not implemented")
+}
+
+//GetUnscanRecords 获取全部未扫记录
+func (store *BlockchainStore) GetUnscanRecords(symbol string) ([]*openwallet.UnscanRecord, error) {
+	var list []*openwallet.UnscanRecord
+	err := store.view(symbol, func(node storm.Node) error {
+		err := node.All(&list)
+		if err == storm.ErrNotFound {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+//SetMaxBlockCache 设置区块头缓存数量
+func (store *BlockchainStore) SetMaxBlockCache(max uint64, symbol string) error {
+	if max == 0 {
+		return fmt.Errorf("block cache size must be greater than 0")
+	}
+	store.mu.Lock()
+	store.blockCacheSize = max
+	store.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,79 @@
+package near
+
+import (
+	"testing"
+
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+func TestBlockchainStore_ScanCursor(t *testing.T) {
+	wm, clean := testWalletManager(t, nil)
+	defer clean()
+	store := wm.Blockscanner.BlockchainDAI.(*BlockchainStore)
+
+	//未记录时从链上最新高度开始
+	header, err := store.GetCurrentBlockHead(Symbol)
+	if err != nil || header.Height != 0 {
+		t.Errorf("unexpected cursor: %+v, err: %v", header, err)
+	}
+
+	store.SaveCurrentBlockHead(&openwallet.BlockHeader{Height: 100, Hash: "hash100", Symbol: Symbol})
+	header, err = store.GetCurrentBlockHead(Symbol)
+	if err != nil || header.Height != 100 || header.Hash != "hash100" {
+		t.Errorf("unexpected cursor: %+v, err: %v", header, err)
+	}
+
+	//不同币种的数据相互隔离
+	header, _ = store.GetCurrentBlockHead("OTHER")
+	if header.Height != 0 {
+		t.Errorf("unexpected cursor of other symbol: %+v", header)
+	}
+}
+
+func TestBlockchainStore_LocalBlockHead(t *testing.T) {
+	wm, clean := testWalletManager(t, nil)
+	defer clean()
+	store := wm.Blockscanner.BlockchainDAI.(*BlockchainStore)
+
+	store.SetMaxBlockCache(2, Symbol)
+	for height := uint64(1); height <= 3; height++ {
+		err := store.SaveLocalBlockHead(&openwallet.BlockHeader{Height: height, Hash: "hash", Symbol: Symbol})
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if _, err := store.GetLocalBlockHeadByHeight(1, Symbol); err == nil {
+		t.Errorf("block header beyond cache size should be removed")
+	}
+	header, err := store.GetLocalBlockHeadByHeight(3, Symbol)
+	if err != nil || header.Height != 3 {
+		t.Errorf("unexpected block header: %+v, err: %v", header, err)
+	}
+}
+
+func TestBlockchainStore_UnscanRecords(t *testing.T) {
+	wm, clean := testWalletManager(t, nil)
+	defer clean()
+	store := wm.Blockscanner.BlockchainDAI.(*BlockchainStore)
+
+	store.SaveUnscanRecord(openwallet.NewUnscanRecord(100, "tx1", "failed", Symbol))
+	store.SaveUnscanRecord(openwallet.NewUnscanRecord(100, "tx2", "failed", Symbol))
+	record := openwallet.NewUnscanRecord(101, "", "failed", Symbol)
+	store.SaveUnscanRecord(record)
+
+	list, err := store.GetUnscanRecords(Symbol)
+	if err != nil || len(list) != 3 {
+		t.Errorf("unexpected unscan records: %d, err: %v", len(list), err)
+	}
+
+	if err := store.DeleteUnscanRecordByHeight(100, Symbol); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := store.DeleteUnscanRecordByID(record.ID, Symbol); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	list, _ = store.GetUnscanRecords(Symbol)
+	if len(list) != 0 {
+		t.Errorf("unexpected unscan records after delete: %+v", list)
+	}
+}
@@ -18,6 +18,7 @@ package near
 import (
 	"fmt"
 	"github.com/blocktree/openwallet/openwallet"
+	"time"
 )
 
 //SaveLocalBlockHead 记录区块高度和hash到本地
@@ -34,7 +35,7 @@ func (bs *NearBlockScanner) SaveLocalBlockHead(blockHeight uint64, blockHash str
 		Symbol: bs.wm.Symbol(),
 	}
 
-	bs.wm.Log.Std.Info("block scanner SaveLocalBlockHead: %v", header)
+	bs.wm.Logger.Info("block scanner SaveLocalBlockHead", F("height", header.Height), F("hash", header.Hash))
 
 	return bs.BlockchainDAI.SaveCurrentBlockHead(header)
 }
@@ -65,7 +66,7 @@ func (bs *NearBlockScanner) SaveLocalBlock(blockHeader *BlockHeader) error {
 		Hash:              blockHeader.Hash,
 		Previousblockhash: blockHeader.PrevHash,
 		Height:            blockHeader.Height,
-		Time:              0,
+		Time:              uint64(blockHeader.Time()),
 		Symbol:            bs.wm.Symbol(),
 	}
 
@@ -87,12 +88,13 @@ func (bs *NearBlockScanner) GetLocalBlock(height uint64) (*BlockHeader, error) {
 	}
 
 	block := &BlockHeader{
-		Hash:     header.Hash,
-		Height:   header.Height,
-		PrevHash: header.Previousblockhash,
+		Hash:      header.Hash,
+		Height:    header.Height,
+		PrevHash:  header.Previousblockhash,
+		Timestamp: header.Time * uint64(time.Second),
 	}
 
-	bs.wm.Log.Std.Info("block scanner GetLocalBlock: %v", block)
+	bs.wm.Logger.Info("block scanner GetLocalBlock", F("height", block.Height), F("hash", block.Hash))
 
 	return block, nil
 }
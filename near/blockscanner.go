@@ -1,6 +1,8 @@
 package near
 
 import (
+	"context"
+	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -8,27 +10,52 @@ import (
 	"github.com/blocktree/openwallet/openwallet"
 	"github.com/btcsuite/btcutil/base58"
 	"github.com/shopspring/decimal"
+	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 )
 
 const (
 	blockchainBucket = "blockchain" // blockchain dataset
 	//periodOfTask      = 5 * time.Second // task interval
-	maxExtractingSize = 10 // thread count
 
 	fixFeePerOperation = "0.001" //RIA one operation min consume 0.001 RIA
 )
 
+//交易链上状态
+const (
+	TxStatusSuccess = openwallet.TxStatusSuccess //执行成功
+	TxStatusFail    = openwallet.TxStatusFail    //执行失败，手续费已燃烧
+	TxStatusPending = "pending"                  //已上链，回执未执行完成
+)
+
+const (
+	//执行未完成的交易记录为未扫记录，稍后重扫
+	unscanReasonTxPending = "transaction pending"
+	//未final的到账记录为未扫记录，final后重新通知
+	unscanReasonAwaitFinality = "awaiting finality"
+)
+
 type NearBlockScanner struct {
 	*openwallet.BlockScannerBase
 
-	CurrentBlockHeight   uint64         //当前区块高度
-	extractingCH         chan struct{}  //扫描工作令牌
-	wm                   *WalletManager //钱包管理者
-	RescanLastBlockCount uint64         //重扫上N个区块数量
+	CurrentBlockHeight   uint64              //当前区块高度
+	wm                   *WalletManager      //钱包管理者
+	RescanLastBlockCount uint64              //重扫上N个区块数量
+	finalBlockHeight     uint64              //最新final区块高度
+	heightMu             sync.RWMutex        //最新高度锁，扫描任务写入，提取和接口读取
+	UnscanRetry          *UnscanRetryManager //未扫记录重试策略
+	Outbox               *NotifyOutbox       //通知发件箱
+	validityMu           sync.Mutex          //交易有效期锁
+	validityLoaded       bool                //交易有效期已从创世配置或外部配置加载，查询失败时下次重试
+	ctx                  context.Context     //扫描上下文，停止或暂停时取消
+	cancel               context.CancelFunc  //取消扫描上下文
+	ctxMu                sync.Mutex          //扫描上下文锁
+	stateMu              sync.RWMutex        //扫描状态锁，BlockScannerBase修改Scanning时不加锁
+	inflight             inflightWork        //进行中的扫描工作
 }
 
-//
 ////ExtractResult 扫描完成的提取结果
 type ExtractResult struct {
 	extractData map[string][]*openwallet.TxExtractData
@@ -37,7 +64,6 @@ type ExtractResult struct {
 	Success     bool
 }
 
-//
 ////SaveResult result
 type SaveResult struct {
 	TxID        string
@@ -45,18 +71,23 @@ type SaveResult struct {
 	Success     bool
 }
 
-//
 //// NewEOSBlockScanner create a block scanner
 func NewNearBlockScanner(wm *WalletManager) *NearBlockScanner {
 	bs := NearBlockScanner{
 		BlockScannerBase: openwallet.NewBlockScannerBase(),
 	}
 
-	bs.extractingCH = make(chan struct{}, maxExtractingSize)
 	bs.wm = wm
+	bs.ctx, bs.cancel = context.WithCancel(context.Background())
 
 	bs.RescanLastBlockCount = 0
 
+	bs.UnscanRetry = NewUnscanRetryManager(wm)
+	bs.Outbox = NewNotifyOutbox(wm)
+
+	//默认使用内置存储，可通过SetBlockchainDAI替换
+	bs.BlockchainDAI = NewBlockchainStore(filepath.Join(wm.Config.dbPath, wm.Config.BlockchainFile))
+
 	// set task
 	bs.SetTask(bs.ScanBlockTask)
 
@@ -65,10 +96,18 @@ func NewNearBlockScanner(wm *WalletManager) *NearBlockScanner {
 
 //GetBalanceByAddress 查询地址余额
 func (bs *NearBlockScanner) GetBalanceByAddress(address ...string) ([]*openwallet.Balance, error) {
+	return bs.GetBalanceByAddressContext(context.Background(), address...)
+}
+
+//GetBalanceByAddressContext 查询地址余额，上下文取消时返回错误
+func (bs *NearBlockScanner) GetBalanceByAddressContext(ctx context.Context, address ...string) ([]*openwallet.Balance, error) {
 
 	addrBalanceArr := make([]*openwallet.Balance, 0)
 	for _, a := range address {
-		balance, err := bs.GetAccountBalance(a)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		balance, err := bs.GetAccountBalanceContext(ctx, a)
 		if err == nil {
 
 			obj := &openwallet.Balance{
@@ -89,10 +128,16 @@ func (bs *NearBlockScanner) GetBalanceByAddress(address ...string) ([]*openwalle
 
 //GetCurrentBlockHeader 获取当前区块高度
 func (bs *NearBlockScanner) GetCurrentBlockHeader() (*openwallet.BlockHeader, error) {
+	return bs.GetCurrentBlockHeaderContext(context.Background())
+}
 
-	result, err := bs.wm.client.Get("/status", nil)
+//GetCurrentBlockHeaderContext 获取当前区块高度
+func (bs *NearBlockScanner) GetCurrentBlockHeaderContext(ctx context.Context) (*openwallet.BlockHeader, error) {
+
+	result, err := bs.wm.client.GetContext(ctx, "/status", nil)
 	if err != nil {
 		log.Error(err)
+		return nil, err
 	}
 	status := Status{}
 	if err := json.Unmarshal([]byte(result.Raw), &status); err != nil {
@@ -135,6 +180,10 @@ func (bs *NearBlockScanner) GetLocalNewBlock() (uint64, string, error) {
 
 //GetScannedBlockHeader 获取已扫高度区块头
 func (bs *NearBlockScanner) GetScannedBlockHeader() (*openwallet.BlockHeader, error) {
+	return bs.getScannedBlockHeader(context.Background())
+}
+
+func (bs *NearBlockScanner) getScannedBlockHeader(ctx context.Context) (*openwallet.BlockHeader, error) {
 
 	var (
 		blockHeight uint64 = 0
@@ -144,23 +193,23 @@ func (bs *NearBlockScanner) GetScannedBlockHeader() (*openwallet.BlockHeader, er
 
 	blockHeight, hash, err = bs.GetLocalNewBlock()
 	if err != nil {
-		bs.wm.Log.Errorf("get local new block failed, err=%v", err)
+		bs.wm.Logger.Error("get local new block failed", F("error", err))
 		return nil, err
 	}
 
 	//如果本地没有记录，查询接口的高度
 	if blockHeight == 0 {
-		blockHeight, err = bs.GetCurrentBlock()
+		blockHeight, err = bs.GetCurrentBlockContext(ctx)
 		if err != nil {
-			bs.wm.Log.Errorf("NEAR GetBlockHeight failed,err = %v", err)
+			bs.wm.Logger.Error("NEAR GetBlockHeight failed", F("error", err))
 			return nil, err
 		}
 
 		//就上一个区块链为当前区块
 		blockHeight = blockHeight - 1
-		block, err := bs.GetBlockByHeight(blockHeight, false)
+		block, err := bs.GetBlockByHeightContext(ctx, blockHeight, false)
 		if err != nil {
-			bs.wm.Log.Errorf("get block spec by block number failed, err=%v", err)
+			bs.wm.Logger.Error("get block spec by block number failed", F("height", blockHeight), F("error", err))
 			return nil, err
 		}
 
@@ -188,13 +237,15 @@ func (bs *NearBlockScanner) GetGlobalMaxBlockHeight() uint64 {
 }
 
 //GetTransaction
-//func (bs *NearBlockScanner) GetTransaction(hash string) (*Transaction, error) {
-//	r, err := bs.wm.client.TransactionByID(hash)
-//	if err != nil {
-//		return nil, err
+//
+//	func (bs *NearBlockScanner) GetTransaction(hash string) (*Transaction, error) {
+//		r, err := bs.wm.client.TransactionByID(hash)
+//		if err != nil {
+//			return nil, err
+//		}
+//		return NewTransaction(r), nil
 //	}
-//	return NewTransaction(r), nil
-//}
+//
 //SaveLocalNewBlock 记录区块高度和hash到本地
 func (bs *NearBlockScanner) SaveLocalNewBlock(blockHeight uint64, blockHash string) error {
 
@@ -217,50 +268,63 @@ func (bs *NearBlockScanner) SaveLocalNewBlock(blockHeight uint64, blockHash stri
 //ScanBlockTask 扫描任务
 func (bs *NearBlockScanner) ScanBlockTask() {
 
+	//本次任务的上下文，停止或暂停时取消
+	ctx, done := bs.beginWork()
+	defer done()
+
 	//获取本地区块高度
-	blockHeader, err := bs.GetScannedBlockHeader()
+	blockHeader, err := bs.getScannedBlockHeader(ctx)
 	if err != nil {
-		bs.wm.Log.Std.Info("block scanner can not get new block height; unexpected error: %v", err)
+		bs.wm.Logger.Warn("block scanner can not get new block height", F("error", err))
 		return
 	}
 
 	currentHeight := blockHeader.Height
 	currentHash := blockHeader.Hash
+	lagAlerted := false
 
 	for {
 
-		if !bs.Scanning {
+		if !bs.isScanning() || ctx.Err() != nil {
 			//区块扫描器已暂停，马上结束本次任务
 			return
 		}
 
 		//获取最大高度
-		maxHeight, err := bs.GetCurrentBlock()
+		maxHeight, err := bs.GetCurrentBlockContext(ctx)
 		if err != nil {
 			//下一个高度找不到会报异常
-			bs.wm.Log.Std.Info("block scanner can not get rpc-server block height; unexpected error: %v", err)
+			bs.wm.Logger.Warn("block scanner can not get rpc-server block height", F("error", err))
 			break
 		}
 
+		//记录最新高度用于计算确认数
+		bs.setCurrentBlockHeight(maxHeight)
+		bs.refreshFinalBlockHeight(ctx)
+		bs.reportScanProgress(currentHeight, maxHeight, &lagAlerted)
+
 		//是否已到最新高度
 		if currentHeight >= maxHeight {
-			bs.wm.Log.Std.Info("block scanner has scanned full chain data. Current height: %d", maxHeight)
+			bs.wm.Logger.Info("block scanner has scanned full chain data", F("height", maxHeight))
 			break
 		}
 
 		//继续扫描下一个区块
 		currentHeight = currentHeight + 1
 
-		bs.wm.Log.Std.Info("block scanner scanning height: %d ...", currentHeight)
+		bs.wm.Logger.Info("block scanner scanning", F("height", currentHeight))
 
-		block, err := bs.GetBlockByHeight(currentHeight, true)
+		block, err := bs.GetBlockByHeightContext(ctx, currentHeight, true)
+		if isExtractCanceled(ctx, err) {
+			//扫描器已停止，下次从该区块重新扫描
+			return
+		}
 		if err != nil {
-			bs.wm.Log.Std.Info("block scanner can not get new block data; unexpected error: %v", err)
+			bs.wm.Logger.Warn("block scanner can not get new block data", F("height", currentHeight), F("error", err))
 
 			//记录未扫区块
-			unscanRecord := openwallet.NewUnscanRecord(currentHeight, "", "ExtractData Notify failed.", bs.wm.Symbol())
+			unscanRecord := openwallet.NewUnscanRecord(currentHeight, "", err.Error(), bs.wm.Symbol())
 			bs.SaveUnscanRecord(unscanRecord)
-			bs.wm.Log.Std.Info("block height: %d extract failed.", currentHeight)
 			continue
 		}
 
@@ -269,11 +333,11 @@ func (bs *NearBlockScanner) ScanBlockTask() {
 		//判断hash是否上一区块的hash
 		if currentHash != block.Header.PrevHash {
 
-			bs.wm.Log.Std.Info("block has been fork on height: %d.", currentHeight)
-			bs.wm.Log.Std.Info("block height: %d local hash = %s ", currentHeight-1, currentHash)
-			bs.wm.Log.Std.Info("block height: %d mainnet hash = %s ", currentHeight-1, block.Header.PrevHash)
-
-			bs.wm.Log.Std.Info("delete recharge records on block height: %d.", currentHeight-1)
+			bs.wm.Metrics.Reorgs.Add(1)
+			bs.wm.Logger.Warn("block has been fork",
+				F("height", currentHeight),
+				F("localHash", currentHash),
+				F("mainnetHash", block.Header.PrevHash))
 
 			//查询本地分叉的区块
 			forkBlock, _ := bs.GetLocalBlock(currentHeight - 1)
@@ -289,14 +353,14 @@ func (bs *NearBlockScanner) ScanBlockTask() {
 
 			localBlockHeader, err := bs.GetLocalBlock(currentHeight)
 			if err != nil {
-				bs.wm.Log.Std.Error("block scanner can not get local block; unexpected error: %v", err)
+				bs.wm.Logger.Error("block scanner can not get local block", F("height", currentHeight), F("error", err))
 
 				//查找core钱包的RPC
-				bs.wm.Log.Info("block scanner prev block height:", currentHeight)
+				bs.wm.Logger.Info("block scanner prev block height", F("height", currentHeight))
 
-				block, err = bs.GetBlockByHeight(currentHeight, false)
+				block, err = bs.GetBlockByHeightContext(ctx, currentHeight, false)
 				if err != nil {
-					bs.wm.Log.Std.Error("block scanner can not get prev block; unexpected error: %v", err)
+					bs.wm.Logger.Error("block scanner can not get prev block", F("height", currentHeight), F("error", err))
 					break
 				}
 				localBlockHeader = &block.Header
@@ -306,7 +370,7 @@ func (bs *NearBlockScanner) ScanBlockTask() {
 			//重置当前区块的hash
 			currentHash = localBlockHeader.Hash
 
-			bs.wm.Log.Std.Info("rescan block on height: %d, hash: %s .", currentHeight, currentHash)
+			bs.wm.Logger.Info("rescan block", F("height", currentHeight), F("hash", currentHash))
 
 			//重新记录一个新扫描起点
 			bs.SaveLocalNewBlock(uint64(localBlockHeader.Height), localBlockHeader.Hash)
@@ -321,10 +385,16 @@ func (bs *NearBlockScanner) ScanBlockTask() {
 			}
 
 		} else {
-			err = bs.BatchExtractTransaction(block.Header.Height, block.Header.Hash, block.TxTransfer, 0)
+			err = bs.batchExtractTransaction(ctx, block.Header.Height, block.Header.Hash, block.TxTransfer, block.Header.Time())
+			if isExtractCanceled(ctx, err) {
+				//扫描器已停止，不保存当前高度，下次从该区块重新扫描
+				bs.wm.Logger.Info("block scanner canceled", F("height", currentHeight))
+				return
+			}
 			if err != nil {
-				bs.wm.Log.Std.Info("block scanner can not extractRechargeRecords; unexpected error: %v", err)
+				bs.wm.Logger.Warn("block scanner can not extractRechargeRecords", F("height", currentHeight), F("error", err))
 			}
+			bs.savePendingRecords(block)
 
 			//重置当前区块的hash
 			currentHash = block.Header.Hash
@@ -332,6 +402,8 @@ func (bs *NearBlockScanner) ScanBlockTask() {
 			//保存本地新高度
 			bs.SaveLocalNewBlock(currentHeight, currentHash)
 			bs.SaveLocalBlock(&block.Header)
+			bs.wm.Metrics.BlocksScanned.Add(1)
+			bs.wm.Metrics.SetScanProgress(currentHeight, maxHeight)
 
 			isFork = false
 
@@ -343,18 +415,29 @@ func (bs *NearBlockScanner) ScanBlockTask() {
 
 	//重扫前N个块，为保证记录找到
 	for i := currentHeight - bs.RescanLastBlockCount; i < currentHeight; i++ {
-		bs.scanBlock(i)
+		if _, err := bs.scanBlock(ctx, i); isExtractCanceled(ctx, err) {
+			return
+		}
 	}
 
 	//重扫失败区块
-	bs.RescanFailedRecord()
+	bs.rescanFailedRecord(ctx)
+	if ctx.Err() != nil {
+		return
+	}
+
+	//重投失败的通知
+	bs.RedeliverOutbox()
 
 }
 
 //ScanBlock 扫描指定高度区块
 func (bs *NearBlockScanner) ScanBlock(height uint64) error {
 
-	block, err := bs.scanBlock(height)
+	ctx, done := bs.beginWork()
+	defer done()
+
+	block, err := bs.scanBlock(ctx, height)
 	if err != nil {
 		return err
 	}
@@ -365,44 +448,79 @@ func (bs *NearBlockScanner) ScanBlock(height uint64) error {
 	return nil
 }
 
-func (bs *NearBlockScanner) scanBlock(height uint64) (*Block, error) {
+func (bs *NearBlockScanner) scanBlock(ctx context.Context, height uint64) (*Block, error) {
 
-	block, err := bs.GetBlockByHeight(height, true)
+	block, err := bs.GetBlockByHeightContext(ctx, height, true)
 	if err != nil {
-		bs.wm.Log.Std.Info("block scanner can not get new block data; unexpected error: %v", err)
+		bs.wm.Logger.Warn("block scanner can not get new block data", F("height", height), F("error", err))
 
 		//记录未扫区块
 		unscanRecord := openwallet.NewUnscanRecord(height, "", err.Error(), bs.wm.Symbol())
 		bs.SaveUnscanRecord(unscanRecord)
-		bs.wm.Log.Std.Info("block height: %d extract failed.", height)
+		bs.wm.Logger.Warn("block extract failed", F("height", height))
 		return nil, err
 	}
 
-	bs.wm.Log.Std.Info("block scanner scanning height: %d ...", block.Header.Height)
+	bs.wm.Logger.Info("block scanner scanning", F("height", block.Header.Height))
 
-	err = bs.BatchExtractTransaction(block.Header.Height, block.Header.Hash, block.TxTransfer, 0)
+	err = bs.batchExtractTransaction(ctx, block.Header.Height, block.Header.Hash, block.TxTransfer, block.Header.Time())
+	if isExtractCanceled(ctx, err) {
+		//提取被取消，记录未扫区块
+		unscanRecord := openwallet.NewUnscanRecord(height, "", err.Error(), bs.wm.Symbol())
+		bs.SaveUnscanRecord(unscanRecord)
+		return nil, err
+	}
 	if err != nil {
-		bs.wm.Log.Std.Info("block scanner can not extractRechargeRecords; unexpected error: %v", err)
+		bs.wm.Logger.Warn("block scanner can not extractRechargeRecords", F("height", height), F("error", err))
 	}
+	bs.savePendingRecords(block)
 
 	return block, nil
 }
 
+//savePendingRecords 执行未完成的交易不提取，记录未扫记录等待重扫
+func (bs *NearBlockScanner) savePendingRecords(block *Block) {
+	for _, tx := range block.TxTransfer {
+		if tx.Status != TxStatusPending {
+			continue
+		}
+		unscanRecord := openwallet.NewUnscanRecord(block.Header.Height, tx.TxId, unscanReasonTxPending, bs.wm.Symbol())
+		if err := bs.SaveUnscanRecord(unscanRecord); err != nil {
+			bs.wm.Logger.Error("save pending record failed", F("height", block.Header.Height), F("txid", tx.TxId), F("error", err))
+		}
+	}
+}
+
 //rescanFailedRecord 重扫失败记录
 func (bs *NearBlockScanner) RescanFailedRecord() {
+	ctx, done := bs.beginWork()
+	defer done()
+
+	bs.rescanFailedRecord(ctx)
+}
+
+func (bs *NearBlockScanner) rescanFailedRecord(ctx context.Context) {
 
 	var (
 		blockMap = make(map[uint64][]string)
+		//只有等待final记录的区块
+		awaitFinality = make(map[uint64]bool)
 	)
 
 	list, err := bs.GetUnscanRecords()
 	if err != nil {
-		bs.wm.Log.Std.Info("block scanner can not get rescan data; unexpected error: %v", err)
+		bs.wm.Logger.Warn("block scanner can not get rescan data", F("error", err))
 	}
 
+	bs.refreshFinalBlockHeight(ctx)
+
 	//组合成批处理
 	for _, r := range list {
 
+		if await, exist := awaitFinality[r.BlockHeight]; !exist || await {
+			awaitFinality[r.BlockHeight] = r.Reason == unscanReasonAwaitFinality
+		}
+
 		if _, exist := blockMap[r.BlockHeight]; !exist {
 			blockMap[r.BlockHeight] = make([]string, 0)
 		}
@@ -421,25 +539,83 @@ func (bs *NearBlockScanner) RescanFailedRecord() {
 			continue
 		}
 
-		bs.wm.Log.Std.Info("block scanner rescanning height: %d ...", height)
-
-		block, err := bs.GetBlockByHeight(height, true)
-		if err != nil {
-			bs.wm.Log.Std.Info("block scanner can not get new block data; unexpected error: %v", err)
+		//到账未final，暂不重新通知
+		if awaitFinality[height] {
+			if !bs.IsFinalized(height) {
+				continue
+			}
+		} else if !bs.UnscanRetry.Due(height) {
+			//未到重试时间或已进入死信列表
 			continue
 		}
 
-		err = bs.BatchExtractTransaction(block.Header.Height, block.Header.Hash, block.TxTransfer, 0)
+		bs.wm.Logger.Info("block scanner rescanning", F("height", height))
+
+		block, err := bs.GetBlockByHeightContext(ctx, height, true)
+		if isExtractCanceled(ctx, err) {
+			return
+		}
 		if err != nil {
-			bs.wm.Log.Std.Info("block scanner can not extractRechargeRecords; unexpected error: %v", err)
+			bs.wm.Logger.Warn("block scanner can not get new block data", F("height", height), F("error", err))
+			bs.failUnscanRetry(height, err)
 			continue
 		}
-		//删除未扫记录
+
+		//删除未扫记录，提取失败或仍未完成的交易会重新记录
 		bs.wm.Blockscanner.DeleteUnscanRecord(height)
+
+		err = bs.batchExtractTransaction(ctx, block.Header.Height, block.Header.Hash, block.TxTransfer, block.Header.Time())
+		if isExtractCanceled(ctx, err) {
+			//扫描器已停止，恢复未扫记录，不计入重试次数
+			unscanRecord := openwallet.NewUnscanRecord(height, "", err.Error(), bs.wm.Symbol())
+			bs.SaveUnscanRecord(unscanRecord)
+			return
+		}
+		if err != nil {
+			bs.wm.Logger.Warn("block scanner can not extractRechargeRecords", F("height", height), F("error", err))
+			bs.failUnscanRetry(height, err)
+		} else {
+			bs.UnscanRetry.Succeed(height)
+		}
+		bs.savePendingRecords(block)
 	}
 
 	//删除未没有找到交易记录的重扫记录
 	bs.wm.Blockscanner.DeleteUnscanRecordNotFindTX()
+
+	if list, err := bs.GetUnscanRecords(); err == nil {
+		bs.wm.Metrics.UnscanRecords.Set(float64(len(list)))
+	}
+}
+
+//failUnscanRetry 记录重扫失败，超过最大重试次数进入死信列表
+func (bs *NearBlockScanner) failUnscanRetry(height uint64, reason error) {
+	retry, err := bs.UnscanRetry.Fail(height, reason)
+	if err != nil {
+		bs.wm.Logger.Error("save unscan retry failed", F("height", height), F("error", err))
+		return
+	}
+	if retry.Dead {
+		bs.wm.Logger.Warn("block moved to dead letters", F("height", height), F("attempts", retry.Attempts), F("error", retry.LastError))
+	}
+}
+
+//ListDeadLetters 超过最大重试次数的未扫区块
+func (bs *NearBlockScanner) ListDeadLetters() ([]*UnscanRetry, error) {
+	return bs.UnscanRetry.ListDeadLetters()
+}
+
+//RetryDeadLetter 死信区块重新加入重试，下次扫描任务重扫
+func (bs *NearBlockScanner) RetryDeadLetter(height uint64) error {
+	return bs.UnscanRetry.Retry(height)
+}
+
+//PurgeDeadLetter 放弃死信区块，删除重试记录和未扫记录
+func (bs *NearBlockScanner) PurgeDeadLetter(height uint64) error {
+	if err := bs.DeleteUnscanRecord(height); err != nil {
+		return err
+	}
+	return bs.UnscanRetry.Succeed(height)
 }
 
 //DeleteUnscanRecordNotFindTX 删除未没有找到交易记录的重扫记录
@@ -470,9 +646,10 @@ func (bs *NearBlockScanner) newBlockNotify(blockHeader *BlockHeader, isFork bool
 	obj := openwallet.BlockHeader{}
 	//解析json
 	obj.Hash = blockHeader.Hash
-	//obj.Confirmations = b.Confirmations
+	obj.Confirmations = bs.Confirmations(blockHeader.Height)
 	obj.Previousblockhash = blockHeader.PrevHash
 	obj.Height = blockHeader.Height
+	obj.Time = uint64(blockHeader.Time())
 	obj.Fork = isFork
 	obj.Symbol = bs.wm.Symbol()
 	bs.NewBlockNotify(&obj)
@@ -481,129 +658,132 @@ func (bs *NearBlockScanner) newBlockNotify(blockHeader *BlockHeader, isFork bool
 //BatchExtractTransaction 批量提取交易单
 //直接获取区块 Payment 操作
 func (bs *NearBlockScanner) BatchExtractTransaction(blockHeight uint64, blockHash string, txs []TxTransfer, blockTime int64) error {
+	return bs.batchExtractTransaction(bs.scanContext(), blockHeight, blockHash, txs, blockTime)
+}
 
-	var (
-		quit   = make(chan struct{})
-		done   = 0 //完成标记
-		failed = 0
-	)
+//batchExtractTransaction 每次调用使用独立的工作池并发提取，按完成顺序逐个保存结果。
+//上下文取消时停止派发和提取，返回取消错误，调用方需要重扫该区块
+func (bs *NearBlockScanner) batchExtractTransaction(ctx context.Context, blockHeight uint64, blockHash string, txs []TxTransfer, blockTime int64) error {
 
-	shouldDone := len(txs) //需要完成的总数
-	if len(txs) == 0 {     //没交易直接退出
+	if len(txs) == 0 { //没交易直接退出
 		return nil
 	}
 
-	//生产通道
-	producer := make(chan ExtractResult)
-	defer close(producer)
-
-	//消费通道
-	worker := make(chan ExtractResult)
-	defer close(worker)
-
-	//保存工作
-	saveWork := func(height uint64, result chan ExtractResult) {
-		//回收创建的地址
-		for gets := range result {
-
-			if gets.Success {
-
-				notifyErr := bs.newExtractDataNotify(height, gets.extractData)
-				//saveErr := bs.SaveRechargeToWalletDB(height, gets.Recharges)
-				if notifyErr != nil {
-					failed++ //标记保存失败数
-					bs.wm.Log.Std.Info("newExtractDataNotify unexpected error: %v", notifyErr)
-				}
+	var (
+		group, gctx = newExtractGroup(ctx)
+		jobs        = make(chan TxTransfer)
+		results     = make(chan ExtractResult)
+		extracting  sync.WaitGroup
+		failed      = 0
+	)
 
-			} else {
-				//记录未扫区块
-				unscanRecord := openwallet.NewUnscanRecord(height, "", "", bs.wm.Symbol())
-				bs.SaveUnscanRecord(unscanRecord)
-				bs.wm.Log.Std.Info("block height: %d extract failed.", height)
-				failed++ //标记保存失败数
-			}
-			//累计完成的线程数
-			done++
-			if done == shouldDone {
-				//bs.wm.Log.Std.Info("done = %d, shouldDone = %d ", done, len(txs))
-				close(quit) //关闭通道，等于给通道传入nil
+	//派发工作
+	group.Go(func() error {
+		defer close(jobs)
+		for _, tx := range txs {
+			select {
+			case jobs <- tx:
+			case <-gctx.Done():
+				return gctx.Err()
 			}
 		}
-	}
+		return nil
+	})
 
 	//提取工作
-	extractWork := func(eblockHeight uint64, eBlockHash string, eBlockTime int64, txs []TxTransfer, eProducer chan ExtractResult) {
-		for _, tx := range txs {
-			bs.extractingCH <- struct{}{}
-			go func(mBlockHeight uint64, tx TxTransfer, end chan struct{}, mProducer chan<- ExtractResult) {
+	for i := 0; i < bs.extractConcurrency(len(txs)); i++ {
+		extracting.Add(1)
+		group.Go(func() error {
+			defer extracting.Done()
+			for tx := range jobs {
+				result := bs.extractTransaction(gctx, blockHeight, blockHash, blockTime, tx, bs.ScanTargetFunc)
+				select {
+				case results <- result:
+				case <-gctx.Done():
+					return gctx.Err()
+				}
+			}
+			return nil
+		})
+	}
 
-				//导出提出的交易
-				mProducer <- bs.ExtractTransaction(mBlockHeight, eBlockHash, tx, bs.ScanTargetFunc)
-				//释放
-				<-end
+	//全部提取工作结束后关闭结果通道
+	go func() {
+		extracting.Wait()
+		close(results)
+	}()
 
-			}(eblockHeight, tx, bs.extractingCH, eProducer)
+	//保存工作
+	for result := range results {
+		if !bs.saveExtractResult(blockHeight, result) {
+			failed++ //标记保存失败数
 		}
 	}
 
-	/*	开启导出的线程	*/
-
-	//独立线程运行消费
-	go saveWork(blockHeight, worker)
-
-	//独立线程运行生产
-	go extractWork(blockHeight, blockHash, blockTime, txs, producer)
-
-	//以下使用生产消费模式
-	bs.extractRuntime(producer, worker, quit)
-
+	if err := group.Wait(); err != nil {
+		return err
+	}
 	if failed > 0 {
-		return fmt.Errorf("block scanner saveWork failed")
-	} else {
-		return nil
+		return fmt.Errorf("block scanner saveWork failed: %d of %d transactions", failed, len(txs))
 	}
-
-	//return nil
+	return nil
 }
 
-//extractRuntime 提取运行时
-func (bs *NearBlockScanner) extractRuntime(producer chan ExtractResult, worker chan ExtractResult, quit chan struct{}) {
-
-	var (
-		values = make([]ExtractResult, 0)
-	)
-
-	for {
+//saveExtractResult 通知提取结果，失败的交易记录为未扫记录
+func (bs *NearBlockScanner) saveExtractResult(height uint64, result ExtractResult) bool {
 
-		var activeWorker chan<- ExtractResult
-		var activeValue ExtractResult
+	ok := bs.notifyExtractResult(height, result)
+	if !ok {
+		bs.wm.Metrics.ExtractFailures.Add(1)
+	}
+	return ok
+}
 
-		//当数据队列有数据时，释放顶部，传输给消费者
-		if len(values) > 0 {
-			activeWorker = worker
-			activeValue = values[0]
+func (bs *NearBlockScanner) notifyExtractResult(height uint64, result ExtractResult) bool {
 
-		}
+	if !result.Success {
+		//记录未扫区块
+		unscanRecord := openwallet.NewUnscanRecord(height, result.TxID, "extract transaction failed", bs.wm.Symbol())
+		bs.SaveUnscanRecord(unscanRecord)
+		bs.wm.Logger.Warn("extract transaction failed", F("height", height), F("txid", result.TxID))
+		return false
+	}
 
-		select {
+	err := bs.newExtractDataNotify(height, result.extractData)
+	if err != nil {
+		//通知既未投递也未写入发件箱，记录未扫区块，重扫时重新通知
+		unscanRecord := openwallet.NewUnscanRecord(height, result.TxID, "notify extract data failed", bs.wm.Symbol())
+		bs.SaveUnscanRecord(unscanRecord)
+		bs.wm.Logger.Error("newExtractDataNotify failed", F("height", height), F("txid", result.TxID), F("error", err))
+		return false
+	}
 
-		//生成者不断生成数据，插入到数据队列尾部
-		case pa := <-producer:
-			values = append(values, pa)
-		case <-quit:
-			//退出
-			//bs.wm.Log.Std.Info("block scanner have been scanned!")
-			return
-		case activeWorker <- activeValue:
-			//wm.Log.Std.Info("Get %d", len(activeValue))
-			values = values[1:]
-		}
+	if len(result.extractData) > 0 && !bs.IsFinalized(height) {
+		//未final的到账，final后重新通知
+		unscanRecord := openwallet.NewUnscanRecord(height, result.TxID, unscanReasonAwaitFinality, bs.wm.Symbol())
+		bs.SaveUnscanRecord(unscanRecord)
 	}
+	return true
+}
 
+//extractConcurrency 提取交易的并发数，不超过交易数量
+func (bs *NearBlockScanner) extractConcurrency(txCount int) int {
+	concurrency := bs.wm.Config.ExtractConcurrency
+	if concurrency <= 0 {
+		concurrency = ExtractConcurrency
+	}
+	if concurrency > txCount {
+		concurrency = txCount
+	}
+	return concurrency
 }
 
 //提取交易单
-func (bs *NearBlockScanner) ExtractTransaction(blockHeight uint64, blockHash string, tx TxTransfer, scanTargetFunc openwallet.BlockScanTargetFunc) ExtractResult {
+func (bs *NearBlockScanner) ExtractTransaction(blockHeight uint64, blockHash string, blockTime int64, tx TxTransfer, scanTargetFunc openwallet.BlockScanTargetFunc) ExtractResult {
+	return bs.extractTransaction(context.Background(), blockHeight, blockHash, blockTime, tx, scanTargetFunc)
+}
+
+func (bs *NearBlockScanner) extractTransaction(ctx context.Context, blockHeight uint64, blockHash string, blockTime int64, tx TxTransfer, scanTargetFunc openwallet.BlockScanTargetFunc) ExtractResult {
 	var (
 		success = true
 		result  = ExtractResult{
@@ -613,6 +793,17 @@ func (bs *NearBlockScanner) ExtractTransaction(blockHeight uint64, blockHash str
 		}
 	)
 
+	//无转账金额的交易，只提取订阅账户支付的手续费
+	if tx.FeeOnly {
+		return bs.extractFeeOnlyTransaction(ctx, blockHeight, blockHash, blockTime, tx, scanTargetFunc)
+	}
+
+	//执行未完成的交易等待重扫时提取
+	if tx.Status == TxStatusPending {
+		result.Success = true
+		return result
+	}
+
 	feePayed := tx.Fee
 	//提出易单明细
 	accountId, ok1 := scanTargetFunc(openwallet.ScanTarget{
@@ -627,14 +818,15 @@ func (bs *NearBlockScanner) ExtractTransaction(blockHeight uint64, blockHash str
 
 	//相同账户
 	if accountId == accountId2 && len(accountId) > 0 && len(accountId2) > 0 {
-		bs.InitExtractResult(tx, feePayed, blockHeight, blockHash, accountId, &result, 0)
+		bs.InitExtractResult(tx, feePayed, blockHeight, blockHash, blockTime, accountId, &result, 0)
 	} else {
 		if ok1 {
-			bs.InitExtractResult(tx, feePayed, blockHeight, blockHash, accountId, &result, 1)
+			bs.InitExtractResult(tx, feePayed, blockHeight, blockHash, blockTime, accountId, &result, 1)
 		}
 
-		if ok2 {
-			bs.InitExtractResult(tx, feePayed, blockHeight, blockHash, accountId2, &result, 2)
+		//失败的交易接收者没有收到转账
+		if ok2 && tx.Status != TxStatusFail {
+			bs.InitExtractResult(tx, feePayed, blockHeight, blockHash, blockTime, accountId2, &result, 2)
 		}
 	}
 
@@ -645,8 +837,52 @@ func (bs *NearBlockScanner) ExtractTransaction(blockHeight uint64, blockHash str
 
 }
 
+//extractFeeOnlyTransaction 签名者为订阅账户时查询交易状态和燃烧的手续费
+func (bs *NearBlockScanner) extractFeeOnlyTransaction(ctx context.Context, blockHeight uint64, blockHash string, blockTime int64, tx TxTransfer, scanTargetFunc openwallet.BlockScanTargetFunc) ExtractResult {
+	result := ExtractResult{
+		BlockHeight: blockHeight,
+		TxID:        tx.TxId,
+		extractData: make(map[string][]*openwallet.TxExtractData),
+	}
+
+	accountId, ok := scanTargetFunc(openwallet.ScanTarget{
+		Address:          tx.From,
+		BalanceModelType: openwallet.BalanceModelTypeAddress,
+	})
+	if !ok {
+		result.Success = true
+		return result
+	}
+
+	txResult, err := bs.wm.TxPoller.QueryTransactionContext(ctx, tx.TxId, tx.From)
+	if err != nil {
+		bs.wm.Logger.Error("get transaction status failed", F("height", blockHeight), F("txid", tx.TxId), F("error", err))
+		result.Success = false
+		return result
+	}
+	tx.Status = txResult.TxStatus()
+	tx.Fee = txResult.TokensBurnt
+	tx.Reason = txResult.Reason()
+
+	//执行未完成，等待重扫
+	if tx.Status == TxStatusPending {
+		unscanRecord := openwallet.NewUnscanRecord(blockHeight, tx.TxId, unscanReasonTxPending, bs.wm.Symbol())
+		if err := bs.SaveUnscanRecord(unscanRecord); err != nil {
+			bs.wm.Logger.Error("save pending record failed", F("height", blockHeight), F("txid", tx.TxId), F("error", err))
+			result.Success = false
+			return result
+		}
+		result.Success = true
+		return result
+	}
+
+	bs.InitExtractResult(tx, tx.Fee, blockHeight, blockHash, blockTime, accountId, &result, 1)
+	result.Success = true
+	return result
+}
+
 //InitTronExtractResult operate = 0: 输入输出提取，1: 输入提取，2：输出提取
-func (bs *NearBlockScanner) InitExtractResult(tx TxTransfer, feePayed string, blockHeight uint64, blockHash string, sourceKey string, result *ExtractResult, operate int64) {
+func (bs *NearBlockScanner) InitExtractResult(tx TxTransfer, feePayed string, blockHeight uint64, blockHash string, blockTime int64, sourceKey string, result *ExtractResult, operate int64) {
 
 	txExtractDataArray := result.extractData[sourceKey]
 	if txExtractDataArray == nil {
@@ -655,7 +891,12 @@ func (bs *NearBlockScanner) InitExtractResult(tx TxTransfer, feePayed string, bl
 
 	txExtractData := &openwallet.TxExtractData{}
 
-	reason := ""
+	reason := tx.Reason
+
+	//失败的交易只扣除手续费
+	if tx.Status == TxStatusFail {
+		tx.Value = "0"
+	}
 
 	coin := openwallet.Coin{
 		Symbol:     bs.wm.Symbol(),
@@ -670,26 +911,40 @@ func (bs *NearBlockScanner) InitExtractResult(tx TxTransfer, feePayed string, bl
 		BlockHeight: blockHeight,
 		TxID:        tx.TxId,
 		Decimal:     bs.wm.Decimal(),
-		Amount:      "",
+		Amount:      amount.String(),
 		IsMemo:      true,
-		ConfirmTime: 0,
+		ConfirmTime: blockTime,
 		From:        []string{tx.From + ":" + amount.String()},
 		To:          []string{tx.To + ":" + amount.String()},
 		Status:      tx.Status,
 		Reason:      reason,
 	}
 
+	//交易动作摘要
+	if len(tx.Actions) > 0 {
+		transx.SetExtParam("actions", tx.Actions)
+	}
+	if tx.FeeOnly {
+		transx.SetExtParam("feeOnly", true)
+	}
+
+	//确认数和是否final，未final的到账在final后重新通知
+	transx.Confirm = int64(bs.Confirmations(blockHeight))
+	transx.SetExtParam("final", bs.IsFinalized(blockHeight))
+
 	wxID := openwallet.GenTransactionWxID(transx)
 	transx.WxID = wxID
 
 	txExtractData.Transaction = transx
 	if operate == 0 {
-		bs.extractTxInput(tx, blockHeight, blockHash, txExtractData)
-		bs.extractTxOutput(tx, blockHeight, blockHash, txExtractData)
+		bs.extractTxInput(tx, blockHeight, blockHash, blockTime, txExtractData)
+		if tx.Status != TxStatusFail {
+			bs.extractTxOutput(tx, blockHeight, blockHash, blockTime, txExtractData)
+		}
 	} else if operate == 1 {
-		bs.extractTxInput(tx, blockHeight, blockHash, txExtractData)
+		bs.extractTxInput(tx, blockHeight, blockHash, blockTime, txExtractData)
 	} else if operate == 2 {
-		bs.extractTxOutput(tx, blockHeight, blockHash, txExtractData)
+		bs.extractTxOutput(tx, blockHeight, blockHash, blockTime, txExtractData)
 	}
 
 	txExtractDataArray = append(txExtractDataArray, txExtractData)
@@ -697,7 +952,7 @@ func (bs *NearBlockScanner) InitExtractResult(tx TxTransfer, feePayed string, bl
 }
 
 //extractTxInput 提取交易单输入部分,无需手续费，所以只包含1个TxInput
-func (bs *NearBlockScanner) extractTxInput(tx TxTransfer, blockHeight uint64, blockHash string, txExtractData *openwallet.TxExtractData) {
+func (bs *NearBlockScanner) extractTxInput(tx TxTransfer, blockHeight uint64, blockHash string, blockTime int64, txExtractData *openwallet.TxExtractData) {
 	coin := openwallet.Coin{
 		Symbol:     bs.wm.Symbol(),
 		IsContract: false,
@@ -715,13 +970,13 @@ func (bs *NearBlockScanner) extractTxInput(tx TxTransfer, blockHeight uint64, bl
 	txInput.Recharge.BlockHash = blockHash
 	txInput.Recharge.BlockHeight = blockHeight
 	txInput.Recharge.Index = 0 //账户模型填0
-	txInput.Recharge.CreateAt = int64(0)
+	txInput.Recharge.CreateAt = blockTime
 	txExtractData.TxInputs = append(txExtractData.TxInputs, txInput)
 
 }
 
-//extractTxOutput 提取交易单输入部分,只有一个TxOutPut
-func (bs *NearBlockScanner) extractTxOutput(tx TxTransfer, blockHeight uint64, blockHash string, txExtractData *openwallet.TxExtractData) {
+//extractTxOutput 提取交易单输出部分,每个Transfer动作一个TxOutPut
+func (bs *NearBlockScanner) extractTxOutput(tx TxTransfer, blockHeight uint64, blockHash string, blockTime int64, txExtractData *openwallet.TxExtractData) {
 
 	amount, _ := decimal.NewFromString(tx.Value)
 	coin := openwallet.Coin{
@@ -729,47 +984,157 @@ func (bs *NearBlockScanner) extractTxOutput(tx TxTransfer, blockHeight uint64, b
 		IsContract: false,
 	}
 
-	//主网to交易转账信息,只有一个TxOutPut
-	txOutput := &openwallet.TxOutPut{}
-	txOutput.Recharge.Sid = openwallet.GenTxOutPutSID(tx.TxId, bs.wm.Symbol(), coin.ContractID, uint64(0))
-	txOutput.Recharge.TxID = tx.TxId
-	txOutput.Recharge.Address = tx.To
-	txOutput.Recharge.Coin = coin
-	txOutput.Recharge.IsMemo = false
-	txOutput.Recharge.Amount = amount.String()
-	txOutput.Recharge.BlockHash = blockHash
-	txOutput.Recharge.BlockHeight = blockHeight
-	txOutput.Recharge.Index = 0 //账户模型填0
-	txOutput.Recharge.CreateAt = int64(0)
+	//没有动作明细时只有一个TxOutPut
+	transfers := tx.Transfers
+	if len(transfers) == 0 {
+		transfers = []TransferAction{{Index: 0, Value: amount.String()}}
+	}
 
-	txExtractData.TxOutputs = append(txExtractData.TxOutputs, txOutput)
+	//主网to交易转账信息,每个Transfer动作一个TxOutPut
+	//输出序号按Transfer的先后编号而不是动作序号，单笔转账的交易保持序号0，重扫已处理的区块时Sid不变
+	for i, transfer := range transfers {
+		value, _ := decimal.NewFromString(transfer.Value)
+		txOutput := &openwallet.TxOutPut{}
+		txOutput.Recharge.Sid = openwallet.GenTxOutPutSID(tx.TxId, bs.wm.Symbol(), coin.ContractID, uint64(i))
+		txOutput.Recharge.TxID = tx.TxId
+		txOutput.Recharge.Address = tx.To
+		txOutput.Recharge.Coin = coin
+		txOutput.Recharge.IsMemo = false
+		txOutput.Recharge.Amount = value.String()
+		txOutput.Recharge.BlockHash = blockHash
+		txOutput.Recharge.BlockHeight = blockHeight
+		txOutput.Recharge.Index = uint64(i)
+		txOutput.Recharge.CreateAt = blockTime
+
+		txExtractData.TxOutputs = append(txExtractData.TxOutputs, txOutput)
+	}
 }
 
 //newExtractDataNotify 发送通知
-//发送通知
+//通知先写入发件箱，每个观测者投递成功后删除，失败的留在发件箱按(观测者, 交易)重投
 func (bs *NearBlockScanner) newExtractDataNotify(height uint64, extractData map[string][]*openwallet.TxExtractData) error {
-	for o, _ := range bs.Observers {
+
+	//去重键记录在交易扩展参数，观测者据此去除重复投递
+	dedupKeys := make(map[*openwallet.TxExtractData]string)
+	for key, array := range extractData {
+		for _, data := range array {
+			dedupKey := GenNotifyDedupKey(key, data)
+			data.Transaction.SetExtParam(extParamDedupKey, dedupKey)
+			dedupKeys[data] = dedupKey
+		}
+	}
+
+	failed := 0
+	observers := make(map[*OutboxMessage]openwallet.BlockScanNotificationObject)
+	messages := make([]*OutboxMessage, 0)
+	for o := range bs.Observers {
+		id, durable := observerID(o)
 		for key, array := range extractData {
 			for _, data := range array {
-				err := o.BlockExtractDataNotify(key, data)
-				if err != nil {
-					bs.wm.Log.Error("BlockExtractDataNotify unexpected error:", err)
-					//记录未扫区块
-					unscanRecord := openwallet.NewUnscanRecord(height, "", "ExtractData Notify failed.", bs.wm.Symbol())
-					err = bs.SaveUnscanRecord(unscanRecord)
-					if err != nil {
-						bs.wm.Log.Std.Error("block height: %d, save unscan record failed. unexpected error: %v", height, err.Error())
-					}
+				if durable {
+					msg := NewOutboxMessage(id, key, dedupKeys[data], data)
+					observers[msg] = o
+					messages = append(messages, msg)
+					continue
+				}
+				//没有稳定标识的观测者不写发件箱，直接投递
+				if err := bs.notifyObserver(o, id, key, data); err != nil {
+					bs.wm.Logger.Error("BlockExtractDataNotify failed", F("observer", id), F("height", height), F("txid", data.Transaction.TxID), F("error", err))
+					failed++
 				}
 			}
 		}
 	}
+
+	//先写入发件箱再投递，写入失败时由调用者记录未扫区块
+	if err := bs.Outbox.Put(messages); err != nil {
+		return fmt.Errorf("save outbox messages failed: %v", err)
+	}
+
+	delivered := make([]*OutboxMessage, 0, len(messages))
+	for _, msg := range messages {
+		ok, err := bs.deliverOutboxMessage(observers[msg], msg)
+		if ok {
+			delivered = append(delivered, msg)
+		} else if err != nil {
+			failed++
+		}
+	}
+	if err := bs.Outbox.Delete(delivered); err != nil {
+		bs.wm.Logger.Error("delete delivered outbox messages failed", F("height", height), F("error", err))
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d notifications were neither delivered nor saved to outbox", failed)
+	}
 	return nil
 }
 
+//notifyObserver 通知观测者并记录耗时
+func (bs *NearBlockScanner) notifyObserver(o openwallet.BlockScanNotificationObject, id, sourceKey string, data *openwallet.TxExtractData) error {
+	start := time.Now()
+	err := o.BlockExtractDataNotify(sourceKey, data)
+	bs.wm.Metrics.NotifyLatency.Observe(time.Since(start).Seconds(), id)
+	return err
+}
+
+//deliverOutboxMessage 投递一条消息，失败时记录到发件箱，记录失败时返回错误
+func (bs *NearBlockScanner) deliverOutboxMessage(o openwallet.BlockScanNotificationObject, msg *OutboxMessage) (bool, error) {
+	err := bs.notifyObserver(o, msg.ObserverID, msg.SourceKey, msg.Data)
+	if err == nil {
+		return true, nil
+	}
+	logger := bs.wm.Logger.With(F("observer", msg.ObserverID), F("height", msg.BlockHeight), F("txid", msg.TxID))
+	logger.Error("BlockExtractDataNotify failed", F("error", err))
+	if markErr := bs.Outbox.MarkFailed(msg, err); markErr != nil {
+		logger.Error("save outbox message failed", F("error", markErr))
+		return false, markErr
+	}
+	if msg.Dead {
+		logger.Error("outbox message exceeded max attempts, stop redelivery", F("attempts", msg.Attempts))
+	}
+	return false, nil
+}
+
+//RedeliverOutbox 重投发件箱中到了重投时间的消息，只投递给失败的观测者
+func (bs *NearBlockScanner) RedeliverOutbox() {
+	bs.redeliverOutbox(time.Now())
+}
+
+func (bs *NearBlockScanner) redeliverOutbox(now time.Time) {
+	for o := range bs.Observers {
+		id, durable := observerID(o)
+		if !durable {
+			continue
+		}
+		messages, err := bs.Outbox.List(id)
+		if err != nil {
+			bs.wm.Logger.Error("get outbox messages failed", F("observer", id), F("error", err))
+			continue
+		}
+		delivered := make([]*OutboxMessage, 0, len(messages))
+		for _, msg := range messages {
+			if !bs.Outbox.due(msg, now) {
+				continue
+			}
+			if ok, _ := bs.deliverOutboxMessage(o, msg); ok {
+				delivered = append(delivered, msg)
+			}
+		}
+		if err := bs.Outbox.Delete(delivered); err != nil {
+			bs.wm.Logger.Error("delete delivered outbox messages failed", F("observer", id), F("error", err))
+		}
+	}
+}
+
+//GetBlockByHeight 获取区块，getTxs为true时同时获取区块内的转账交易
 func (bs *NearBlockScanner) GetBlockByHeight(height uint64, getTxs bool) (*Block, error) {
+	return bs.GetBlockByHeightContext(context.Background(), height, getTxs)
+}
+
+//GetBlockByHeightContext 获取区块，上下文取消时中断查询
+func (bs *NearBlockScanner) GetBlockByHeightContext(ctx context.Context, height uint64, getTxs bool) (*Block, error) {
 	param := []interface{}{height}
-	result, err := bs.wm.client.Call("block", param)
+	result, err := bs.wm.client.CallContext(ctx, "block", param)
 	if err != nil {
 		return nil, err
 	}
@@ -782,46 +1147,31 @@ func (bs *NearBlockScanner) GetBlockByHeight(height uint64, getTxs bool) (*Block
 	//获取chunck 里的txs
 	if getTxs {
 		for _, chunk := range block.Chunks {
-			chunkResponse, err := bs.GetTxByChunk(chunk.ChunkHash)
+			chunkResponse, err := bs.GetTxByChunkContext(ctx, chunk.ChunkHash)
 			if err != nil {
 				return nil, err
 			}
 			for _, tx := range chunkResponse.Transactions {
 				if len(tx.Actions) > 0 {
 
-					hasTrans := false
-					value := "0"
-					for _, action := range tx.Actions {
-						switch action.(type) {
-						case string:
-							hasTrans = false
-						case map[string]interface{}:
-							actionMap := action.(map[string]interface{})
-							if transfer, exists := actionMap["Transfer"]; exists {
-								transferMap, ok := transfer.(map[string]interface{})
-								if !ok {
-									continue
-								}
-								value = transferMap["deposit"].(string)
-								hasTrans = true
-								break
-							}
-
-						default:
-						}
-
+					transfers, value, summaries, err := bs.parseTransferActions(tx.Actions)
+					if err != nil {
+						return nil, err
 					}
-					if !hasTrans || value == "0" {
+					if len(transfers) == 0 {
+						//签名者是否订阅在提取时判断，交易状态也在提取时查询
+						if bs.wm.Config.ExtractAllTransactions {
+							txTransfer := TxTransfer{From: tx.SignerID, To: tx.ReceiverID, TxId: tx.Hash, Value: "0", FeeOnly: true, Actions: summaries}
+							block.TxTransfer = append(block.TxTransfer, txTransfer)
+						}
 						continue
 					}
 
-					formatValue, err := decimal.NewFromString(value)
+					txResult, err := bs.wm.TxPoller.QueryTransactionContext(ctx, tx.Hash, tx.SignerID)
 					if err != nil {
 						return nil, err
 					}
-					formatValueDecimal := formatValue.Div(decimal.New(1, bs.wm.Decimal()))
-					txStatus, txFee, err := bs.GetTxStatus(tx.Hash, tx.SignerID)
-					txTransfer := TxTransfer{From: tx.SignerID, To: tx.ReceiverID, TxId: tx.Hash, Value: formatValueDecimal.String(), Fee: txFee, Status: txStatus}
+					txTransfer := TxTransfer{From: tx.SignerID, To: tx.ReceiverID, TxId: tx.Hash, Value: value.String(), Fee: txResult.TokensBurnt, Status: txResult.TxStatus(), Reason: txResult.Reason(), Actions: summaries, Transfers: transfers}
 					block.TxTransfer = append(block.TxTransfer, txTransfer)
 				}
 			}
@@ -830,12 +1180,88 @@ func (bs *NearBlockScanner) GetBlockByHeight(height uint64, getTxs bool) (*Block
 	return &block, nil
 }
 
+//parseTransferActions 解析交易中金额不为0的Transfer动作，返回每个动作的金额、合计金额和全部动作摘要
+func (bs *NearBlockScanner) parseTransferActions(actions []interface{}) ([]TransferAction, decimal.Decimal, []string, error) {
+	var (
+		transfers = make([]TransferAction, 0)
+		summaries = make([]string, 0, len(actions))
+		total     = decimal.Zero
+	)
+	for i, action := range actions {
+		summaries = append(summaries, summarizeAction(action))
+		actionMap, ok := action.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		transferMap, ok := actionMap["Transfer"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		deposit, ok := transferMap["deposit"].(string)
+		if !ok || deposit == "0" {
+			continue
+		}
+		value, err := decimal.NewFromString(deposit)
+		if err != nil {
+			return nil, decimal.Zero, nil, err
+		}
+		value = value.Div(decimal.New(1, bs.wm.Decimal()))
+		transfers = append(transfers, TransferAction{Index: uint64(i), Value: value.String()})
+		total = total.Add(value)
+	}
+	return transfers, total, summaries, nil
+}
+
+//summarizeAction 交易动作摘要，例如 Transfer:1000、FunctionCall:ft_transfer、AddKey:ed25519:xxx
+func summarizeAction(action interface{}) string {
+	switch a := action.(type) {
+	case string:
+		return a
+	case map[string]interface{}:
+		for name, detail := range a {
+			detailMap, ok := detail.(map[string]interface{})
+			if !ok {
+				return name
+			}
+			switch name {
+			case "Transfer", "Stake":
+				if amount, ok := detailMap["deposit"].(string); ok {
+					return name + ":" + amount
+				}
+				if amount, ok := detailMap["stake"].(string); ok {
+					return name + ":" + amount
+				}
+			case "FunctionCall":
+				if method, ok := detailMap["method_name"].(string); ok {
+					return name + ":" + method
+				}
+			case "AddKey", "DeleteKey":
+				if publicKey, ok := detailMap["public_key"].(string); ok {
+					return name + ":" + publicKey
+				}
+			case "DeleteAccount":
+				if beneficiary, ok := detailMap["beneficiary_id"].(string); ok {
+					return name + ":" + beneficiary
+				}
+			}
+			return name
+		}
+	}
+	return "Unknown"
+}
+
 //GetBlockHeight 获取区块链高度
 func (bs *NearBlockScanner) GetCurrentBlock() (uint64, error) {
+	return bs.GetCurrentBlockContext(context.Background())
+}
 
-	result, err := bs.wm.client.Get("/status", nil)
+//GetCurrentBlockContext 获取区块链高度
+func (bs *NearBlockScanner) GetCurrentBlockContext(ctx context.Context) (uint64, error) {
+
+	result, err := bs.wm.client.GetContext(ctx, "/status", nil)
 	if err != nil {
 		log.Error(err)
+		return 0, err
 	}
 	status := Status{}
 	if err := json.Unmarshal([]byte(result.Raw), &status); err != nil {
@@ -845,22 +1271,157 @@ func (bs *NearBlockScanner) GetCurrentBlock() (uint64, error) {
 }
 
 func (bs *NearBlockScanner) GetLatestRefBlockHash() (string, error) {
-	currentBlockHeight, err := bs.GetCurrentBlock()
+	return bs.GetLatestRefBlockHashContext(context.Background())
+}
+
+func (bs *NearBlockScanner) GetLatestRefBlockHashContext(ctx context.Context) (string, error) {
+	block, err := bs.GetLatestRefBlockContext(ctx)
 	if err != nil {
 		return "0", err
 	}
+	return block.Hash, nil
+}
 
-	block, err := bs.GetBlockByHeight(currentBlockHeight-500, false)
+//GetLatestRefBlock 获取交易引用的区块，取最新的final区块
+func (bs *NearBlockScanner) GetLatestRefBlock() (*BlockHeader, error) {
+	return bs.GetLatestRefBlockContext(context.Background())
+}
+
+//GetLatestRefBlockContext 获取交易引用的区块，取最新的final区块
+func (bs *NearBlockScanner) GetLatestRefBlockContext(ctx context.Context) (*BlockHeader, error) {
+	param := map[string]interface{}{"finality": "final"}
+	result, err := bs.wm.client.Call2Context(ctx, "block", param)
 	if err != nil {
-		return "0", err
+		return nil, err
+	}
+	block := Block{}
+	err = json.Unmarshal([]byte(result.Raw), &block)
+	if err != nil {
+		return nil, err
+	}
+	if len(block.Header.Hash) == 0 {
+		return nil, fmt.Errorf("final block hash is empty")
+	}
+	return &block.Header, nil
+}
+
+//refreshFinalBlockHeight 更新最新final区块高度，查询失败时保留上次的高度
+func (bs *NearBlockScanner) refreshFinalBlockHeight(ctx context.Context) {
+	finalBlock, err := bs.GetLatestRefBlockContext(ctx)
+	if err != nil {
+		bs.wm.Logger.Warn("block scanner can not get final block", F("error", err))
+		return
+	}
+	bs.setFinalBlockHeight(finalBlock.Height)
+}
+
+//setCurrentBlockHeight 记录链上最新高度
+func (bs *NearBlockScanner) setCurrentBlockHeight(height uint64) {
+	bs.heightMu.Lock()
+	defer bs.heightMu.Unlock()
+	bs.CurrentBlockHeight = height
+}
+
+//setFinalBlockHeight 记录最新final区块高度，最新高度不低于final高度
+func (bs *NearBlockScanner) setFinalBlockHeight(height uint64) {
+	bs.heightMu.Lock()
+	defer bs.heightMu.Unlock()
+	bs.finalBlockHeight = height
+	if height > bs.CurrentBlockHeight {
+		bs.CurrentBlockHeight = height
+	}
+}
+
+//blockHeights 链上最新高度和最新final区块高度
+func (bs *NearBlockScanner) blockHeights() (uint64, uint64) {
+	bs.heightMu.RLock()
+	defer bs.heightMu.RUnlock()
+	return bs.CurrentBlockHeight, bs.finalBlockHeight
+}
+
+//reportScanProgress 记录扫描进度，每次任务落后超过阈值时告警一次
+func (bs *NearBlockScanner) reportScanProgress(scannedHeight, chainHeight uint64, alerted *bool) {
+	bs.wm.Metrics.SetScanProgress(scannedHeight, chainHeight)
+	threshold := bs.wm.Config.ScanLagAlertThreshold
+	if threshold == 0 || *alerted || chainHeight <= scannedHeight {
+		return
+	}
+	if lag := chainHeight - scannedHeight; lag > threshold {
+		bs.wm.Logger.Warn("block scanner is behind chain head",
+			F("height", scannedHeight),
+			F("chainHeight", chainHeight),
+			F("lag", lag),
+			F("threshold", threshold))
+		*alerted = true
+	}
+}
+
+//Confirmations 区块相对于最新高度的确认数，区块本身算1个确认
+func (bs *NearBlockScanner) Confirmations(height uint64) uint64 {
+	currentHeight, _ := bs.blockHeights()
+	return confirmations(height, currentHeight)
+}
+
+func confirmations(height, currentHeight uint64) uint64 {
+	if height == 0 || currentHeight < height {
+		return 0
+	}
+	return currentHeight - height + 1
+}
+
+//IsFinalized 区块已final且达到配置的确认数
+func (bs *NearBlockScanner) IsFinalized(height uint64) bool {
+	currentHeight, finalHeight := bs.blockHeights()
+	return height <= finalHeight && confirmations(height, currentHeight) >= bs.wm.Config.ConfirmationThreshold
+}
+
+//GetTxValidityPeriod 交易有效期区块数，从创世配置读取，失败时使用默认配置
+func (bs *NearBlockScanner) GetTxValidityPeriod() uint64 {
+	return bs.GetTxValidityPeriodContext(context.Background())
+}
+
+//GetTxValidityPeriodContext 交易有效期区块数，只缓存成功查询的结果，查询失败或被取消时本次使用默认配置，下次重新查询
+func (bs *NearBlockScanner) GetTxValidityPeriodContext(ctx context.Context) uint64 {
+	bs.validityMu.Lock()
+	if bs.validityLoaded {
+		period := bs.wm.Config.TxValidityPeriod
+		bs.validityMu.Unlock()
+		return period
 	}
-	return block.Header.Hash, nil
+	bs.validityMu.Unlock()
+
+	//查询期间不持有锁，避免挂起的请求阻塞其他调用
+	result, err := bs.wm.client.CallContext(ctx, "EXPERIMENTAL_genesis_config", []interface{}{})
+
+	bs.validityMu.Lock()
+	defer bs.validityMu.Unlock()
+	if err != nil {
+		bs.wm.Logger.Warn("get genesis config failed, use default transaction validity period", F("period", bs.wm.Config.TxValidityPeriod), F("error", err))
+		return bs.wm.Config.TxValidityPeriod
+	}
+	if period := result.Get("transaction_validity_period").Uint(); period > 0 && !bs.validityLoaded {
+		bs.wm.Config.TxValidityPeriod = period
+	}
+	bs.validityLoaded = true
+	return bs.wm.Config.TxValidityPeriod
+}
+
+//setTxValidityPeriod 使用外部配置的交易有效期，不再查询创世配置
+func (bs *NearBlockScanner) setTxValidityPeriod(period uint64) {
+	bs.validityMu.Lock()
+	defer bs.validityMu.Unlock()
+	bs.wm.Config.TxValidityPeriod = period
+	bs.validityLoaded = true
 }
 
 //获取含有transfer action 的 tx
 func (bs *NearBlockScanner) GetTxByChunk(chunkHash string) (*ChunkResponse, error) {
+	return bs.GetTxByChunkContext(context.Background(), chunkHash)
+}
+
+func (bs *NearBlockScanner) GetTxByChunkContext(ctx context.Context, chunkHash string) (*ChunkResponse, error) {
 	param := []interface{}{chunkHash}
-	result, err := bs.wm.client.Call("chunk", param)
+	result, err := bs.wm.client.CallContext(ctx, "chunk", param)
 	if err != nil {
 		return nil, err
 	}
@@ -896,35 +1457,27 @@ func (bs *NearBlockScanner) gatherTxFee(tx TransactionStatus) (string, error) {
 	return sumFee.String(), nil
 }
 
-//获取含有transfer action 的 tx
+//GetTxStatus 获取交易状态和实际燃烧的手续费，失败的交易同样燃烧手续费，执行未完成返回TxStatusPending
 func (bs *NearBlockScanner) GetTxStatus(txId, senderId string) (string, string, error) {
-	param := []interface{}{txId, senderId}
-	result, err := bs.wm.client.Call("tx", param)
-	if err != nil {
-		return "0", "0", err
-	}
-	txResp := TransactionStatus{}
-	resultJson := result.Raw
-	err = json.Unmarshal([]byte(resultJson), &txResp)
+	return bs.GetTxStatusContext(context.Background(), txId, senderId)
+}
+
+func (bs *NearBlockScanner) GetTxStatusContext(ctx context.Context, txId, senderId string) (string, string, error) {
+	txResult, err := bs.wm.TxPoller.QueryTransactionContext(ctx, txId, senderId)
 	if err != nil {
-		return "0", "0", err
+		return "", "0", err
 	}
-	if _, exists := txResp.Status["SuccessValue"]; exists {
-		txFee, err := bs.gatherTxFee(txResp)
-		if err != nil {
-			return "0", "0", nil
-		}
-		return "1", txFee, nil
-	}
-
-	//获取chunk 里的txs
-	return "0", "0", nil
+	return txResult.TxStatus(), txResult.TokensBurnt, nil
 }
 
 //获取含有transfer action 的 tx
 func (bs *NearBlockScanner) GetGasPrice() (string, error) {
+	return bs.GetGasPriceContext(context.Background())
+}
+
+func (bs *NearBlockScanner) GetGasPriceContext(ctx context.Context) (string, error) {
 	param := []interface{}{nil}
-	result, err := bs.wm.client.Call("gas_price", param)
+	result, err := bs.wm.client.CallContext(ctx, "gas_price", param)
 	if err != nil {
 		return "0", err
 	}
@@ -934,8 +1487,12 @@ func (bs *NearBlockScanner) GetGasPrice() (string, error) {
 
 //获取含有transfer action 的 tx
 func (bs *NearBlockScanner) GetAccountBalance(accountId string) (string, error) {
+	return bs.GetAccountBalanceContext(context.Background(), accountId)
+}
+
+func (bs *NearBlockScanner) GetAccountBalanceContext(ctx context.Context, accountId string) (string, error) {
 	param := map[string]interface{}{"request_type": "view_account", "finality": "final", "account_id": accountId}
-	result, err := bs.wm.client.Call2("query", param)
+	result, err := bs.wm.client.Call2Context(ctx, "query", param)
 	if err != nil {
 		return "0", err
 	}
@@ -955,26 +1512,101 @@ func (bs *NearBlockScanner) GetAccountBalance(accountId string) (string, error)
 
 //获取含有transfer action 的 tx
 func (bs *NearBlockScanner) GetAccountNonce(accountId string) (uint64, error) {
+	return bs.GetAccountNonceContext(context.Background(), accountId)
+}
+
+func (bs *NearBlockScanner) GetAccountNonceContext(ctx context.Context, accountId string) (uint64, error) {
 	hexBytes, err := hex.DecodeString(accountId)
 	if err != nil {
 		return 0, nil
 	}
 	publicKey := "ed25519:" + base58.Encode(hexBytes)
-	param := map[string]interface{}{"request_type": "view_access_key", "finality": "final", "account_id": accountId, "public_key": publicKey}
-	result, err := bs.wm.client.Call2("query", param)
+	return bs.GetAccessKeyNonceContext(ctx, accountId, publicKey)
+}
+
+//GetAccessKeyNonce 获取账户访问密钥的链上nonce
+func (bs *NearBlockScanner) GetAccessKeyNonce(accountId, publicKey string) (uint64, error) {
+	return bs.GetAccessKeyNonceContext(context.Background(), accountId, publicKey)
+}
+
+//GetAccessKeyNonceContext 获取账户访问密钥的链上nonce
+func (bs *NearBlockScanner) GetAccessKeyNonceContext(ctx context.Context, accountId, publicKey string) (uint64, error) {
+	accessKey, err := bs.GetAccessKeyContext(ctx, accountId, publicKey)
 	if err != nil {
 		return 0, err
 	}
+	return accessKey.Nonce, nil
+}
+
+//GetAccessKeyContext 查询账户的访问密钥，密钥不存在时返回错误
+func (bs *NearBlockScanner) GetAccessKeyContext(ctx context.Context, accountId, publicKey string) (*AccessKeyResponse, error) {
+	param := map[string]interface{}{"request_type": "view_access_key", "finality": "final", "account_id": accountId, "public_key": publicKey}
+	result, err := bs.wm.client.Call2Context(ctx, "query", param)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 	accessKeyResp := AccessKeyResponse{}
-	resultJson := result.Raw
-	err = json.Unmarshal([]byte(resultJson), &accessKeyResp)
+	err = json.Unmarshal([]byte(result.Raw), &accessKeyResp)
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+	if len(accessKeyResp.Error) > 0 {
+		return nil, fmt.Errorf("%s", accessKeyResp.Error)
+	}
+	return &accessKeyResp, nil
+}
+
+//GetAccessKeyListContext 查询账户的全部访问密钥
+func (bs *NearBlockScanner) GetAccessKeyListContext(ctx context.Context, accountId string) ([]*AccessKeyInfo, error) {
+	param := map[string]interface{}{"request_type": "view_access_key_list", "finality": "final", "account_id": accountId}
+	result, err := bs.wm.client.Call2Context(ctx, "query", param)
+	if err != nil {
+		return nil, err
+	}
+	if errMsg := result.Get("error").String(); len(errMsg) > 0 {
+		return nil, fmt.Errorf("%s", errMsg)
+	}
+	listResp := AccessKeyListResponse{}
+	err = json.Unmarshal([]byte(result.Raw), &listResp)
+	if err != nil {
+		return nil, err
+	}
+	return listResp.Keys, nil
+}
+
+//CallViewFunctionContext 调用合约的只读方法，args按json编码，返回结果按json解析到result
+func (bs *NearBlockScanner) CallViewFunctionContext(ctx context.Context, contractId, method string, args interface{}, result interface{}) error {
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+	argsJSON, err := json.Marshal(args)
+	if err != nil {
+		return err
 	}
-	return accessKeyResp.Nonce, nil
+	param := map[string]interface{}{
+		"request_type": "call_function",
+		"finality":     "final",
+		"account_id":   contractId,
+		"method_name":  method,
+		"args_base64":  base64.StdEncoding.EncodeToString(argsJSON),
+	}
+	resp, err := bs.wm.client.Call2Context(ctx, "query", param)
+	if err != nil {
+		return err
+	}
+	//合约执行错误在result.error中返回
+	if errMsg := resp.Get("error").String(); len(errMsg) > 0 {
+		return fmt.Errorf("call %s.%s failed: %s", contractId, method, errMsg)
+	}
+	values := resp.Get("result").Array()
+	buf := make([]byte, 0, len(values))
+	for _, v := range values {
+		buf = append(buf, byte(v.Uint()))
+	}
+	if err := json.Unmarshal(buf, result); err != nil {
+		return fmt.Errorf("call %s.%s result invalid: %v", contractId, method, err)
+	}
+	return nil
 }
 
 //ExtractTransactionData
@@ -993,32 +1625,80 @@ func (bs *NearBlockScanner) ExtractTransactionData(txid string, scanAddressFunc
 //Run 运行
 func (bs *NearBlockScanner) Run() error {
 
+	bs.stateMu.Lock()
 	bs.BlockScannerBase.Run()
+	bs.stateMu.Unlock()
 
 	return nil
 }
 
-////Stop 停止扫描
+////Stop 停止扫描，取消进行中的工作并限时等待其结束
 func (bs *NearBlockScanner) Stop() error {
 
+	bs.stateMu.Lock()
 	bs.BlockScannerBase.Stop()
+	bs.stateMu.Unlock()
 
-	return nil
+	return bs.cancelAndWait()
 }
 
-//Pause 暂停扫描
+//Pause 暂停扫描，取消进行中的工作并限时等待其结束
 func (bs *NearBlockScanner) Pause() error {
 
+	bs.stateMu.Lock()
 	bs.BlockScannerBase.Pause()
+	bs.stateMu.Unlock()
 
-	return nil
+	return bs.cancelAndWait()
 }
 
 //Restart 继续扫描
 func (bs *NearBlockScanner) Restart() error {
 
+	bs.stateMu.Lock()
 	bs.BlockScannerBase.Restart()
+	bs.stateMu.Unlock()
+
+	return nil
+}
+
+//isScanning 扫描器是否在运行
+func (bs *NearBlockScanner) isScanning() bool {
+	bs.stateMu.RLock()
+	defer bs.stateMu.RUnlock()
+	return bs.Scanning
+}
+
+//scanContext 当前扫描上下文
+func (bs *NearBlockScanner) scanContext() context.Context {
+	bs.ctxMu.Lock()
+	defer bs.ctxMu.Unlock()
+	return bs.ctx
+}
 
+//beginWork 登记一项扫描工作，返回当前扫描上下文和结束登记的函数
+func (bs *NearBlockScanner) beginWork() (context.Context, func()) {
+	bs.ctxMu.Lock()
+	defer bs.ctxMu.Unlock()
+	bs.inflight.Add()
+	return bs.ctx, bs.inflight.Done
+}
+
+//cancelScanning 取消进行中的提取工作，之后的扫描使用新的上下文
+func (bs *NearBlockScanner) cancelScanning() {
+	bs.ctxMu.Lock()
+	defer bs.ctxMu.Unlock()
+	bs.cancel()
+	bs.ctx, bs.cancel = context.WithCancel(context.Background())
+}
+
+//cancelAndWait 取消进行中的工作，等待其结束，超过ShutdownTimeout返回错误
+func (bs *NearBlockScanner) cancelAndWait() error {
+	bs.cancelScanning()
+	timeout := time.Duration(bs.wm.Config.ShutdownTimeout) * time.Second
+	if !bs.inflight.Wait(timeout) {
+		return fmt.Errorf("block scanner in-flight work not finished after %v", timeout)
+	}
 	return nil
 }
 
@@ -1,5 +1,210 @@
 package near
 
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+func TestNearBlockScanner_ExtractFailedTransaction(t *testing.T) {
+	bs := NewWalletManager().Blockscanner
+	scanTarget := func(target openwallet.ScanTarget) (string, bool) {
+		return target.Address, true
+	}
+
+	//失败的转账只扣除发送者手续费，接收者没有入账
+	tx := TxTransfer{From: "a.near", To: "b.near", TxId: "tx1", Value: "1.5", Fee: "0.0000446365125", Status: TxStatusFail, Reason: "ActionError: AccountDoesNotExist"}
+	result := bs.ExtractTransaction(100, "hash", 1600000000, tx, scanTarget)
+	if len(result.extractData["b.near"]) != 0 {
+		t.Errorf("failed transfer should not credit receiver")
+	}
+	sent := result.extractData["a.near"]
+	if len(sent) != 1 || len(sent[0].TxInputs) != 1 || sent[0].TxInputs[0].Amount != "0" {
+		t.Errorf("unexpected sender extract data: %+v", sent)
+		return
+	}
+	if sent[0].Transaction.Fees != tx.Fee || sent[0].Transaction.Status != TxStatusFail || sent[0].Transaction.Reason != tx.Reason {
+		t.Errorf("unexpected transaction: %+v", sent[0].Transaction)
+	}
+
+	//执行未完成的交易不提取
+	tx.Status = TxStatusPending
+	result = bs.ExtractTransaction(100, "hash", 1600000000, tx, scanTarget)
+	if !result.Success || len(result.extractData) != 0 {
+		t.Errorf("pending transaction should not be extracted")
+	}
+}
+
+func TestSummarizeAction(t *testing.T) {
+	actions := []interface{}{
+		"CreateAccount",
+		map[string]interface{}{"Transfer": map[string]interface{}{"deposit": "1000"}},
+		map[string]interface{}{"FunctionCall": map[string]interface{}{"method_name": "ft_transfer", "args": "e30=", "gas": 30000000000000, "deposit": "1"}},
+		map[string]interface{}{"AddKey": map[string]interface{}{"public_key": "ed25519:abc", "access_key": map[string]interface{}{}}},
+	}
+	expected := []string{"CreateAccount", "Transfer:1000", "FunctionCall:ft_transfer", "AddKey:ed25519:abc"}
+	for i, action := range actions {
+		if summary := summarizeAction(action); summary != expected[i] {
+			t.Errorf("unexpected summary: %s, expected: %s", summary, expected[i])
+		}
+	}
+}
+
+func TestNearBlockScanner_ExtractFeeOnlyTransaction(t *testing.T) {
+	bs := NewWalletManager().Blockscanner
+	notSubscribed := func(target openwallet.ScanTarget) (string, bool) {
+		return "", false
+	}
+
+	//签名者未订阅，不查询交易状态
+	tx := TxTransfer{From: "a.near", To: "token.near", TxId: "tx1", Value: "0", FeeOnly: true, Actions: []string{"FunctionCall:ft_transfer"}}
+	result := bs.ExtractTransaction(100, "hash", 1600000000, tx, notSubscribed)
+	if !result.Success || len(result.extractData) != 0 {
+		t.Errorf("unexpected extract result: %+v", result)
+	}
+
+	//手续费交易的动作摘要记录在扩展参数
+	tx.Status = TxStatusSuccess
+	result = ExtractResult{extractData: make(map[string][]*openwallet.TxExtractData)}
+	bs.InitExtractResult(tx, "0.0001", 100, "hash", 1600000000, "a.near", &result, 1)
+	data := result.extractData["a.near"]
+	if len(data) != 1 || data[0].TxInputs[0].Amount != "0" || data[0].Transaction.Fees != "0.0001" {
+		t.Errorf("unexpected extract data: %+v", data)
+		return
+	}
+	ext := data[0].Transaction.GetExtParam()
+	if !ext.Get("feeOnly").Bool() || ext.Get("actions.0").String() != "FunctionCall:ft_transfer" {
+		t.Errorf("unexpected ext param: %s", data[0].Transaction.ExtParam)
+	}
+}
+
+func TestNearBlockScanner_ExtractMultiTransferTransaction(t *testing.T) {
+	bs := NewWalletManager().Blockscanner
+	actions := []interface{}{
+		map[string]interface{}{"Transfer": map[string]interface{}{"deposit": "1000000000000000000000000"}},
+		map[string]interface{}{"FunctionCall": map[string]interface{}{"method_name": "ping"}},
+		map[string]interface{}{"Transfer": map[string]interface{}{"deposit": "500000000000000000000000"}},
+		map[string]interface{}{"Transfer": map[string]interface{}{"deposit": "0"}},
+	}
+	transfers, total, summaries, err := bs.parseTransferActions(actions)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+	if len(transfers) != 2 || transfers[1].Index != 2 || transfers[1].Value != "0.5" || total.String() != "1.5" || len(summaries) != 4 {
+		t.Errorf("unexpected transfers: %+v, total: %s", transfers, total.String())
+		return
+	}
+
+	scanTarget := func(target openwallet.ScanTarget) (string, bool) {
+		return target.Address, target.Address == "b.near"
+	}
+	tx := TxTransfer{From: "a.near", To: "b.near", TxId: "tx1", Value: total.String(), Fee: "0.0001", Status: TxStatusSuccess, Transfers: transfers}
+	result := bs.ExtractTransaction(100, "hash", 1600000000, tx, scanTarget)
+	data := result.extractData["b.near"]
+	if len(data) != 1 || len(data[0].TxOutputs) != 2 {
+		t.Errorf("unexpected extract data: %+v", data)
+		return
+	}
+	outputs := data[0].TxOutputs
+	if outputs[0].Sid == outputs[1].Sid || outputs[0].Amount != "1" || outputs[1].Amount != "0.5" {
+		t.Errorf("unexpected outputs: %+v, %+v", outputs[0].Recharge, outputs[1].Recharge)
+	}
+	if data[0].Transaction.Amount != "1.5" || data[0].Transaction.To[0] != "b.near:1.5" {
+		t.Errorf("unexpected transaction: %+v", data[0].Transaction)
+	}
+	if data[0].Transaction.ConfirmTime != 1600000000 || outputs[0].CreateAt != 1600000000 {
+		t.Errorf("unexpected block time: %d, %d", data[0].Transaction.ConfirmTime, outputs[0].CreateAt)
+	}
+}
+
+func TestNearBlockScanner_ExtractSingleTransferSid(t *testing.T) {
+	bs := NewWalletManager().Blockscanner
+	//隐式账户充值：CreateAccount+Transfer+AddKey，Transfer不是第一个动作
+	actions := []interface{}{
+		"CreateAccount",
+		map[string]interface{}{"Transfer": map[string]interface{}{"deposit": "1000000000000000000000000"}},
+		map[string]interface{}{"AddKey": map[string]interface{}{"public_key": "ed25519:key"}},
+	}
+	transfers, total, _, err := bs.parseTransferActions(actions)
+	if err != nil || len(transfers) != 1 || transfers[0].Index != 1 {
+		t.Fatalf("unexpected transfers: %+v, error: %v", transfers, err)
+	}
+
+	scanTarget := func(target openwallet.ScanTarget) (string, bool) {
+		return target.Address, target.Address == "b.near"
+	}
+	tx := TxTransfer{From: "a.near", To: "b.near", TxId: "tx1", Value: total.String(), Fee: "0.0001", Status: TxStatusSuccess, Transfers: transfers}
+	result := bs.ExtractTransaction(100, "hash", 1600000000, tx, scanTarget)
+	data := result.extractData["b.near"]
+	if len(data) != 1 || len(data[0].TxOutputs) != 1 {
+		t.Fatalf("unexpected extract data: %+v", data)
+	}
+	//单笔转账的输出序号仍为0，与没有动作明细时的Sid一致
+	output := data[0].TxOutputs[0]
+	if output.Index != 0 || output.Sid != openwallet.GenTxOutPutSID("tx1", bs.wm.Symbol(), "", 0) {
+		t.Errorf("unexpected output: %+v", output.Recharge)
+	}
+}
+
+func TestBlockHeader_Time(t *testing.T) {
+	header := BlockHeader{}
+	if err := json.Unmarshal([]byte(`{"height": 100, "timestamp": 1600000000123456789}`), &header); err != nil {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+	if header.Time() != 1600000000 {
+		t.Errorf("unexpected block time: %d", header.Time())
+	}
+}
+
+func TestNearBlockScanner_IsFinalized(t *testing.T) {
+	bs := NewWalletManager().Blockscanner
+	bs.setCurrentBlockHeight(105)
+	bs.setFinalBlockHeight(103)
+
+	if bs.Confirmations(100) != 6 || bs.Confirmations(106) != 0 {
+		t.Errorf("unexpected confirmations: %d, %d", bs.Confirmations(100), bs.Confirmations(106))
+	}
+	if !bs.IsFinalized(103) || bs.IsFinalized(104) {
+		t.Errorf("unexpected finality")
+	}
+
+	//达到确认数才算最终到账
+	bs.wm.Config.ConfirmationThreshold = 5
+	if bs.IsFinalized(103) || !bs.IsFinalized(101) {
+		t.Errorf("unexpected finality with confirmation threshold")
+	}
+
+	tx := TxTransfer{From: "a.near", To: "b.near", TxId: "tx1", Value: "1", Status: TxStatusSuccess}
+	scanTarget := func(target openwallet.ScanTarget) (string, bool) {
+		return target.Address, target.Address == "b.near"
+	}
+	data := bs.ExtractTransaction(101, "hash", 0, tx, scanTarget).extractData["b.near"]
+	if len(data) != 1 || data[0].Transaction.Confirm != 5 || !data[0].Transaction.GetExtParam().Get("final").Bool() {
+		t.Errorf("unexpected extract data: %+v", data)
+	}
+
+	//扫描任务更新高度时并发读取确认数
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for height := uint64(106); height < 200; height++ {
+			bs.setCurrentBlockHeight(height + 2)
+			bs.setFinalBlockHeight(height)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		bs.IsFinalized(101)
+	}
+	<-done
+	if !bs.IsFinalized(197) || bs.IsFinalized(198) || bs.Confirmations(199) != 3 {
+		t.Errorf("unexpected finality after update: %d", bs.Confirmations(199))
+	}
+}
+
 //
 //import (
 //	"testing"
@@ -101,3 +306,25 @@ package near
 //		}
 //	}
 //}
+
+func TestNearBlockScanner_GetTxValidityPeriodRetry(t *testing.T) {
+	node := newTestNode(map[string]string{"EXPERIMENTAL_genesis_config": `{"transaction_validity_period":100}`})
+	wm, clean := testWalletManager(t, node)
+	defer clean()
+
+	//被取消的查询使用默认配置，不缓存结果
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if period := wm.Blockscanner.GetTxValidityPeriodContext(ctx); period != TxValidityPeriod {
+		t.Errorf("unexpected validity period of canceled call: %d", period)
+	}
+
+	//之后的调用重新查询创世配置
+	if period := wm.Blockscanner.GetTxValidityPeriod(); period != 100 {
+		t.Errorf("unexpected validity period after retry: %d", period)
+	}
+	node.Close()
+	if period := wm.Blockscanner.GetTxValidityPeriod(); period != 100 {
+		t.Errorf("successful result should be cached: %d", period)
+	}
+}
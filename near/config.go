@@ -13,6 +13,23 @@ const (
 	Symbol    = "NEAR"
 	CurveType = owcrypt.ECC_CURVE_ED25519
 	Decimal   = 24
+	//交易有效期，transaction_validity_period 区块数
+	TxValidityPeriod = 86400
+	//异步广播后轮询交易状态的间隔和超时，秒
+	TxPollInterval = 2
+	TxPollTimeout  = 60
+	//到账确认数，0表示只要求区块已final
+	ConfirmationThreshold = 0
+	//未扫记录最大重试次数和首次重试间隔，秒
+	UnscanMaxAttempts   = 10
+	UnscanRetryInterval = 10
+	//通知最大投递次数和首次重投间隔，秒
+	NotifyMaxAttempts   = 10
+	NotifyRetryInterval = 10
+	//提取交易的并发数
+	ExtractConcurrency = 10
+	//停止扫描时等待进行中工作的时间，秒
+	ShutdownTimeout = 30
 	//默认配置内容
 	defaultConfig = `
 
@@ -48,6 +65,37 @@ type WalletConfig struct {
 	FixFees string
 
 	AddressRetainAmount string
+
+	//交易有效期区块数
+	TxValidityPeriod uint64
+	//异步广播，broadcast_tx_async后轮询交易状态
+	BroadcastAsync bool
+	//轮询交易状态超时，秒
+	TxPollTimeout int64
+	//提取订阅账户签名的全部交易，无转账金额的交易只记录手续费
+	ExtractAllTransactions bool
+	//到账确认数，区块已final且确认数达到后才算最终到账
+	ConfirmationThreshold uint64
+	//未扫记录最大重试次数，超过后进入死信列表
+	UnscanMaxAttempts int
+	//未扫记录首次重试间隔，秒，之后指数增长
+	UnscanRetryInterval int64
+	//通知最大投递次数，超过后留在发件箱不再自动重投
+	NotifyMaxAttempts int
+	//通知首次重投间隔，秒，之后指数增长
+	NotifyRetryInterval int64
+	//提取交易的并发数，每个区块独立的工作池
+	ExtractConcurrency int
+	//停止或暂停扫描时等待进行中工作结束的时间，秒
+	ShutdownTimeout int64
+	//扫描落后超过该区块数时告警，0表示不告警
+	ScanLagAlertThreshold uint64
+	//结构化日志级别：debug、info、warn、error
+	LogLevel string
+	//远程签名服务地址，配置后交易由签名服务签名，本进程不接触私钥
+	RemoteSignerURL string
+	//远程签名服务的访问令牌
+	RemoteSignerToken string
 }
 
 func NewConfig(symbol string) *WalletConfig {
@@ -73,6 +121,24 @@ func NewConfig(symbol string) *WalletConfig {
 	//algod token
 	//固定手续费
 	c.FixFees = "0"
+	//交易有效期区块数
+	c.TxValidityPeriod = TxValidityPeriod
+	//轮询交易状态超时
+	c.TxPollTimeout = TxPollTimeout
+	//到账确认数
+	c.ConfirmationThreshold = ConfirmationThreshold
+	//未扫记录重试策略
+	c.UnscanMaxAttempts = UnscanMaxAttempts
+	c.UnscanRetryInterval = UnscanRetryInterval
+	//通知重投策略
+	c.NotifyMaxAttempts = NotifyMaxAttempts
+	c.NotifyRetryInterval = NotifyRetryInterval
+	//提取交易的并发数
+	c.ExtractConcurrency = ExtractConcurrency
+	//停止扫描等待时间
+	c.ShutdownTimeout = ShutdownTimeout
+	//日志级别
+	c.LogLevel = "info"
 
 	//创建目录
 	file.MkdirAll(c.dbPath)
@@ -0,0 +1,134 @@
+package near
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+//NearCredential near-cli保存在 ~/.near-credentials/<network>/<account>.json 的密钥文件
+type NearCredential struct {
+	AccountID  string `json:"account_id"`
+	PublicKey  string `json:"public_key"`
+	PrivateKey string `json:"private_key,omitempty"` //ed25519:<base58(种子+公钥)>，只核对地址时为空
+}
+
+//NewNearCredential 由密钥对创建密钥文件，accountID为空时使用隐式账户
+func NewNearCredential(accountID string, kp *KeyPair) *NearCredential {
+	if len(accountID) == 0 {
+		accountID = kp.ImplicitAccountID()
+	}
+	return &NearCredential{
+		AccountID:  accountID,
+		PublicKey:  kp.PublicKeyString(),
+		PrivateKey: kp.SecretKey(),
+	}
+}
+
+//KeyPair 解析私钥，并校验与文件中的公钥一致
+func (c *NearCredential) KeyPair() (*KeyPair, error) {
+	if len(c.PrivateKey) == 0 {
+		return nil, fmt.Errorf("credential of %s has no private key", c.AccountID)
+	}
+	kp, err := ParseSecretKey(c.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("credential of %s: %v", c.AccountID, err)
+	}
+	if len(c.PublicKey) > 0 && kp.PublicKeyString() != c.PublicKey {
+		return nil, fmt.Errorf("credential of %s: public key %s does not match private key", c.AccountID, c.PublicKey)
+	}
+	return kp, nil
+}
+
+//MatchAddress 核对钱包地址：公钥一致，且账户为地址本身或公钥的隐式账户
+func (c *NearCredential) MatchAddress(address *openwallet.Address) bool {
+	publicKey, err := ParsePublicKey(c.PublicKey)
+	if err != nil {
+		return false
+	}
+	addressKey, err := hex.DecodeString(address.PublicKey)
+	if err != nil || !bytes.Equal(addressKey, publicKey) {
+		return false
+	}
+	return c.AccountID == address.Address || c.AccountID == ImplicitAccountID(publicKey)
+}
+
+//String 不输出私钥
+func (c *NearCredential) String() string {
+	return c.AccountID + " " + c.PublicKey
+}
+
+//DefaultCredentialsDir near-cli的密钥目录 ~/.near-credentials
+func DefaultCredentialsDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".near-credentials"
+	}
+	return filepath.Join(home, ".near-credentials")
+}
+
+//LoadNearCredentials 读取网络目录下的全部密钥文件，包括 <account>.json 和 <account>/<public_key>.json
+func LoadNearCredentials(dir, network string) ([]*NearCredential, error) {
+	networkDir := filepath.Join(dir, network)
+	files, err := filepath.Glob(filepath.Join(networkDir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	nested, err := filepath.Glob(filepath.Join(networkDir, "*", "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, nested...)
+	sort.Strings(files)
+
+	credentials := make([]*NearCredential, 0, len(files))
+	for _, file := range files {
+		buf, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		credential := NearCredential{}
+		if err := json.Unmarshal(buf, &credential); err != nil {
+			return nil, fmt.Errorf("parse credential %s failed: %v", file, err)
+		}
+		if len(credential.AccountID) == 0 {
+			//文件内容不一定包含账户，按文件所在位置确定
+			if filepath.Dir(file) == networkDir {
+				credential.AccountID = strings.TrimSuffix(filepath.Base(file), ".json")
+			} else {
+				credential.AccountID = filepath.Base(filepath.Dir(file))
+			}
+		}
+		credentials = append(credentials, &credential)
+	}
+	return credentials, nil
+}
+
+//SaveNearCredential 以near-cli的格式写入 <dir>/<network>/<account>.json，文件仅所有者可读
+func SaveNearCredential(dir, network string, credential *NearCredential) (string, error) {
+	if len(credential.AccountID) == 0 || strings.ContainsAny(credential.AccountID, `/\`) || strings.HasPrefix(credential.AccountID, ".") {
+		return "", errors.New("invalid credential account id")
+	}
+	networkDir := filepath.Join(dir, network)
+	if err := os.MkdirAll(networkDir, 0700); err != nil {
+		return "", err
+	}
+	buf, err := json.Marshal(credential)
+	if err != nil {
+		return "", err
+	}
+	file := filepath.Join(networkDir, credential.AccountID+".json")
+	if err := ioutil.WriteFile(file, buf, 0600); err != nil {
+		return "", err
+	}
+	return file, nil
+}
@@ -0,0 +1,126 @@
+package near
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+//执行失败类型
+const (
+	FailureActionError    = "ActionError"    //交易已上链，动作执行失败，手续费已扣除
+	FailureInvalidTxError = "InvalidTxError" //交易无效，未上链
+)
+
+//ExecutionFailure 交易执行失败原因
+//https://github.com/near/nearcore/blob/master/core/primitives/src/errors.rs
+type ExecutionFailure struct {
+	Type   string          //ActionError 或 InvalidTxError
+	Kind   string          //失败类型，例如 LackBalanceForState、AccountDoesNotExist、InvalidNonce
+	Index  *int64          //ActionError失败动作的序号
+	Detail json.RawMessage //失败类型的详细信息
+}
+
+//Error 实现error接口
+func (f *ExecutionFailure) Error() string {
+	msg := fmt.Sprintf("%s: %s", f.Type, f.Kind)
+	if f.Index != nil {
+		msg = fmt.Sprintf("%s, action index: %d", msg, *f.Index)
+	}
+	if len(f.Detail) > 0 && string(f.Detail) != "null" {
+		msg = fmt.Sprintf("%s, %s", msg, string(f.Detail))
+	}
+	return msg
+}
+
+//IsActionError 动作执行失败，交易已上链
+func (f *ExecutionFailure) IsActionError() bool {
+	return f.Type == FailureActionError
+}
+
+//IsInvalidTxError 交易无效，交易未上链，nonce未被使用
+func (f *ExecutionFailure) IsInvalidTxError() bool {
+	return f.Type == FailureInvalidTxError
+}
+
+//ParseExecutionFailure 解析执行状态中的Failure，兼容外层的TxExecutionError
+func ParseExecutionFailure(data []byte) (*ExecutionFailure, error) {
+	obj := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+	if inner, ok := obj["TxExecutionError"]; ok {
+		return ParseExecutionFailure(inner)
+	}
+
+	if raw, ok := obj[FailureActionError]; ok {
+		actionError := struct {
+			Index *int64          `json:"index"`
+			Kind  json.RawMessage `json:"kind"`
+		}{}
+		if err := json.Unmarshal(raw, &actionError); err != nil {
+			return nil, err
+		}
+		kind, detail, err := parseFailureKind(actionError.Kind)
+		if err != nil {
+			return nil, err
+		}
+		return &ExecutionFailure{Type: FailureActionError, Kind: kind, Index: actionError.Index, Detail: detail}, nil
+	}
+
+	if raw, ok := obj[FailureInvalidTxError]; ok {
+		kind, detail, err := parseFailureKind(raw)
+		if err != nil {
+			return nil, err
+		}
+		return &ExecutionFailure{Type: FailureInvalidTxError, Kind: kind, Detail: detail}, nil
+	}
+
+	return nil, fmt.Errorf("unknown execution failure: %s", string(data))
+}
+
+//parseFailureKind 失败类型为字符串，或只有一个键的对象
+func parseFailureKind(data json.RawMessage) (string, json.RawMessage, error) {
+	var kind string
+	if err := json.Unmarshal(data, &kind); err == nil {
+		return kind, nil, nil
+	}
+	obj := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return "", nil, err
+	}
+	if len(obj) == 0 {
+		return "", nil, errors.New("empty execution failure kind")
+	}
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	//嵌套的失败类型，例如 {"InvalidAccessKeyError": {"AccessKeyNotFound": {...}}}
+	if len(keys) == 1 {
+		if inner, detail, err := parseFailureKind(obj[keys[0]]); err == nil && isFailureKindName(inner) {
+			return keys[0] + "." + inner, detail, nil
+		}
+	}
+	return keys[0], obj[keys[0]], nil
+}
+
+//isFailureKindName 失败类型名称以大写字母开头，区别于详细信息的字段
+func isFailureKindName(name string) bool {
+	return len(name) > 0 && name[0] >= 'A' && name[0] <= 'Z'
+}
+
+//FailureFromError 从节点返回的错误中解析交易执行失败原因，无法解析返回nil
+func FailureFromError(err error) *ExecutionFailure {
+	rpcErr, ok := err.(*RPCError)
+	if !ok || !rpcErr.Data.IsObject() {
+		return nil
+	}
+	failure, parseErr := ParseExecutionFailure([]byte(rpcErr.Data.Raw))
+	if parseErr != nil {
+		return nil
+	}
+	return failure
+}
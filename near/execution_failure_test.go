@@ -0,0 +1,46 @@
+package near
+
+import (
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestParseExecutionFailure(t *testing.T) {
+	failure, err := ParseExecutionFailure([]byte(`{"ActionError":{"index":0,"kind":{"LackBalanceForState":{"account_id":"b.near","amount":"1820000000000000000000"}}}}`))
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+	if !failure.IsActionError() || failure.Kind != "LackBalanceForState" || failure.Index == nil || *failure.Index != 0 {
+		t.Errorf("unexpected failure: %v", failure)
+	}
+
+	failure, err = ParseExecutionFailure([]byte(`{"ActionError":{"index":1,"kind":{"AccountDoesNotExist":{"account_id":"Alice"}}}}`))
+	if err != nil || failure.Kind != "AccountDoesNotExist" || *failure.Index != 1 {
+		t.Errorf("unexpected failure: %v, err: %v", failure, err)
+	}
+
+	failure, err = ParseExecutionFailure([]byte(`{"InvalidTxError":{"InvalidAccessKeyError":{"AccessKeyNotFound":{"account_id":"a.near","public_key":"ed25519:xx"}}}}`))
+	if err != nil || !failure.IsInvalidTxError() || failure.Kind != "InvalidAccessKeyError.AccessKeyNotFound" || failure.Index != nil {
+		t.Errorf("unexpected failure: %v, err: %v", failure, err)
+	}
+
+	failure, err = ParseExecutionFailure([]byte(`{"InvalidTxError":"Expired"}`))
+	if err != nil || failure.Kind != "Expired" {
+		t.Errorf("unexpected failure: %v, err: %v", failure, err)
+	}
+}
+
+func TestFailureFromError(t *testing.T) {
+	resp := gjson.Parse(`{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"Server error","data":{"TxExecutionError":{"InvalidTxError":{"NotEnoughBalance":{"signer_id":"a.near","balance":"1","cost":"2"}}}}}}`)
+	failure := FailureFromError(isError(&resp))
+	if failure == nil || !failure.IsInvalidTxError() || failure.Kind != "NotEnoughBalance" {
+		t.Errorf("unexpected failure: %v", failure)
+	}
+
+	resp = gjson.Parse(`{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"Server error","data":"Timeout"}}`)
+	if failure := FailureFromError(isError(&resp)); failure != nil {
+		t.Errorf("unexpected failure: %v", failure)
+	}
+}
@@ -0,0 +1,51 @@
+package near
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+//extractGroup 一组提取工作，任一工作出错或上下文取消时取消其余工作，Wait返回第一个错误
+type extractGroup struct {
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	errOnce sync.Once
+	err     error
+}
+
+//newExtractGroup 创建工作组，返回的上下文在第一个错误或Wait返回后取消
+func newExtractGroup(ctx context.Context) (*extractGroup, context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	return &extractGroup{cancel: cancel}, ctx
+}
+
+//Go 启动一个工作
+func (g *extractGroup) Go(fn func() error) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		if err := fn(); err != nil {
+			g.errOnce.Do(func() {
+				g.err = err
+				g.cancel()
+			})
+		}
+	}()
+}
+
+//Wait 等待全部工作结束，返回第一个错误
+func (g *extractGroup) Wait() error {
+	g.wg.Wait()
+	g.cancel()
+	return g.err
+}
+
+//isExtractCanceled 提取工作是否因扫描器停止或暂停而取消
+//RPC请求被取消时返回的是包装了取消原因的*url.Error，需要解包判断
+func isExtractCanceled(ctx context.Context, err error) bool {
+	if err == nil {
+		return false
+	}
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || ctx.Err() != nil
+}
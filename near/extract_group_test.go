@@ -0,0 +1,158 @@
+package near
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+//countObserver 统计收到的提取通知，可在第n次通知时执行回调
+type countObserver struct {
+	mu       sync.Mutex
+	received map[string]int
+	onNotify func(count int)
+}
+
+func (o *countObserver) ObserverID() string {
+	return "count"
+}
+
+func (o *countObserver) BlockScanNotify(header *openwallet.BlockHeader) error {
+	return nil
+}
+
+func (o *countObserver) BlockExtractDataNotify(sourceKey string, data *openwallet.TxExtractData) error {
+	o.mu.Lock()
+	o.received[data.Transaction.TxID]++
+	count := len(o.received)
+	o.mu.Unlock()
+	if o.onNotify != nil {
+		o.onNotify(count)
+	}
+	return nil
+}
+
+//testExtractObserver 扫描b.near的充值，返回注册的观测者
+func testExtractObserver(bs *NearBlockScanner) *countObserver {
+	bs.SetBlockScanTargetFunc(func(target openwallet.ScanTarget) (string, bool) {
+		return target.Address, target.Address == "b.near"
+	})
+	observer := &countObserver{received: make(map[string]int)}
+	bs.AddObserver(observer)
+	return observer
+}
+
+func testExtractTxs(count int) []TxTransfer {
+	txs := make([]TxTransfer, 0, count)
+	for i := 0; i < count; i++ {
+		txs = append(txs, TxTransfer{From: "a.near", To: "b.near", TxId: fmt.Sprintf("tx%d", i), Value: "1", Status: TxStatusSuccess})
+	}
+	return txs
+}
+
+func TestExtractGroup_FirstError(t *testing.T) {
+	group, ctx := newExtractGroup(context.Background())
+	first := errors.New("first")
+	group.Go(func() error {
+		return first
+	})
+	group.Go(func() error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if err := group.Wait(); err != first {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestNearBlockScanner_BatchExtractTransaction(t *testing.T) {
+	wm, clean := testWalletManager(t, nil)
+	defer clean()
+	bs := wm.Blockscanner
+	observer := testExtractObserver(bs)
+
+	for _, concurrency := range []int{1, 4, 64} {
+		observer.received = make(map[string]int)
+		bs.wm.Config.ExtractConcurrency = concurrency
+		txs := testExtractTxs(30)
+		if err := bs.BatchExtractTransaction(100, "hash", txs, 0); err != nil {
+			t.Errorf("concurrency %d: unexpected error: %v", concurrency, err)
+		}
+		if len(observer.received) != len(txs) {
+			t.Errorf("concurrency %d: unexpected notified count: %d", concurrency, len(observer.received))
+		}
+		for txid, n := range observer.received {
+			if n != 1 {
+				t.Errorf("concurrency %d: %s notified %d times", concurrency, txid, n)
+			}
+		}
+	}
+
+	//并发调用互不影响
+	var wg sync.WaitGroup
+	observer.received = make(map[string]int)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(height uint64) {
+			defer wg.Done()
+			if err := bs.BatchExtractTransaction(height, "hash", testExtractTxs(10), 0); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}(uint64(200 + i))
+	}
+	wg.Wait()
+}
+
+func TestNearBlockScanner_BatchExtractTransactionCanceled(t *testing.T) {
+	wm, clean := testWalletManager(t, nil)
+	defer clean()
+	bs := wm.Blockscanner
+	observer := testExtractObserver(bs)
+
+	bs.wm.Config.ExtractConcurrency = 2
+	ctx, cancel := context.WithCancel(context.Background())
+	observer.onNotify = func(count int) {
+		if count == 3 {
+			cancel()
+		}
+	}
+	txs := testExtractTxs(50)
+	err := bs.batchExtractTransaction(ctx, 100, "hash", txs, 0)
+	if err != context.Canceled {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if len(observer.received) >= len(txs) {
+		t.Errorf("extraction should stop after cancel, notified: %d", len(observer.received))
+	}
+
+	//已取消的上下文不提取
+	observer.received = make(map[string]int)
+	observer.onNotify = nil
+	if err := bs.batchExtractTransaction(ctx, 101, "hash", txs, 0); !isExtractCanceled(ctx, err) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestNearBlockScanner_StopCancelsExtraction(t *testing.T) {
+	wm, clean := testWalletManager(t, nil)
+	defer clean()
+	bs := wm.Blockscanner
+
+	ctx := bs.scanContext()
+	bs.Stop()
+	if ctx.Err() != context.Canceled {
+		t.Errorf("stop should cancel in-flight extraction")
+	}
+	if bs.scanContext().Err() != nil {
+		t.Errorf("new scanning should use a fresh context")
+	}
+	ctx = bs.scanContext()
+	bs.Pause()
+	if ctx.Err() != context.Canceled {
+		t.Errorf("pause should cancel in-flight extraction")
+	}
+}
@@ -0,0 +1,262 @@
+package near
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/Assetsadapter/near-adapter/neartransaction"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	//运行时配置缓存时间
+	runtimeConfigCacheTime = 10 * time.Minute
+)
+
+var implicitAccountRegexp = regexp.MustCompile("^[0-9a-f]{64}$")
+
+//Fee 单项费用，单位gas
+//https://github.com/near/nearcore/blob/master/core/primitives-core/src/runtime/fees.rs
+type Fee struct {
+	SendSir    uint64 `json:"send_sir"`
+	SendNotSir uint64 `json:"send_not_sir"`
+	Execution  uint64 `json:"execution"`
+}
+
+//SendFee 发送费用，sir: sender is receiver
+func (f Fee) SendFee(sir bool) uint64 {
+	if sir {
+		return f.SendSir
+	}
+	return f.SendNotSir
+}
+
+//ExecFee 执行费用
+func (f Fee) ExecFee() uint64 {
+	return f.Execution
+}
+
+type AccessKeyCreationConfig struct {
+	FullAccessCost          Fee `json:"full_access_cost"`
+	FunctionCallCost        Fee `json:"function_call_cost"`
+	FunctionCallCostPerByte Fee `json:"function_call_cost_per_byte"`
+}
+
+type ActionCreationConfig struct {
+	CreateAccountCost         Fee                     `json:"create_account_cost"`
+	DeployContractCost        Fee                     `json:"deploy_contract_cost"`
+	DeployContractCostPerByte Fee                     `json:"deploy_contract_cost_per_byte"`
+	FunctionCallCost          Fee                     `json:"function_call_cost"`
+	FunctionCallCostPerByte   Fee                     `json:"function_call_cost_per_byte"`
+	TransferCost              Fee                     `json:"transfer_cost"`
+	StakeCost                 Fee                     `json:"stake_cost"`
+	AddKeyCost                AccessKeyCreationConfig `json:"add_key_cost"`
+	DeleteKeyCost             Fee                     `json:"delete_key_cost"`
+	DeleteAccountCost         Fee                     `json:"delete_account_cost"`
+}
+
+//RuntimeFeesConfig 运行时费用配置，对应 runtime_config.transaction_costs
+type RuntimeFeesConfig struct {
+	ActionReceiptCreationConfig Fee                  `json:"action_receipt_creation_config"`
+	ActionCreationConfig        ActionCreationConfig `json:"action_creation_config"`
+}
+
+//DefaultRuntimeFeesConfig 主网创世配置，节点不支持 EXPERIMENTAL_protocol_config 时使用
+func DefaultRuntimeFeesConfig() *RuntimeFeesConfig {
+	return &RuntimeFeesConfig{
+		ActionReceiptCreationConfig: Fee{SendSir: 108059500000, SendNotSir: 108059500000, Execution: 108059500000},
+		ActionCreationConfig: ActionCreationConfig{
+			CreateAccountCost:         Fee{SendSir: 99607375000, SendNotSir: 99607375000, Execution: 99607375000},
+			DeployContractCost:        Fee{SendSir: 184765750000, SendNotSir: 184765750000, Execution: 184765750000},
+			DeployContractCostPerByte: Fee{SendSir: 6812999, SendNotSir: 6812999, Execution: 6812999},
+			FunctionCallCost:          Fee{SendSir: 2319861500000, SendNotSir: 2319861500000, Execution: 2319861500000},
+			FunctionCallCostPerByte:   Fee{SendSir: 2235934, SendNotSir: 2235934, Execution: 2235934},
+			TransferCost:              Fee{SendSir: 115123062500, SendNotSir: 115123062500, Execution: 115123062500},
+			StakeCost:                 Fee{SendSir: 141715687500, SendNotSir: 141715687500, Execution: 102217625000},
+			AddKeyCost: AccessKeyCreationConfig{
+				FullAccessCost:          Fee{SendSir: 101765125000, SendNotSir: 101765125000, Execution: 101765125000},
+				FunctionCallCost:        Fee{SendSir: 102217625000, SendNotSir: 102217625000, Execution: 102217625000},
+				FunctionCallCostPerByte: Fee{SendSir: 1925331, SendNotSir: 1925331, Execution: 1925331},
+			},
+			DeleteKeyCost:     Fee{SendSir: 94946625000, SendNotSir: 94946625000, Execution: 94946625000},
+			DeleteAccountCost: Fee{SendSir: 147489000000, SendNotSir: 147489000000, Execution: 147489000000},
+		},
+	}
+}
+
+//TransactionGas 交易gas消耗
+//burnt: 签名时立即燃烧的发送费用，exec: 执行收据的费用，prepaid: 合约调用附带的gas（未用完部分会退回）
+func (c *RuntimeFeesConfig) TransactionGas(signerID, receiverID string, actions []neartransaction.Action, implicitAccountCreation bool) (burnt, exec, prepaid uint64) {
+	sir := signerID == receiverID
+	cfg := c.ActionCreationConfig
+
+	burnt = c.ActionReceiptCreationConfig.SendFee(sir)
+	exec = c.ActionReceiptCreationConfig.ExecFee()
+
+	add := func(fee Fee, times uint64) {
+		burnt += fee.SendFee(sir) * times
+		exec += fee.ExecFee() * times
+	}
+
+	for _, action := range actions {
+		switch {
+		case action.CreateAccount != nil:
+			add(cfg.CreateAccountCost, 1)
+		case action.DeployContract != nil:
+			add(cfg.DeployContractCost, 1)
+			add(cfg.DeployContractCostPerByte, uint64(len(action.DeployContract.Code)))
+		case action.FunctionCall != nil:
+			add(cfg.FunctionCallCost, 1)
+			add(cfg.FunctionCallCostPerByte, uint64(len(action.FunctionCall.MethodName)+len(action.FunctionCall.Args)))
+			prepaid += action.FunctionCall.Gas
+		case action.Transfer != nil:
+			add(cfg.TransferCost, 1)
+			//向不存在的隐式账户转账会同时创建账户和添加完全访问密钥
+			if implicitAccountCreation {
+				add(cfg.CreateAccountCost, 1)
+				add(cfg.AddKeyCost.FullAccessCost, 1)
+			}
+		case action.Stake != nil:
+			add(cfg.StakeCost, 1)
+		case action.AddKey != nil:
+			permission := action.AddKey.AccessKey.Permission
+			if permission == nil {
+				add(cfg.AddKeyCost.FullAccessCost, 1)
+			} else {
+				numBytes := uint64(0)
+				for _, name := range permission.MethodNames {
+					numBytes += uint64(len(name)) + 1
+				}
+				add(cfg.AddKeyCost.FunctionCallCost, 1)
+				add(cfg.AddKeyCost.FunctionCallCostPerByte, numBytes)
+			}
+		case action.DeleteKey != nil:
+			add(cfg.DeleteKeyCost, 1)
+		case action.DeleteAccount != nil:
+			add(cfg.DeleteAccountCost, 1)
+		}
+	}
+	return burnt, exec, prepaid
+}
+
+//IsImplicitAccount 是否隐式账户（64位小写十六进制）
+func IsImplicitAccount(accountID string) bool {
+	return implicitAccountRegexp.MatchString(accountID)
+}
+
+//FeeEstimator 手续费估算器
+type FeeEstimator struct {
+	wm        *WalletManager
+	mu        sync.Mutex
+	config    *RuntimeFeesConfig
+	updatedAt time.Time
+}
+
+//NewFeeEstimator 手续费估算器
+func NewFeeEstimator(wm *WalletManager) *FeeEstimator {
+	fe := FeeEstimator{}
+	fe.wm = wm
+	return &fe
+}
+
+//GetRuntimeFeesConfig 获取运行时费用配置，节点查询失败时使用默认配置
+func (fe *FeeEstimator) GetRuntimeFeesConfig() *RuntimeFeesConfig {
+	return fe.GetRuntimeFeesConfigContext(context.Background())
+}
+
+//GetRuntimeFeesConfigContext 获取运行时费用配置，查询被取消时同样使用缓存或默认配置
+func (fe *FeeEstimator) GetRuntimeFeesConfigContext(ctx context.Context) *RuntimeFeesConfig {
+	fe.mu.Lock()
+	defer fe.mu.Unlock()
+
+	if fe.config != nil && time.Since(fe.updatedAt) < runtimeConfigCacheTime {
+		return fe.config
+	}
+
+	config, err := fe.queryRuntimeFeesConfig(ctx)
+	if err != nil {
+		fe.wm.Logger.Warn("query runtime fees config failed, use default config", F("error", err))
+		if fe.config != nil {
+			return fe.config
+		}
+		return DefaultRuntimeFeesConfig()
+	}
+
+	fe.config = config
+	fe.updatedAt = time.Now()
+	return fe.config
+}
+
+//queryRuntimeFeesConfig 通过 EXPERIMENTAL_protocol_config 获取费用配置
+func (fe *FeeEstimator) queryRuntimeFeesConfig(ctx context.Context) (*RuntimeFeesConfig, error) {
+	param := map[string]interface{}{"finality": "final"}
+	result, err := fe.wm.client.Call2Context(ctx, "EXPERIMENTAL_protocol_config", param)
+	if err != nil {
+		return nil, err
+	}
+	config := RuntimeFeesConfig{}
+	err = json.Unmarshal([]byte(result.Get("runtime_config.transaction_costs").Raw), &config)
+	if err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+//NeedCreateImplicitAccount 转账目标为未创建的隐式账户
+func (fe *FeeEstimator) NeedCreateImplicitAccount(receiverID string) bool {
+	return fe.NeedCreateImplicitAccountContext(context.Background(), receiverID)
+}
+
+//NeedCreateImplicitAccountContext 转账目标为未创建的隐式账户，查询失败时按需要创建估算，避免手续费估低
+func (fe *FeeEstimator) NeedCreateImplicitAccountContext(ctx context.Context, receiverID string) bool {
+	if !IsImplicitAccount(receiverID) {
+		return false
+	}
+	_, err := fe.wm.Blockscanner.GetAccountBalanceContext(ctx, receiverID)
+	return err != nil
+}
+
+//EstimateGas 估算交易总gas，包含合约调用附带的gas
+func (fe *FeeEstimator) EstimateGas(signerID, receiverID string, actions []neartransaction.Action) uint64 {
+	return fe.EstimateGasContext(context.Background(), signerID, receiverID, actions)
+}
+
+//EstimateGasContext 估算交易总gas，包含合约调用附带的gas
+func (fe *FeeEstimator) EstimateGasContext(ctx context.Context, signerID, receiverID string, actions []neartransaction.Action) uint64 {
+	implicitAccountCreation := false
+	for _, action := range actions {
+		if action.Transfer != nil {
+			implicitAccountCreation = fe.NeedCreateImplicitAccountContext(ctx, receiverID)
+			break
+		}
+	}
+	burnt, exec, prepaid := fe.GetRuntimeFeesConfigContext(ctx).TransactionGas(signerID, receiverID, actions, implicitAccountCreation)
+	return burnt + exec + prepaid
+}
+
+//EstimateFee 估算交易手续费，单位NEAR
+func (fe *FeeEstimator) EstimateFee(signerID, receiverID string, actions []neartransaction.Action) (decimal.Decimal, error) {
+	return fe.EstimateFeeContext(context.Background(), signerID, receiverID, actions)
+}
+
+//EstimateFeeContext 估算交易手续费，单位NEAR
+func (fe *FeeEstimator) EstimateFeeContext(ctx context.Context, signerID, receiverID string, actions []neartransaction.Action) (decimal.Decimal, error) {
+	gasPriceStr, err := fe.wm.Blockscanner.GetGasPriceContext(ctx)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	gasPrice, err := decimal.NewFromString(gasPriceStr)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	gas := fe.EstimateGasContext(ctx, signerID, receiverID, actions)
+	return GasToNear(gas, gasPrice), nil
+}
+
+//GasToNear gas数量乘以gas价格，转换为NEAR
+func GasToNear(gas uint64, gasPrice decimal.Decimal) decimal.Decimal {
+	return decimal.New(int64(gas), 0).Mul(gasPrice).Div(decimal.New(1, Decimal))
+}
@@ -0,0 +1,108 @@
+package near
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/Assetsadapter/near-adapter/neartransaction"
+	"github.com/shopspring/decimal"
+)
+
+func TestRuntimeFeesConfig_TransactionGas(t *testing.T) {
+	config := DefaultRuntimeFeesConfig()
+	transfer := []neartransaction.Action{neartransaction.NewTransferAction(big.NewInt(1))}
+
+	burnt, exec, prepaid := config.TransactionGas("a.near", "b.near", transfer, false)
+	if burnt != 223182562500 || exec != 223182562500 || prepaid != 0 {
+		t.Errorf("unexpected transfer gas: burnt=%d exec=%d prepaid=%d", burnt, exec, prepaid)
+	}
+
+	//隐式账户创建
+	burnt, exec, _ = config.TransactionGas("a.near", "b.near", transfer, true)
+	if burnt != 223182562500+99607375000+101765125000 || exec != burnt {
+		t.Errorf("unexpected implicit account gas: burnt=%d exec=%d", burnt, exec)
+	}
+
+	functionCall := []neartransaction.Action{
+		neartransaction.NewFunctionCallAction("ft_transfer", []byte(`{"amount":"1"}`), 30000000000000, big.NewInt(1)),
+	}
+	burnt, _, prepaid = config.TransactionGas("a.near", "b.near", functionCall, false)
+	if burnt != 108059500000+2319861500000+2235934*25 || prepaid != 30000000000000 {
+		t.Errorf("unexpected function call gas: burnt=%d prepaid=%d", burnt, prepaid)
+	}
+}
+
+func TestRuntimeFeesConfig_Unmarshal(t *testing.T) {
+	configJson := `{
+    "action_receipt_creation_config": {"send_sir": 108059500000, "send_not_sir": 108059500000, "execution": 108059500000},
+    "action_creation_config": {
+      "transfer_cost": {"send_sir": 115123062500, "send_not_sir": 115123062500, "execution": 115123062500},
+      "add_key_cost": {
+        "full_access_cost": {"send_sir": 101765125000, "send_not_sir": 101765125000, "execution": 101765125000}
+      }
+    }
+  }`
+	config := RuntimeFeesConfig{}
+	if err := json.Unmarshal([]byte(configJson), &config); err != nil {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+	if config.ActionCreationConfig.TransferCost.SendFee(false) != 115123062500 {
+		t.Errorf("unexpected transfer cost: %+v", config.ActionCreationConfig.TransferCost)
+	}
+	if config.ActionCreationConfig.AddKeyCost.FullAccessCost.ExecFee() != 101765125000 {
+		t.Errorf("unexpected add key cost: %+v", config.ActionCreationConfig.AddKeyCost)
+	}
+}
+
+func TestGasToNear(t *testing.T) {
+	fee := GasToNear(446365125000, decimal.New(100000000, 0))
+	if fee.String() != "0.0000446365125" {
+		t.Errorf("unexpected fee: %s", fee.String())
+	}
+}
+
+func TestTransactionDecoder_EstimateTransferFeeSir(t *testing.T) {
+	wm := NewWalletManager()
+	config := DefaultRuntimeFeesConfig()
+	config.ActionReceiptCreationConfig.SendSir = 1
+	config.ActionCreationConfig.TransferCost.SendSir = 1
+	wm.FeeEstimator.config = config
+	wm.FeeEstimator.updatedAt = time.Now()
+	decoder := NewTransactionDecoder(wm)
+	gasPrice := decimal.New(100000000, 0)
+
+	//签名者与接收者相同时按sir费用计算
+	self := decoder.estimateTransferFee(context.Background(), "a.near", "a.near", "1", gasPrice)
+	if self.String() != GasToNear(1+1+108059500000+115123062500, gasPrice).String() {
+		t.Errorf("unexpected self transfer fee: %s", self)
+	}
+	other := decoder.estimateTransferFees(context.Background(), "a.near", map[string]string{"b.near": "1", "c.near": "1"}, gasPrice)
+	if other.String() != GasToNear(2*2*223182562500, gasPrice).String() {
+		t.Errorf("unexpected transfer fees: %s", other)
+	}
+}
+
+func TestFeeEstimator_NeedCreateImplicitAccount(t *testing.T) {
+	implicit := "c1a8d5c6ad2b3ff8a0e10d0f8a5d6c0c1e6d6a2f0f8a0e10d0f8a5d6c0c1e6d6"
+	node := newTestNode(map[string]string{"query/view_account": `{"amount":"1000000000000000000000000","locked":"0"}`})
+	wm, clean := testWalletManager(t, node)
+	defer clean()
+
+	if wm.FeeEstimator.NeedCreateImplicitAccount(implicit) || wm.FeeEstimator.NeedCreateImplicitAccount("b.near") {
+		t.Errorf("existing or named account should not be created")
+	}
+	node.Set("query/view_account", "error:account "+implicit+" does not exist while viewing")
+	if !wm.FeeEstimator.NeedCreateImplicitAccount(implicit) {
+		t.Errorf("missing implicit account should be created")
+	}
+
+	//查询失败时按创建账户估算，手续费不能估低
+	node.Set("query/view_account", "error:server error")
+	if !wm.FeeEstimator.NeedCreateImplicitAccount(implicit) {
+		t.Errorf("query failure should assume account creation")
+	}
+}
@@ -0,0 +1,197 @@
+package near
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Assetsadapter/near-adapter/neartransaction"
+)
+
+//testNodeHandler 动态生成模拟节点的结果，返回错误时节点返回RPC错误
+type testNodeHandler func(ctx context.Context, params json.RawMessage) (string, error)
+
+//testNode 可配置的模拟NEAR节点，请求按名称返回结果：
+//GET请求为路径，例如 /status；query为 query/<request_type>；合约只读方法为 call/<method_name>，结果为json，节点转为字节数组；
+//其他请求为RPC方法名。名称不存在或结果以error:开头时返回RPC错误。
+//Handle设置的处理函数优先于结果，名称为*的处理函数处理没有结果的所有请求。
+type testNode struct {
+	*httptest.Server
+	mu        sync.Mutex
+	results   map[string]string
+	handlers  map[string]testNodeHandler
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newTestNode(results map[string]string) *testNode {
+	node := testNode{}
+	node.results = make(map[string]string)
+	node.handlers = make(map[string]testNodeHandler)
+	node.closed = make(chan struct{})
+	for name, result := range results {
+		node.results[name] = result
+	}
+	node.Server = httptest.NewServer(http.HandlerFunc(node.serve))
+	return &node
+}
+
+//Set 设置请求的结果
+func (node *testNode) Set(name, result string) {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+	node.results[name] = result
+}
+
+//Handle 设置请求的处理函数
+func (node *testNode) Handle(name string, handler testNodeHandler) {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+	node.handlers[name] = handler
+}
+
+//Wait 处理函数中挂起请求，直到客户端取消或节点关闭
+func (node *testNode) Wait(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+	case <-node.closed:
+	}
+}
+
+//Hang 请求一直挂起直到客户端取消或节点关闭
+func (node *testNode) Hang(name string) {
+	node.Handle(name, func(ctx context.Context, params json.RawMessage) (string, error) {
+		node.Wait(ctx)
+		return "", errors.New("canceled")
+	})
+}
+
+//HandleBroadcast 广播的交易成功执行，返回值为value
+func (node *testNode) HandleBroadcast(value string) {
+	node.Handle("broadcast_tx_commit", func(ctx context.Context, params json.RawMessage) (string, error) {
+		var args []string
+		json.Unmarshal(params, &args)
+		if len(args) == 0 {
+			return "", errors.New("missing transaction")
+		}
+		raw, _ := base64.StdEncoding.DecodeString(args[0])
+		nearTx, err := neartransaction.Deserialize(raw)
+		if err != nil {
+			return "", err
+		}
+		txID, _ := nearTx.Hash()
+		successValue := base64.StdEncoding.EncodeToString([]byte(value))
+		return fmt.Sprintf(`{"status":{"SuccessValue":"%s"},"transaction":{"hash":"%s","signer_id":"%s","receiver_id":"%s","nonce":%d},`+
+			`"transaction_outcome":{"id":"%s","outcome":{"gas_burnt":1,"tokens_burnt":"100","receipt_ids":[],"status":{"SuccessValue":"%s"}}},"receipts_outcome":[]}`,
+			successValue, txID, nearTx.SignerID, nearTx.ReceiverID, nearTx.Nonce, txID, successValue), nil
+	})
+}
+
+//Close 释放挂起的请求并关闭节点，可重复调用
+func (node *testNode) Close() {
+	node.closeOnce.Do(func() {
+		close(node.closed)
+		node.Server.Close()
+	})
+}
+
+func (node *testNode) serve(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Path
+	params := json.RawMessage(nil)
+	if r.Method != http.MethodGet {
+		body := struct {
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}{}
+		json.NewDecoder(r.Body).Decode(&body)
+		name, params = testNodeRequestName(body.Method, body.Params), body.Params
+	}
+
+	node.mu.Lock()
+	handler, hasHandler := node.handlers[name]
+	result, exist := node.results[name]
+	if !hasHandler && !exist {
+		handler, hasHandler = node.handlers["*"]
+	}
+	node.mu.Unlock()
+
+	var err error
+	if hasHandler {
+		result, err = handler(r.Context(), params)
+	} else if !exist {
+		err = errors.New("unknown method")
+	} else if strings.HasPrefix(result, "error:") {
+		err = errors.New(strings.TrimPrefix(result, "error:"))
+	}
+	if err == nil && strings.HasPrefix(name, "call/") {
+		//call_function的结果为json的字节数组
+		ints := make([]string, 0, len(result))
+		for _, b := range []byte(result) {
+			ints = append(ints, fmt.Sprint(b))
+		}
+		result = `{"result":[` + strings.Join(ints, ",") + `],"logs":[],"block_height":1}`
+	}
+
+	if r.Method == http.MethodGet {
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(result))
+		return
+	}
+	if err != nil {
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"` + err.Error() + `"}}`))
+		return
+	}
+	w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":` + result + `}`))
+}
+
+//testNodeRequestName 请求在模拟节点中的名称
+func testNodeRequestName(method string, params json.RawMessage) string {
+	if method != "query" {
+		return method
+	}
+	query := struct {
+		RequestType string `json:"request_type"`
+		MethodName  string `json:"method_name"`
+	}{}
+	json.Unmarshal(params, &query)
+	if query.RequestType == "call_function" {
+		return "call/" + query.MethodName
+	}
+	return method + "/" + query.RequestType
+}
+
+//testWalletManager 连接模拟节点的钱包管理者，本地数据库都在临时目录，node为nil时不连接节点。
+//清理函数关闭节点并删除临时目录。
+func testWalletManager(t *testing.T, node *testNode) (*WalletManager, func()) {
+	dir, err := ioutil.TempDir("", "near-test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wm := NewWalletManager()
+	if node != nil {
+		wm.client = &Client{BaseURL: node.URL}
+	}
+	wm.NonceManager.dbFile = filepath.Join(dir, nonceDBFile)
+	wm.Blockscanner.Outbox.dbFile = filepath.Join(dir, outboxDBFile)
+	wm.Blockscanner.UnscanRetry.dbFile = filepath.Join(dir, unscanRetryDBFile)
+	wm.Blockscanner.BlockchainDAI = NewBlockchainStore(filepath.Join(dir, wm.Config.BlockchainFile))
+	return wm, func() {
+		if node != nil {
+			node.Close()
+		}
+		os.RemoveAll(dir)
+	}
+}
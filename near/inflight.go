@@ -0,0 +1,51 @@
+package near
+
+import (
+	"sync"
+	"time"
+)
+
+//inflightWork 进行中的工作计数，可限时等待全部完成
+type inflightWork struct {
+	mu    sync.Mutex
+	count int
+	idle  chan struct{}
+}
+
+//Add 开始一项工作
+func (w *inflightWork) Add() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.count == 0 {
+		w.idle = make(chan struct{})
+	}
+	w.count++
+}
+
+//Done 结束一项工作
+func (w *inflightWork) Done() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.count--
+	if w.count == 0 {
+		close(w.idle)
+	}
+}
+
+//Wait 等待进行中的工作全部完成，超时返回false
+func (w *inflightWork) Wait(timeout time.Duration) bool {
+	w.mu.Lock()
+	if w.count == 0 {
+		w.mu.Unlock()
+		return true
+	}
+	idle := w.idle
+	w.mu.Unlock()
+
+	select {
+	case <-idle:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
@@ -0,0 +1,152 @@
+package near
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/asdine/storm"
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+func TestInflightWork_Wait(t *testing.T) {
+	var w inflightWork
+	if !w.Wait(time.Millisecond) {
+		t.Errorf("idle work should not wait")
+	}
+	w.Add()
+	if w.Wait(10 * time.Millisecond) {
+		t.Errorf("wait should time out with in-flight work")
+	}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		w.Done()
+	}()
+	if !w.Wait(time.Second) {
+		t.Errorf("wait should return after work done")
+	}
+}
+
+func TestClient_CallContext(t *testing.T) {
+	node := newTestNode(nil)
+	defer node.Close()
+	node.Hang("*")
+
+	c := &Client{BaseURL: node.URL}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := c.CallContext(ctx, "block", []interface{}{1}); err == nil {
+		t.Errorf("canceled call should fail")
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("call should be interrupted by context, took %v", time.Since(start))
+	}
+}
+
+func TestNearBlockScanner_StopInterruptsRPC(t *testing.T) {
+	node := newTestNode(nil)
+	node.Hang("*")
+	wm, clean := testWalletManager(t, node)
+	defer clean()
+	bs := wm.Blockscanner
+	bs.wm.Config.ShutdownTimeout = 5
+
+	scanned := make(chan error, 1)
+	go func() {
+		scanned <- bs.ScanBlock(100)
+	}()
+	//等待扫描进入RPC请求
+	time.Sleep(100 * time.Millisecond)
+
+	start := time.Now()
+	if err := bs.Stop(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("stop should interrupt in-flight rpc, took %v", time.Since(start))
+	}
+	if err := <-scanned; err == nil {
+		t.Errorf("interrupted scan should fail")
+	}
+
+	//扫描器停止后，非扫描调用不受影响
+	if bs.scanContext().Err() != nil {
+		t.Errorf("new scanning should use a fresh context")
+	}
+}
+
+func TestNearBlockScanner_StopDuringBlockedRPC(t *testing.T) {
+	//最新高度200，按高度查询区块的请求一直挂起
+	node := newTestNode(map[string]string{"/status": `{"sync_info":{"latest_block_height":200}}`})
+	node.Handle("block", func(ctx context.Context, params json.RawMessage) (string, error) {
+		var heights []uint64
+		if json.Unmarshal(params, &heights) != nil || len(heights) == 0 {
+			return "", errors.New("unavailable")
+		}
+		node.Wait(ctx)
+		return "", ctx.Err()
+	})
+	wm, clean := testWalletManager(t, node)
+	defer clean()
+	bs := wm.Blockscanner
+	bs.wm.Config.ShutdownTimeout = 5
+	bs.SaveLocalNewBlock(99, "hash99")
+
+	//扫描任务在获取区块时停止，不记录未扫区块，下次从该区块重新扫描
+	bs.Scanning = true
+	scanned := make(chan struct{})
+	go func() {
+		bs.ScanBlockTask()
+		close(scanned)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	if err := bs.Stop(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	<-scanned
+	if list, _ := bs.GetUnscanRecords(); len(list) != 0 {
+		t.Errorf("canceled scan should not save unscan records: %+v", list)
+	}
+	if height, _, _ := bs.GetLocalNewBlock(); height != 99 {
+		t.Errorf("canceled scan should not save height: %d", height)
+	}
+	if _, err := bs.UnscanRetry.Get(100); err != storm.ErrNotFound {
+		t.Errorf("canceled scan should not consume retries: %v", err)
+	}
+
+	//重扫失败记录时停止，保留未扫记录，不计入重试次数
+	bs.SaveUnscanRecord(openwallet.NewUnscanRecord(100, "", "rpc unavailable", bs.wm.Symbol()))
+	rescanned := make(chan struct{})
+	go func() {
+		bs.RescanFailedRecord()
+		close(rescanned)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	if err := bs.Stop(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	<-rescanned
+	if list, _ := bs.GetUnscanRecords(); len(list) != 1 || list[0].BlockHeight != 100 {
+		t.Errorf("canceled rescan should keep unscan record: %+v", list)
+	}
+	if retry, err := bs.UnscanRetry.Get(100); err != storm.ErrNotFound {
+		t.Errorf("canceled rescan should not consume retries: %+v", retry)
+	}
+}
+
+func TestNearBlockScanner_StopTimeout(t *testing.T) {
+	wm, clean := testWalletManager(t, nil)
+	defer clean()
+	bs := wm.Blockscanner
+	bs.wm.Config.ShutdownTimeout = 0
+
+	//不响应取消的工作
+	_, done := bs.beginWork()
+	defer done()
+	if err := bs.Stop(); err == nil {
+		t.Errorf("stop should report in-flight work after deadline")
+	}
+}
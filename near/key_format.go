@@ -0,0 +1,143 @@
+package near
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Assetsadapter/near-adapter/neartransaction"
+	"github.com/Assetsadapter/near-adapter/txsigner"
+	"github.com/blocktree/go-owcrypt"
+	"github.com/blocktree/openwallet/hdkeystore"
+	"github.com/mr-tron/base58"
+)
+
+//NEAR密钥格式前缀
+const ed25519KeyPrefix = "ed25519:"
+
+//KeyPair NEAR格式的ed25519密钥对，私钥为32字节种子，与near-cli、钱包通用。
+//openwallet HD派生的ed25519私钥是标量而不是种子，NEAR的私钥格式无法表示，只能导出公钥，见DerivedCredential。
+type KeyPair struct {
+	Seed      Secret //32字节种子，格式化输出时脱敏
+	PublicKey []byte
+}
+
+//NewKeyPairFromSeed 由32字节种子创建密钥对
+func NewKeyPairFromSeed(seed []byte) (*KeyPair, error) {
+	if len(seed) != 32 {
+		return nil, fmt.Errorf("invalid ed25519 seed length %d", len(seed))
+	}
+	publicKey, ret := owcrypt.GenPubkey(seed, owcrypt.ECC_CURVE_ED25519_NORMAL)
+	if ret != owcrypt.SUCCESS {
+		return nil, errors.New("invalid ed25519 seed")
+	}
+	kp := KeyPair{}
+	kp.Seed = append(Secret(nil), seed...)
+	kp.PublicKey = publicKey
+	return &kp, nil
+}
+
+//ParseSecretKey 解析 ed25519:<base58(种子+公钥)> 格式的私钥，校验公钥与种子一致
+func ParseSecretKey(secretKey string) (*KeyPair, error) {
+	buf, err := decodePrefixedKey(secretKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) != 64 {
+		return nil, fmt.Errorf("invalid ed25519 secret key length %d", len(buf))
+	}
+	kp, err := NewKeyPairFromSeed(buf[:32])
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(kp.PublicKey, buf[32:]) {
+		return nil, errors.New("secret key public part does not match seed")
+	}
+	return kp, nil
+}
+
+//SecretKey 私钥格式 ed25519:<base58(种子+公钥)>
+func (kp *KeyPair) SecretKey() string {
+	return ed25519KeyPrefix + base58.Encode(append(append([]byte(nil), kp.Seed...), kp.PublicKey...))
+}
+
+//PublicKeyString 公钥格式 ed25519:<base58>
+func (kp *KeyPair) PublicKeyString() string {
+	return neartransaction.FormatPublicKey(kp.PublicKey)
+}
+
+//ImplicitAccountID 密钥对应的隐式账户
+func (kp *KeyPair) ImplicitAccountID() string {
+	return ImplicitAccountID(kp.PublicKey)
+}
+
+//Signer 使用该密钥的本地签名器
+func (kp *KeyPair) Signer() (txsigner.Signer, error) {
+	return txsigner.NewSeedSigner(kp.Seed)
+}
+
+//String 不输出私钥
+func (kp *KeyPair) String() string {
+	return kp.PublicKeyString()
+}
+
+//ParsePublicKey 解析 ed25519:<base58> 格式的公钥，也接受隐式账户的hex公钥
+func ParsePublicKey(publicKey string) ([]byte, error) {
+	if !strings.Contains(publicKey, ":") {
+		if buf, err := hex.DecodeString(publicKey); err == nil && len(buf) == 32 {
+			return buf, nil
+		}
+	}
+	buf, err := decodePrefixedKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) != 32 {
+		return nil, fmt.Errorf("invalid ed25519 public key length %d", len(buf))
+	}
+	return buf, nil
+}
+
+//ImplicitAccountID 隐式账户ID为公钥的小写hex
+func ImplicitAccountID(publicKey []byte) string {
+	return hex.EncodeToString(publicKey)
+}
+
+//DerivedPublicKey HD密钥按路径派生的ed25519公钥，与钱包地址一致，用于与near-cli核对
+func DerivedPublicKey(key *hdkeystore.HDKey, hdPath string) ([]byte, error) {
+	childKey, err := key.DerivedKeyWithPath(hdPath, CurveType)
+	if err != nil {
+		return nil, err
+	}
+	return childKey.GetPublicKeyBytes(), nil
+}
+
+//DerivedCredential HD派生地址的near-cli密钥文件，不含私钥，用于与near-cli核对地址。accountID为空时使用隐式账户
+func DerivedCredential(key *hdkeystore.HDKey, hdPath, accountID string) (*NearCredential, error) {
+	publicKey, err := DerivedPublicKey(key, hdPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(accountID) == 0 {
+		accountID = ImplicitAccountID(publicKey)
+	}
+	return &NearCredential{AccountID: accountID, PublicKey: neartransaction.FormatPublicKey(publicKey)}, nil
+}
+
+//decodePrefixedKey 解析 ed25519:<base58>，没有前缀时按ed25519处理
+func decodePrefixedKey(key string) ([]byte, error) {
+	key = strings.TrimSpace(key)
+	if i := strings.Index(key, ":"); i >= 0 {
+		if key[:i+1] != ed25519KeyPrefix {
+			return nil, fmt.Errorf("unsupported key type %s", key[:i])
+		}
+		key = key[i+1:]
+	}
+	buf, err := base58.Decode(key)
+	if err != nil || len(buf) == 0 {
+		return nil, errors.New("invalid base58 key")
+	}
+	return buf, nil
+}
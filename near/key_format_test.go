@@ -0,0 +1,139 @@
+package near
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/blocktree/go-owcrypt"
+	"github.com/blocktree/openwallet/openwallet"
+	"github.com/mr-tron/base58"
+)
+
+func TestParseSecretKey(t *testing.T) {
+	//RFC 8032 ed25519，种子全为0x07
+	seed := bytes.Repeat([]byte{7}, 32)
+	publicKey := "ea4a6c63e29c520abef5507b132ec5f9954776aebebe7b92421eea691446d22c"
+
+	kp, err := NewKeyPairFromSeed(seed)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if kp.ImplicitAccountID() != publicKey {
+		t.Errorf("unexpected public key: %s", kp.ImplicitAccountID())
+	}
+
+	secretKey := kp.SecretKey()
+	parsed, err := ParseSecretKey(secretKey)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(parsed.Seed, seed) || parsed.PublicKeyString() != kp.PublicKeyString() {
+		t.Errorf("secret key round trip failed")
+	}
+	if strings.Contains(RedactString(secretKey), base58.Encode(append(seed, kp.PublicKey...))) {
+		t.Errorf("secret key format should be redacted in logs")
+	}
+
+	pub, err := ParsePublicKey(kp.PublicKeyString())
+	if err != nil || hex.EncodeToString(pub) != publicKey {
+		t.Errorf("unexpected public key: %x, %v", pub, err)
+	}
+	if pub, err := ParsePublicKey(publicKey); err != nil || hex.EncodeToString(pub) != publicKey {
+		t.Errorf("hex public key should parse: %v", err)
+	}
+
+	//种子签名可被标准ed25519验证
+	signer, err := kp.Signer()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	msg := bytes.Repeat([]byte{1}, 32)
+	sig, err := signer.SignHash(kp.PublicKey, msg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if owcrypt.Verify(kp.PublicKey, nil, 0, msg, uint16(len(msg)), sig, owcrypt.ECC_CURVE_ED25519) != owcrypt.SUCCESS {
+		t.Errorf("signature verify failed")
+	}
+
+	for _, invalid := range []string{
+		"secp256k1:" + base58.Encode(append(seed, kp.PublicKey...)),
+		"ed25519:" + base58.Encode(append(seed, make([]byte, 32)...)),
+		"ed25519:" + base58.Encode(seed),
+		"ed25519:0OIl",
+	} {
+		if _, err := ParseSecretKey(invalid); err == nil {
+			t.Errorf("invalid secret key should fail: %s", invalid)
+		}
+	}
+}
+
+func TestNearCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "near-credentials")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	kp, _ := NewKeyPairFromSeed(bytes.Repeat([]byte{9}, 32))
+	file, err := SaveNearCredential(dir, "mainnet", NewNearCredential("alice.near", kp))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info, err := os.Stat(file); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("credential file should be private: %v", info.Mode())
+	}
+
+	//新版near-cli按 <account>/<public_key>.json 保存，且可能不包含account_id
+	implicit := NewNearCredential("", kp)
+	nestedDir := filepath.Join(dir, "mainnet", "bob.near")
+	os.MkdirAll(nestedDir, 0700)
+	ioutil.WriteFile(filepath.Join(nestedDir, kp.PublicKeyString()+".json"), []byte(`{"public_key":"`+kp.PublicKeyString()+`","private_key":"`+kp.SecretKey()+`"}`), 0600)
+
+	credentials, err := LoadNearCredentials(dir, "mainnet")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(credentials) != 2 || credentials[0].AccountID != "alice.near" || credentials[1].AccountID != "bob.near" {
+		t.Fatalf("unexpected credentials: %v", credentials)
+	}
+	for _, credential := range credentials {
+		loaded, err := credential.KeyPair()
+		if err != nil || !bytes.Equal(loaded.Seed, kp.Seed) {
+			t.Errorf("load key of %s failed: %v", credential.AccountID, err)
+		}
+	}
+	if implicit.AccountID != kp.ImplicitAccountID() {
+		t.Errorf("unexpected implicit account: %s", implicit.AccountID)
+	}
+
+	if _, err := SaveNearCredential(dir, "mainnet", &NearCredential{AccountID: "../x"}); err == nil {
+		t.Errorf("invalid account id should fail")
+	}
+}
+
+func TestNearCredential_MatchAddress(t *testing.T) {
+	key, hdPath, _, publicKey := testSigningKey(t)
+	address := &openwallet.Address{Address: ImplicitAccountID(publicKey), PublicKey: hex.EncodeToString(publicKey), HDPath: hdPath}
+
+	//HD派生的私钥不能导出为near-cli格式，只核对公钥和账户
+	credential, err := DerivedCredential(key, hdPath, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if credential.AccountID != address.Address || len(credential.PrivateKey) > 0 || !credential.MatchAddress(address) {
+		t.Errorf("credential should match wallet address")
+	}
+	credential.AccountID = "other.near"
+	if credential.MatchAddress(address) {
+		t.Errorf("credential of other account should not match")
+	}
+	if _, err := credential.KeyPair(); err == nil {
+		t.Errorf("credential without private key should fail")
+	}
+}
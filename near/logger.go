@@ -0,0 +1,164 @@
+package near
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/blocktree/openwallet/log"
+)
+
+//LogLevel 日志级别
+type LogLevel int
+
+const (
+	LevelDebug LogLevel = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+//String 级别名称
+func (level LogLevel) String() string {
+	switch level {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	default:
+		return "error"
+	}
+}
+
+//ParseLogLevel 解析配置的日志级别，无法识别时返回LevelInfo
+func ParseLogLevel(level string) LogLevel {
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "debug":
+		return LevelDebug
+	case "warn", "warning":
+		return LevelWarn
+	case "error":
+		return LevelError
+	default:
+		return LevelInfo
+	}
+}
+
+//LogField 日志字段，常用字段：height、txid、account、method
+type LogField struct {
+	Key   string
+	Value interface{}
+}
+
+//F 创建日志字段
+func F(key string, value interface{}) LogField {
+	return LogField{Key: key, Value: value}
+}
+
+//LogSink 日志输出目标，收到的消息和字段已脱敏
+type LogSink interface {
+	Write(level LogLevel, msg string, fields []LogField)
+}
+
+//Logger 结构化分级日志，输出前对消息和字段脱敏，不会输出密钥
+type Logger struct {
+	sink   LogSink
+	level  LogLevel
+	fields []LogField
+}
+
+//NewLogger 结构化日志，低于level的日志不输出
+func NewLogger(sink LogSink, level LogLevel) *Logger {
+	l := Logger{}
+	l.sink = sink
+	l.level = level
+	return &l
+}
+
+//SetLevel 设置日志级别
+func (l *Logger) SetLevel(level LogLevel) {
+	l.level = level
+}
+
+//With 附加字段，返回新的日志，原日志不变
+func (l *Logger) With(fields ...LogField) *Logger {
+	if l == nil {
+		return nil
+	}
+	child := *l
+	child.fields = append(append([]LogField(nil), l.fields...), fields...)
+	return &child
+}
+
+//Debug 调试日志
+func (l *Logger) Debug(msg string, fields ...LogField) {
+	l.log(LevelDebug, msg, fields)
+}
+
+//Info 信息日志
+func (l *Logger) Info(msg string, fields ...LogField) {
+	l.log(LevelInfo, msg, fields)
+}
+
+//Warn 警告日志
+func (l *Logger) Warn(msg string, fields ...LogField) {
+	l.log(LevelWarn, msg, fields)
+}
+
+//Error 错误日志
+func (l *Logger) Error(msg string, fields ...LogField) {
+	l.log(LevelError, msg, fields)
+}
+
+func (l *Logger) log(level LogLevel, msg string, fields []LogField) {
+	if l == nil || l.sink == nil || level < l.level {
+		return
+	}
+	all := make([]LogField, 0, len(l.fields)+len(fields))
+	for _, field := range append(append([]LogField(nil), l.fields...), fields...) {
+		all = append(all, RedactField(field))
+	}
+	l.sink.Write(level, RedactString(msg), all)
+}
+
+//FormatLogLine 输出为 msg key=value 格式
+func FormatLogLine(msg string, fields []LogField) string {
+	buf := strings.Builder{}
+	buf.WriteString(msg)
+	for _, field := range fields {
+		value := fmt.Sprintf("%v", field.Value)
+		if strings.ContainsAny(value, " \"=") {
+			value = fmt.Sprintf("%q", value)
+		}
+		buf.WriteString(" ")
+		buf.WriteString(field.Key)
+		buf.WriteString("=")
+		buf.WriteString(value)
+	}
+	return buf.String()
+}
+
+//owLogSink 输出到openwallet日志
+type owLogSink struct {
+	log *log.OWLogger
+}
+
+//NewOWLogSink 以openwallet日志作为输出目标
+func NewOWLogSink(logger *log.OWLogger) LogSink {
+	return &owLogSink{log: logger}
+}
+
+func (s *owLogSink) Write(level LogLevel, msg string, fields []LogField) {
+	line := FormatLogLine(msg, fields)
+	switch level {
+	case LevelDebug:
+		s.log.Std.Debug("%s", line)
+	case LevelInfo:
+		s.log.Std.Info("%s", line)
+	case LevelWarn:
+		s.log.Std.Warning("%s", line)
+	default:
+		s.log.Std.Error("%s", line)
+	}
+}
@@ -0,0 +1,199 @@
+package near
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Assetsadapter/near-adapter/txsigner"
+	"github.com/blocktree/openwallet/hdkeystore"
+	"github.com/blocktree/openwallet/openwallet"
+	"github.com/mr-tron/base58"
+)
+
+//captureSink 记录全部日志输出
+type captureSink struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (s *captureSink) Write(level LogLevel, msg string, fields []LogField) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lines = append(s.lines, level.String()+" "+FormatLogLine(msg, fields))
+}
+
+func (s *captureSink) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return strings.Join(s.lines, "\n")
+}
+
+//testHDKeyWallet 只提供HDKey的钱包
+type testHDKeyWallet struct {
+	openwallet.WalletDAIBase
+	key *hdkeystore.HDKey
+}
+
+func (w *testHDKeyWallet) HDKey(password ...string) (*hdkeystore.HDKey, error) {
+	return w.key, nil
+}
+
+func TestLogger_Redact(t *testing.T) {
+	secret := make([]byte, 64)
+	for i := range secret {
+		secret[i] = byte(i + 1)
+	}
+	secretBase58 := base58.Encode(secret)
+	publicKey := base58.Encode(secret[32:])
+
+	sink := &captureSink{}
+	logger := NewLogger(sink, LevelDebug).With(F("account", "alice.near"))
+	logger.Info("signing with ed25519:"+secretBase58,
+		F("private_key", "abc"),
+		F("seed", []byte{1}),
+		F("key", Secret(secret)),
+		F("raw", secret),
+		F("error", errors.New("bad key "+secretBase58)),
+		F("hex", hex.EncodeToString(secret)),
+		F("publicKey", "ed25519:"+publicKey))
+	logger.Debug("debug")
+
+	//32字节的私钥种子按字段名和类型脱敏，例如openwallet私钥和near-cli凭证
+	seed := secret[:32]
+	seedBase58 := base58.Encode(seed)
+	seedHex := hex.EncodeToString(seed)
+	implicitAccount := hex.EncodeToString(secret[32:])
+	logger.Warn("transaction "+publicKey+" signed by "+implicitAccount,
+		F("seed", seedBase58),
+		F("private_key_hex", seedHex),
+		F("value", Secret(seed)),
+		F("note", "block "+publicKey),
+		F("txid", publicKey),
+		F("account", implicitAccount),
+		F("hash", secretBase58))
+
+	output := sink.String()
+	for _, leak := range []string{secretBase58, hex.EncodeToString(secret), "abc", seedBase58, seedHex} {
+		if strings.Contains(output, leak) {
+			t.Errorf("log leaks secret %s:\n%s", leak, output)
+		}
+	}
+	//32字节的哈希、交易ID和隐式账户保留原文
+	for _, want := range []string{"account=alice.near", "ed25519:" + redacted, `raw="[64 bytes]"`, "publicKey=ed25519:" + publicKey, "debug debug account=alice.near",
+		"transaction " + publicKey + " signed by " + implicitAccount, `note="block ` + publicKey + `"`, "txid=" + publicKey, "account=" + implicitAccount,
+		"seed=" + redacted, "value=" + redacted, "hash=" + redacted} {
+		if !strings.Contains(output, want) {
+			t.Errorf("log missing %s:\n%s", want, output)
+		}
+	}
+
+	sink = &captureSink{}
+	logger = NewLogger(sink, LevelWarn)
+	logger.Info("hidden")
+	logger.Warn("shown")
+	if output := sink.String(); output != "warn shown" {
+		t.Errorf("unexpected output: %s", output)
+	}
+}
+
+//testSignRawTransactionNoSecrets 签名交易单，日志不能包含leaks中的任何一项
+func testSignRawTransactionNoSecrets(t *testing.T, name string, signer txsigner.Signer, wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction, leaks []string) {
+	sink := &captureSink{}
+	wm := NewWalletManager()
+	wm.Logger = NewLogger(sink, LevelDebug)
+	wm.Signer = signer
+	if err := wm.TxDecoder.SignRawTransaction(wrapper, rawTx); err != nil {
+		t.Fatalf("%s: unexpected error: %v", name, err)
+	}
+	if len(rawTx.Signatures["account"][0].Signature) == 0 {
+		t.Errorf("%s: transaction not signed", name)
+	}
+
+	output := sink.String()
+	if len(output) == 0 {
+		t.Fatalf("%s: signer should log", name)
+	}
+	for _, leak := range leaks {
+		if strings.Contains(output, leak) {
+			t.Errorf("%s: signer log leaks %s:\n%s", name, leak, output)
+		}
+	}
+}
+
+//testPrivateKeyEncodings 私钥的各种编码：hex、base58和near格式的种子+公钥
+func testPrivateKeyEncodings(privateKey, publicKey []byte) []string {
+	secret := append(append([]byte(nil), privateKey...), publicKey...)
+	return []string{
+		hex.EncodeToString(privateKey),
+		base58.Encode(privateKey),
+		hex.EncodeToString(secret),
+		base58.Encode(secret),
+	}
+}
+
+func TestTransactionDecoder_SignRawTransactionNoSecrets(t *testing.T) {
+	key, hdPath, privateKey, publicKey := testSigningKey(t)
+	leaks := testPrivateKeyEncodings(privateKey, publicKey)
+
+	testSignRawTransactionNoSecrets(t, "wallet", nil, &testHDKeyWallet{key: key}, testUnsignedRawTx(t, publicKey, hdPath), leaks)
+
+	pkcs11 := txsigner.NewPKCS11Signer(newSoftHSMSession(privateKey))
+	testSignRawTransactionNoSecrets(t, "pkcs11", pkcs11, nil, testUnsignedRawTx(t, publicKey, ""), leaks)
+
+	local, _ := txsigner.NewLocalSigner(privateKey)
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := txsigner.RemoteSignRequest{}
+		json.NewDecoder(r.Body).Decode(&request)
+		hash, _ := hex.DecodeString(request.Hash)
+		sig, err := local.SignHash(publicKey, hash)
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(txsigner.RemoteSignResponse{Error: err.Error()})
+			return
+		}
+		json.NewEncoder(w).Encode(txsigner.RemoteSignResponse{Signature: hex.EncodeToString(sig)})
+	}))
+	defer stub.Close()
+	remote := txsigner.NewRemoteSigner(stub.URL, "secret-token")
+	testSignRawTransactionNoSecrets(t, "remote", remote, nil, testUnsignedRawTx(t, publicKey, ""), append(leaks, "secret-token"))
+
+	//near-cli密钥文件的私钥为种子+公钥
+	dir, err := ioutil.TempDir("", "near-credentials")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	seed, err := hdkeystore.GenerateSeed(32)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	kp, err := NewKeyPairFromSeed(seed)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := SaveNearCredential(dir, "mainnet", NewNearCredential("", kp)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	credentials, err := LoadNearCredentials(dir, "mainnet")
+	if err != nil || len(credentials) != 1 {
+		t.Fatalf("unexpected credentials: %v, %v", credentials, err)
+	}
+	loaded, err := credentials[0].KeyPair()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	credentialSigner, err := loaded.Signer()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	testSignRawTransactionNoSecrets(t, "near-cli", credentialSigner, nil, testUnsignedRawTx(t, kp.PublicKey, ""),
+		append(testPrivateKeyEncodings(seed, kp.PublicKey), kp.SecretKey()))
+}
@@ -1,6 +1,7 @@
 package near
 
 import (
+	"github.com/Assetsadapter/near-adapter/txsigner"
 	"github.com/blocktree/openwallet/log"
 	"github.com/blocktree/openwallet/openwallet"
 )
@@ -13,8 +14,14 @@ type WalletManager struct {
 	DecoderV2       openwallet.AddressDecoderV2     //地址编码器
 	TxDecoder       openwallet.TransactionDecoder   //交易单编码器
 	Log             *log.OWLogger                   //日志工具
+	Logger          *Logger                         //结构化日志，输出前脱敏
 	ContractDecoder openwallet.SmartContractDecoder //智能合约解析器
 	Blockscanner    *NearBlockScanner               //区块扫描器
+	FeeEstimator    *FeeEstimator                   //手续费估算器
+	NonceManager    *NonceManager                   //nonce管理器
+	TxPoller        *TxPoller                       //交易状态轮询器
+	Metrics         *Metrics                        //监控指标
+	Signer          txsigner.Signer                 //交易签名器，为空时使用钱包的HD密钥在本地签名
 	client          *Client                         //algod client
 }
 
@@ -25,7 +32,20 @@ func NewWalletManager() *WalletManager {
 	wm.Decoder = NewAddressDecoder()
 	wm.DecoderV2 = NewAddressDecoderV2(&wm)
 	wm.TxDecoder = NewTransactionDecoder(&wm)
+	wm.FeeEstimator = NewFeeEstimator(&wm)
+	wm.NonceManager = NewNonceManager(&wm)
+	wm.TxPoller = NewTxPoller(&wm)
+	wm.Metrics = NewMetrics(nil)
 	//wm.ContractDecoder = &toeknDecoder{wm: &wm}
 	wm.Log = log.NewOWLogger(wm.Symbol())
+	wm.Logger = NewLogger(NewOWLogSink(wm.Log), ParseLogLevel(wm.Config.LogLevel))
 	return &wm
 }
+
+//SetMetricsRegistry 设置指标注册表，开启监控指标，可在加载配置前后调用
+func (wm *WalletManager) SetMetricsRegistry(registry MetricsRegistry) {
+	wm.Metrics = NewMetrics(registry)
+	if wm.client != nil {
+		wm.client.Metrics = wm.Metrics
+	}
+}
@@ -0,0 +1,109 @@
+package near
+
+import (
+	"time"
+)
+
+//指标名称前缀
+const metricsNamespace = "near_adapter"
+
+//DefaultLatencyBuckets 耗时直方图的默认分桶，秒
+var DefaultLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+//MetricsRegistry 指标注册表，接入Prometheus等监控系统时实现此接口。
+//同名指标重复注册时应返回已注册的指标。
+type MetricsRegistry interface {
+	Counter(name, help string, labels ...string) Counter
+	Gauge(name, help string, labels ...string) Gauge
+	Histogram(name, help string, buckets []float64, labels ...string) Histogram
+}
+
+//Counter 只增不减的计数器，labelValues与注册时的labels一一对应
+type Counter interface {
+	Add(delta float64, labelValues ...string)
+}
+
+//Gauge 可任意设置的数值
+type Gauge interface {
+	Set(value float64, labelValues ...string)
+}
+
+//Histogram 观测值分布，例如请求耗时
+type Histogram interface {
+	Observe(value float64, labelValues ...string)
+}
+
+//Metrics 适配器的全部监控指标
+type Metrics struct {
+	ScannedHeight   Gauge     //已扫描高度
+	ChainHeight     Gauge     //链上最新高度
+	ScanLag         Gauge     //扫描落后的区块数，用于告警
+	BlocksScanned   Counter   //已扫描区块数，rate()即为每秒扫描区块数
+	ExtractFailures Counter   //提取失败的交易数
+	UnscanRecords   Gauge     //未扫记录数
+	NotifyLatency   Histogram //观测者处理提取通知的耗时，label: observer
+	Reorgs          Counter   //检测到的分叉数
+	RPCLatency      Histogram //RPC请求耗时，label: method, endpoint
+	RPCErrors       Counter   //RPC请求错误数，label: method, endpoint
+}
+
+//NewMetrics 在注册表中注册全部指标，registry为nil时不记录指标
+func NewMetrics(registry MetricsRegistry) *Metrics {
+	if registry == nil {
+		registry = nopRegistry{}
+	}
+	m := Metrics{}
+	m.ScannedHeight = registry.Gauge(metricsNamespace+"_scanner_scanned_height", "Block height the scanner has processed.")
+	m.ChainHeight = registry.Gauge(metricsNamespace+"_scanner_chain_height", "Latest block height reported by the node.")
+	m.ScanLag = registry.Gauge(metricsNamespace+"_scanner_lag_blocks", "Blocks between the chain head and the scanned height.")
+	m.BlocksScanned = registry.Counter(metricsNamespace+"_scanner_blocks_scanned_total", "Blocks scanned.")
+	m.ExtractFailures = registry.Counter(metricsNamespace+"_scanner_extract_failures_total", "Transactions that failed to extract or notify.")
+	m.UnscanRecords = registry.Gauge(metricsNamespace+"_scanner_unscan_records", "Unscan records waiting for rescan.")
+	m.NotifyLatency = registry.Histogram(metricsNamespace+"_scanner_notify_duration_seconds", "Observer notify latency.", DefaultLatencyBuckets, "observer")
+	m.Reorgs = registry.Counter(metricsNamespace+"_scanner_reorgs_total", "Chain reorganizations detected.")
+	m.RPCLatency = registry.Histogram(metricsNamespace+"_rpc_request_duration_seconds", "RPC request latency.", DefaultLatencyBuckets, "method", "endpoint")
+	m.RPCErrors = registry.Counter(metricsNamespace+"_rpc_errors_total", "RPC request errors.", "method", "endpoint")
+	return &m
+}
+
+//SetScanProgress 记录已扫描高度、链上高度和扫描落后的区块数
+func (m *Metrics) SetScanProgress(scannedHeight, chainHeight uint64) {
+	m.ScannedHeight.Set(float64(scannedHeight))
+	m.ChainHeight.Set(float64(chainHeight))
+	lag := uint64(0)
+	if chainHeight > scannedHeight {
+		lag = chainHeight - scannedHeight
+	}
+	m.ScanLag.Set(float64(lag))
+}
+
+//ObserveRPC 记录一次RPC请求的耗时和错误
+func (m *Metrics) ObserveRPC(method, endpoint string, start time.Time, err error) {
+	m.RPCLatency.Observe(time.Since(start).Seconds(), method, endpoint)
+	if err != nil {
+		m.RPCErrors.Add(1, method, endpoint)
+	}
+}
+
+//nopRegistry 不记录任何指标
+type nopRegistry struct{}
+
+type nopMetric struct{}
+
+func (nopRegistry) Counter(name, help string, labels ...string) Counter {
+	return nopMetric{}
+}
+
+func (nopRegistry) Gauge(name, help string, labels ...string) Gauge {
+	return nopMetric{}
+}
+
+func (nopRegistry) Histogram(name, help string, buckets []float64, labels ...string) Histogram {
+	return nopMetric{}
+}
+
+func (nopMetric) Add(delta float64, labelValues ...string) {}
+
+func (nopMetric) Set(value float64, labelValues ...string) {}
+
+func (nopMetric) Observe(value float64, labelValues ...string) {}
@@ -0,0 +1,194 @@
+package near
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//SimpleRegistry 内置的指标注册表，以Prometheus文本格式输出，无需引入Prometheus客户端
+type SimpleRegistry struct {
+	mu      sync.Mutex
+	metrics []*simpleMetric
+	byName  map[string]*simpleMetric
+}
+
+//NewSimpleRegistry 内置指标注册表
+func NewSimpleRegistry() *SimpleRegistry {
+	r := SimpleRegistry{}
+	r.byName = make(map[string]*simpleMetric)
+	return &r
+}
+
+type simpleMetric struct {
+	registry *SimpleRegistry
+	name     string
+	help     string
+	kind     string
+	labels   []string
+	buckets  []float64
+	series   map[string]*simpleSeries
+}
+
+type simpleSeries struct {
+	labelValues []string
+	value       float64  //counter、gauge的值
+	counts      []uint64 //histogram各分桶的计数，不累计
+	sum         float64
+	count       uint64
+}
+
+//Counter 注册计数器
+func (r *SimpleRegistry) Counter(name, help string, labels ...string) Counter {
+	return r.register(name, help, "counter", nil, labels)
+}
+
+//Gauge 注册数值
+func (r *SimpleRegistry) Gauge(name, help string, labels ...string) Gauge {
+	return r.register(name, help, "gauge", nil, labels)
+}
+
+//Histogram 注册直方图
+func (r *SimpleRegistry) Histogram(name, help string, buckets []float64, labels ...string) Histogram {
+	return r.register(name, help, "histogram", buckets, labels)
+}
+
+func (r *SimpleRegistry) register(name, help, kind string, buckets []float64, labels []string) *simpleMetric {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if m, exist := r.byName[name]; exist {
+		return m
+	}
+	sortedBuckets := append([]float64(nil), buckets...)
+	sort.Float64s(sortedBuckets)
+	m := &simpleMetric{
+		registry: r,
+		name:     name,
+		help:     help,
+		kind:     kind,
+		labels:   labels,
+		buckets:  sortedBuckets,
+		series:   make(map[string]*simpleSeries),
+	}
+	r.metrics = append(r.metrics, m)
+	r.byName[name] = m
+	return m
+}
+
+//getSeries 调用者需持有注册表的锁
+func (m *simpleMetric) getSeries(labelValues []string) *simpleSeries {
+	values := make([]string, len(m.labels))
+	copy(values, labelValues)
+	key := strings.Join(values, "\xff")
+	s, exist := m.series[key]
+	if !exist {
+		s = &simpleSeries{labelValues: values, counts: make([]uint64, len(m.buckets))}
+		m.series[key] = s
+	}
+	return s
+}
+
+func (m *simpleMetric) Add(delta float64, labelValues ...string) {
+	m.registry.mu.Lock()
+	defer m.registry.mu.Unlock()
+	m.getSeries(labelValues).value += delta
+}
+
+func (m *simpleMetric) Set(value float64, labelValues ...string) {
+	m.registry.mu.Lock()
+	defer m.registry.mu.Unlock()
+	m.getSeries(labelValues).value = value
+}
+
+func (m *simpleMetric) Observe(value float64, labelValues ...string) {
+	m.registry.mu.Lock()
+	defer m.registry.mu.Unlock()
+	s := m.getSeries(labelValues)
+	for i, upper := range m.buckets {
+		if value <= upper {
+			s.counts[i]++
+			break
+		}
+	}
+	s.sum += value
+	s.count++
+}
+
+//WritePrometheus 以Prometheus文本格式输出全部指标
+func (r *SimpleRegistry) WritePrometheus(w io.Writer) error {
+	r.mu.Lock()
+	buf := bytes.Buffer{}
+	for _, m := range r.metrics {
+		m.write(&buf)
+	}
+	r.mu.Unlock()
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+//ServeHTTP 作为/metrics接口供Prometheus抓取
+func (r *SimpleRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	r.WritePrometheus(w)
+}
+
+func (m *simpleMetric) write(buf *bytes.Buffer) {
+	fmt.Fprintf(buf, "# HELP %s %s\n", m.name, m.help)
+	fmt.Fprintf(buf, "# TYPE %s %s\n", m.name, m.kind)
+
+	keys := make([]string, 0, len(m.series))
+	for key := range m.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := m.series[key]
+		if m.kind != "histogram" {
+			fmt.Fprintf(buf, "%s%s %s\n", m.name, formatLabels(m.labels, s.labelValues, ""), formatMetricValue(s.value))
+			continue
+		}
+		cumulative := uint64(0)
+		for i, upper := range m.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(buf, "%s_bucket%s %d\n", m.name, formatLabels(m.labels, s.labelValues, formatMetricValue(upper)), cumulative)
+		}
+		fmt.Fprintf(buf, "%s_bucket%s %d\n", m.name, formatLabels(m.labels, s.labelValues, "+Inf"), s.count)
+		fmt.Fprintf(buf, "%s_sum%s %s\n", m.name, formatLabels(m.labels, s.labelValues, ""), formatMetricValue(s.sum))
+		fmt.Fprintf(buf, "%s_count%s %d\n", m.name, formatLabels(m.labels, s.labelValues, ""), s.count)
+	}
+}
+
+//formatLabels 输出标签，le不为空时追加直方图分桶标签
+func formatLabels(labels, values []string, le string) string {
+	pairs := make([]string, 0, len(labels)+1)
+	for i, label := range labels {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", label, escapeLabelValue(values[i])))
+	}
+	if len(le) > 0 {
+		pairs = append(pairs, fmt.Sprintf("le=\"%s\"", le))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func escapeLabelValue(value string) string {
+	value = strings.Replace(value, `\`, `\\`, -1)
+	value = strings.Replace(value, `"`, `\"`, -1)
+	return strings.Replace(value, "\n", `\n`, -1)
+}
+
+func formatMetricValue(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
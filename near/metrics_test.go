@@ -0,0 +1,101 @@
+package near
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSimpleRegistry_WritePrometheus(t *testing.T) {
+	registry := NewSimpleRegistry()
+	counter := registry.Counter("test_errors_total", "Errors.", "method")
+	counter.Add(1, "block")
+	counter.Add(2, "block")
+	counter.Add(1, `chu"nk`)
+	registry.Gauge("test_height", "Height.").Set(100)
+	histogram := registry.Histogram("test_duration_seconds", "Duration.", []float64{1, 0.1}, "method")
+	histogram.Observe(0.05, "block")
+	histogram.Observe(0.5, "block")
+	histogram.Observe(5, "block")
+
+	//重复注册返回同一个指标
+	registry.Gauge("test_height", "Height.").Set(101)
+
+	buf := bytes.Buffer{}
+	if err := registry.WritePrometheus(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `# HELP test_errors_total Errors.
+# TYPE test_errors_total counter
+test_errors_total{method="block"} 3
+test_errors_total{method="chu\"nk"} 1
+# HELP test_height Height.
+# TYPE test_height gauge
+test_height 101
+# HELP test_duration_seconds Duration.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{method="block",le="0.1"} 1
+test_duration_seconds_bucket{method="block",le="1"} 2
+test_duration_seconds_bucket{method="block",le="+Inf"} 3
+test_duration_seconds_sum{method="block"} 5.55
+test_duration_seconds_count{method="block"} 3
+`
+	if buf.String() != want {
+		t.Errorf("unexpected output:\n%s", buf.String())
+	}
+}
+
+func TestClient_Metrics(t *testing.T) {
+	node := newTestNode(map[string]string{"gas_price": `{"gas_price":"100000000"}`})
+	wm, clean := testWalletManager(t, node)
+	defer clean()
+
+	registry := NewSimpleRegistry()
+	wm.SetMetricsRegistry(registry)
+
+	if _, err := wm.client.Call("gas_price", []interface{}{nil}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := wm.client.Call2("query", map[string]interface{}{}); err == nil {
+		t.Errorf("expected rpc error")
+	}
+
+	buf := bytes.Buffer{}
+	registry.WritePrometheus(&buf)
+	output := buf.String()
+	for _, line := range []string{
+		`near_adapter_rpc_request_duration_seconds_count{method="gas_price",endpoint="` + node.URL + `"} 1`,
+		`near_adapter_rpc_request_duration_seconds_count{method="query",endpoint="` + node.URL + `"} 1`,
+		`near_adapter_rpc_errors_total{method="query",endpoint="` + node.URL + `"} 1`,
+	} {
+		if !strings.Contains(output, line) {
+			t.Errorf("missing metric: %s", line)
+		}
+	}
+	if strings.Contains(output, `near_adapter_rpc_errors_total{method="gas_price"`) {
+		t.Errorf("successful call should not count as error")
+	}
+}
+
+func TestNearBlockScanner_ReportScanProgress(t *testing.T) {
+	registry := NewSimpleRegistry()
+	wm := NewWalletManager()
+	wm.SetMetricsRegistry(registry)
+	wm.Config.ScanLagAlertThreshold = 10
+
+	alerted := false
+	wm.Blockscanner.reportScanProgress(100, 105, &alerted)
+	if alerted {
+		t.Errorf("lag under threshold should not alert")
+	}
+	wm.Blockscanner.reportScanProgress(100, 120, &alerted)
+	if !alerted {
+		t.Errorf("lag over threshold should alert")
+	}
+
+	buf := bytes.Buffer{}
+	registry.WritePrometheus(&buf)
+	if !strings.Contains(buf.String(), "near_adapter_scanner_lag_blocks 20\n") {
+		t.Errorf("unexpected lag metric:\n%s", buf.String())
+	}
+}
@@ -1,6 +1,11 @@
 package near
 
-import "github.com/blocktree/openwallet/openwallet"
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/blocktree/openwallet/openwallet"
+)
 
 // GasPrice Gas Price
 type GasPrice struct {
@@ -71,10 +76,57 @@ type Validator struct {
 
 // TransactionStatus struct
 type TransactionStatus struct {
-	ReceiptsOutcome    []RootOutcome     `json:"receipts_outcome"`
-	Transaction        Transaction       `json:"transaction"`
-	Status             map[string]string `json:"status"`
-	TransactionOutcome RootOutcome       `json:"transaction_outcome"`
+	ReceiptsOutcome    []RootOutcome   `json:"receipts_outcome"`
+	Transaction        Transaction     `json:"transaction"`
+	Status             ExecutionStatus `json:"status"`
+	TransactionOutcome RootOutcome     `json:"transaction_outcome"`
+}
+
+// ExecutionStatus 执行状态，未完成时为字符串 NotStarted/Started，完成后为 SuccessValue/SuccessReceiptId/Failure 对象
+type ExecutionStatus struct {
+	Pending          string          `json:"-"`
+	SuccessValue     *string         `json:"SuccessValue,omitempty"`
+	SuccessReceiptID *string         `json:"SuccessReceiptId,omitempty"`
+	Failure          json.RawMessage `json:"Failure,omitempty"`
+}
+
+// UnmarshalJSON 兼容字符串和对象两种格式
+func (s *ExecutionStatus) UnmarshalJSON(data []byte) error {
+	var pending string
+	if err := json.Unmarshal(data, &pending); err == nil {
+		*s = ExecutionStatus{Pending: pending}
+		return nil
+	}
+	type status ExecutionStatus
+	obj := status{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+	*s = ExecutionStatus(obj)
+	return nil
+}
+
+// IsSuccess 执行成功
+func (s ExecutionStatus) IsSuccess() bool {
+	return s.SuccessValue != nil || s.SuccessReceiptID != nil
+}
+
+// IsFailure 执行失败
+func (s ExecutionStatus) IsFailure() bool {
+	return len(s.Failure) > 0
+}
+
+// FailureReason 解析执行失败原因，未失败返回nil
+func (s ExecutionStatus) FailureReason() (*ExecutionFailure, error) {
+	if !s.IsFailure() {
+		return nil, nil
+	}
+	return ParseExecutionFailure(s.Failure)
+}
+
+// IsFinal 交易最终状态为成功或失败
+func (s ExecutionStatus) IsFinal() bool {
+	return s.SuccessValue != nil || s.IsFailure()
 }
 
 // Transaction struct
@@ -104,11 +156,11 @@ type RootOutcome struct {
 
 // Outcome struct
 type Outcome struct {
-	GasBurnt    int64       `json:"gas_burnt"`
-	TokensBurnt string      `json:"tokens_burnt"`
-	Logs        []string    `json:"logs"`
-	ReceiptIDs  []string    `json:"receipt_ids"`
-	Status      interface{} `json:"status"`
+	GasBurnt    int64           `json:"gas_burnt"`
+	TokensBurnt string          `json:"tokens_burnt"`
+	Logs        []string        `json:"logs"`
+	ReceiptIDs  []string        `json:"receipt_ids"`
+	Status      ExecutionStatus `json:"status"`
 }
 
 // Proof struct
@@ -172,12 +224,17 @@ type BlockHeader struct {
 	RandomValue      string `json:"random_value"`
 	RentPaid         string `json:"rent_paid"`
 	Signature        string `json:"signature"`
-	//Timestamp          string      `json:"timestamp"`
-	TotalSupply string `json:"total_supply"`
+	Timestamp        uint64 `json:"timestamp"` //出块时间，纳秒
+	TotalSupply      string `json:"total_supply"`
 	//ValidatorProposals interface{} `json:"validator_proposals"`
 	ValidatorReward string `json:"validator_reward"`
 }
 
+// Time 出块时间，秒
+func (header *BlockHeader) Time() int64 {
+	return int64(header.Timestamp / uint64(time.Second))
+}
+
 // ChunkResponse struct
 type ChunkResponse struct {
 	Author string      `json:"author"`
@@ -186,12 +243,22 @@ type ChunkResponse struct {
 	Transactions []Transaction `json:"transactions"`
 }
 type TxTransfer struct {
-	From   string
-	To     string
-	TxId   string
-	Value  string
-	Fee    string
-	Status string
+	From      string
+	To        string
+	TxId      string
+	Value     string
+	Fee       string
+	Status    string
+	Reason    string           //执行失败原因
+	FeeOnly   bool             //无转账金额的交易，只提取签名者支付的手续费
+	Actions   []string         //交易动作摘要
+	Transfers []TransferAction //交易中的每个Transfer动作，Value为合计
+}
+
+//TransferAction 交易中的Transfer动作
+type TransferAction struct {
+	Index uint64 //动作在交易中的序号
+	Value string //转账金额，已转换精度
 }
 
 type AccountResponse struct {
@@ -199,7 +266,48 @@ type AccountResponse struct {
 }
 
 type AccessKeyResponse struct {
-	Nonce uint64 `json:"nonce"`
+	Nonce      uint64              `json:"nonce"`
+	Permission AccessKeyPermission `json:"permission"`
+	Error      string              `json:"error"` //部分节点查询不存在的密钥时在result中返回错误
+}
+
+//AccessKeyListResponse view_access_key_list 返回的账户全部访问密钥
+type AccessKeyListResponse struct {
+	Keys []*AccessKeyInfo `json:"keys"`
+}
+
+//AccessKeyInfo 访问密钥及其公钥
+type AccessKeyInfo struct {
+	PublicKey string            `json:"public_key"`
+	AccessKey AccessKeyResponse `json:"access_key"`
+}
+
+//AccessKeyPermission 访问密钥权限，FunctionCall为空时为FullAccess
+type AccessKeyPermission struct {
+	FunctionCall *FunctionCallPermission `json:"FunctionCall,omitempty"`
+}
+
+//UnmarshalJSON 节点返回 "FullAccess" 或 {"FunctionCall":{...}}
+func (p *AccessKeyPermission) UnmarshalJSON(data []byte) error {
+	var fullAccess string
+	if err := json.Unmarshal(data, &fullAccess); err == nil {
+		p.FunctionCall = nil
+		return nil
+	}
+	type permission AccessKeyPermission
+	return json.Unmarshal(data, (*permission)(p))
+}
+
+//IsFullAccess 是否为完全访问密钥
+func (p AccessKeyPermission) IsFullAccess() bool {
+	return p.FunctionCall == nil
+}
+
+//FunctionCallPermission 只能调用指定合约的方法，MethodNames为空时可调用全部方法
+type FunctionCallPermission struct {
+	Allowance   *string  `json:"allowance"`
+	ReceiverID  string   `json:"receiver_id"`
+	MethodNames []string `json:"method_names"`
 }
 
 type ReceiptHeader struct {
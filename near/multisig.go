@@ -0,0 +1,516 @@
+package near
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/Assetsadapter/near-adapter/neartransaction"
+	"github.com/blocktree/openwallet/common"
+	"github.com/blocktree/openwallet/openwallet"
+	"github.com/shopspring/decimal"
+)
+
+//NEAR没有原生多签，多签钱包为部署了多签合约的账户。
+//成员密钥是多签账户上只能调用账户自身的函数调用访问密钥，每个成员用自己的密钥调用合约确认请求，
+//确认数达到num_confirmations时合约执行请求。
+//https://github.com/near/core-contracts/tree/master/multisig
+
+//多签合约方法
+const (
+	MultisigMethodAddRequest           = "add_request"
+	MultisigMethodAddRequestAndConfirm = "add_request_and_confirm"
+	MultisigMethodConfirm              = "confirm"
+	MultisigMethodDeleteRequest        = "delete_request"
+)
+
+//多签请求的动作类型
+const (
+	MultisigActionTransfer     = "Transfer"
+	MultisigActionFunctionCall = "FunctionCall"
+	MultisigActionAddKey       = "AddKey"
+	MultisigActionDeleteKey    = "DeleteKey"
+)
+
+//MultisigGas 调用多签合约附带的gas，最后一个确认在同一调用中执行请求
+const MultisigGas uint64 = 100000000000000
+
+//多签交易单扩展参数
+const (
+	extParamMultisigAccount   = "multisigAccount"   //多签合约账户
+	extParamMultisigMethod    = "multisigMethod"    //调用的合约方法
+	extParamMultisigRequestID = "multisigRequestID" //多签请求ID，add_request广播成功后记录
+)
+
+//MultisigRequest 多签请求，json结构与合约一致
+type MultisigRequest struct {
+	ReceiverID string            `json:"receiver_id"`
+	Actions    []*MultisigAction `json:"actions"`
+}
+
+//MultisigAction 多签请求的动作，数量均为yoctoNEAR
+type MultisigAction struct {
+	Type       string  `json:"type"`
+	Amount     string  `json:"amount,omitempty"`      //Transfer
+	MethodName string  `json:"method_name,omitempty"` //FunctionCall
+	Args       *string `json:"args,omitempty"`        //FunctionCall参数，base64
+	Deposit    string  `json:"deposit,omitempty"`     //FunctionCall
+	Gas        string  `json:"gas,omitempty"`         //FunctionCall
+	PublicKey  string  `json:"public_key,omitempty"`  //AddKey、DeleteKey，ed25519:<base58>
+}
+
+//MultisigRequestInfo 待确认的多签请求
+type MultisigRequestInfo struct {
+	RequestID     uint32           `json:"request_id"`
+	Request       *MultisigRequest `json:"request"`
+	Confirmations []string         `json:"confirmations"` //已确认的成员公钥
+	Required      uint64           `json:"required"`      //执行请求需要的确认数
+}
+
+//NewMultisigTransferRequest 转账请求，amount单位为NEAR
+func NewMultisigTransferRequest(receiverID, amount string) *MultisigRequest {
+	yocto := common.StringNumToBigIntWithExp(amount, Decimal)
+	return &MultisigRequest{
+		ReceiverID: receiverID,
+		Actions:    []*MultisigAction{{Type: MultisigActionTransfer, Amount: yocto.String()}},
+	}
+}
+
+//NewMultisigFunctionCallAction 合约调用动作，deposit单位为yoctoNEAR
+func NewMultisigFunctionCallAction(methodName string, args []byte, deposit *big.Int, gas uint64) *MultisigAction {
+	argsBase64 := base64.StdEncoding.EncodeToString(args)
+	if deposit == nil {
+		deposit = big.NewInt(0)
+	}
+	return &MultisigAction{
+		Type:       MultisigActionFunctionCall,
+		MethodName: methodName,
+		Args:       &argsBase64,
+		Deposit:    deposit.String(),
+		Gas:        strconv.FormatUint(gas, 10),
+	}
+}
+
+//GetMultisigRequestIDs 多签合约中待确认的请求ID
+func (bs *NearBlockScanner) GetMultisigRequestIDs(multisigAccount string) ([]uint32, error) {
+	return bs.GetMultisigRequestIDsContext(context.Background(), multisigAccount)
+}
+
+//GetMultisigRequestIDsContext 多签合约中待确认的请求ID
+func (bs *NearBlockScanner) GetMultisigRequestIDsContext(ctx context.Context, multisigAccount string) ([]uint32, error) {
+	requestIDs := make([]uint32, 0)
+	err := bs.CallViewFunctionContext(ctx, multisigAccount, "list_request_ids", nil, &requestIDs)
+	if err != nil {
+		return nil, err
+	}
+	return requestIDs, nil
+}
+
+//GetMultisigRequest 查询多签请求
+func (bs *NearBlockScanner) GetMultisigRequest(multisigAccount string, requestID uint32) (*MultisigRequest, error) {
+	return bs.GetMultisigRequestContext(context.Background(), multisigAccount, requestID)
+}
+
+//GetMultisigRequestContext 查询多签请求
+func (bs *NearBlockScanner) GetMultisigRequestContext(ctx context.Context, multisigAccount string, requestID uint32) (*MultisigRequest, error) {
+	request := MultisigRequest{}
+	err := bs.CallViewFunctionContext(ctx, multisigAccount, "get_request", map[string]interface{}{"request_id": requestID}, &request)
+	if err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+//GetMultisigConfirmations 查询已确认请求的成员公钥
+func (bs *NearBlockScanner) GetMultisigConfirmations(multisigAccount string, requestID uint32) ([]string, error) {
+	return bs.GetMultisigConfirmationsContext(context.Background(), multisigAccount, requestID)
+}
+
+//GetMultisigConfirmationsContext 查询已确认请求的成员公钥
+func (bs *NearBlockScanner) GetMultisigConfirmationsContext(ctx context.Context, multisigAccount string, requestID uint32) ([]string, error) {
+	confirmations := make([]string, 0)
+	err := bs.CallViewFunctionContext(ctx, multisigAccount, "get_confirmations", map[string]interface{}{"request_id": requestID}, &confirmations)
+	if err != nil {
+		return nil, err
+	}
+	return confirmations, nil
+}
+
+//GetMultisigNumConfirmations 执行请求需要的确认数
+func (bs *NearBlockScanner) GetMultisigNumConfirmations(multisigAccount string) (uint64, error) {
+	return bs.GetMultisigNumConfirmationsContext(context.Background(), multisigAccount)
+}
+
+//GetMultisigNumConfirmationsContext 执行请求需要的确认数
+func (bs *NearBlockScanner) GetMultisigNumConfirmationsContext(ctx context.Context, multisigAccount string) (uint64, error) {
+	var num uint64
+	err := bs.CallViewFunctionContext(ctx, multisigAccount, "get_num_confirmations", nil, &num)
+	if err != nil {
+		return 0, err
+	}
+	return num, nil
+}
+
+//GetMultisigMemberKeysContext 多签成员的公钥，即只能调用账户自身且不限方法或包含confirm的函数调用访问密钥
+func (bs *NearBlockScanner) GetMultisigMemberKeysContext(ctx context.Context, multisigAccount string) ([]string, error) {
+	keys, err := bs.GetAccessKeyListContext(ctx, multisigAccount)
+	if err != nil {
+		return nil, err
+	}
+	members := make([]string, 0, len(keys))
+	for _, key := range keys {
+		permission := key.AccessKey.Permission.FunctionCall
+		if permission == nil || permission.ReceiverID != multisigAccount || !containsMethod(permission.MethodNames, MultisigMethodConfirm) {
+			continue
+		}
+		members = append(members, key.PublicKey)
+	}
+	return members, nil
+}
+
+//ListMultisigRequests 多签合约中全部待确认的请求及其确认情况
+func (bs *NearBlockScanner) ListMultisigRequests(multisigAccount string) ([]*MultisigRequestInfo, error) {
+	return bs.ListMultisigRequestsContext(context.Background(), multisigAccount)
+}
+
+//ListMultisigRequestsContext 多签合约中全部待确认的请求及其确认情况
+func (bs *NearBlockScanner) ListMultisigRequestsContext(ctx context.Context, multisigAccount string) ([]*MultisigRequestInfo, error) {
+	requestIDs, err := bs.GetMultisigRequestIDsContext(ctx, multisigAccount)
+	if err != nil {
+		return nil, err
+	}
+	required, err := bs.GetMultisigNumConfirmationsContext(ctx, multisigAccount)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]*MultisigRequestInfo, 0, len(requestIDs))
+	for _, requestID := range requestIDs {
+		request, err := bs.GetMultisigRequestContext(ctx, multisigAccount, requestID)
+		if err != nil {
+			return nil, err
+		}
+		confirmations, err := bs.GetMultisigConfirmationsContext(ctx, multisigAccount, requestID)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, &MultisigRequestInfo{
+			RequestID:     requestID,
+			Request:       request,
+			Confirmations: confirmations,
+			Required:      required,
+		})
+	}
+	return infos, nil
+}
+
+//CreateMultisigRequest 创建多签请求的交易单，见CreateMultisigRequestContext
+func (decoder *TransactionDecoder) CreateMultisigRequest(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction, request *MultisigRequest, confirm bool) error {
+	return decoder.CreateMultisigRequestContext(context.Background(), wrapper, rawTx, request, confirm)
+}
+
+//CreateMultisigRequestContext 创建多签请求的交易单，rawTx.Account.ContractAddress为多签账户。
+//每个成员密钥一笔交易，任一成员签名即可提交，Required为1。confirm为true时调用add_request_and_confirm，同时计入该成员的确认。
+func (decoder *TransactionDecoder) CreateMultisigRequestContext(ctx context.Context, wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction, request *MultisigRequest, confirm bool) error {
+	if request == nil || len(request.ReceiverID) == 0 || len(request.Actions) == 0 {
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "multisig request is empty")
+	}
+	multisigAccount, err := multisigAccountID(rawTx)
+	if err != nil {
+		return err
+	}
+	members, err := decoder.wm.Blockscanner.GetMultisigMemberKeysContext(ctx, multisigAccount)
+	if err != nil {
+		return err
+	}
+	method := MultisigMethodAddRequest
+	if confirm {
+		method = MultisigMethodAddRequestAndConfirm
+	}
+	err = decoder.createMultisigRawTransaction(ctx, wrapper, rawTx, method, map[string]interface{}{"request": request}, members, 1)
+	if err != nil {
+		return err
+	}
+
+	//请求执行后的转账，备注订单使用
+	txTo := make([]string, 0)
+	for _, action := range request.Actions {
+		if action.Type == MultisigActionTransfer {
+			amount, _ := decimal.NewFromString(action.Amount)
+			txTo = append(txTo, request.ReceiverID+":"+amount.Shift(-Decimal).String())
+		}
+	}
+	rawTx.TxTo = txTo
+	return nil
+}
+
+//CreateMultisigConfirm 确认多签请求的交易单，见CreateMultisigConfirmContext
+func (decoder *TransactionDecoder) CreateMultisigConfirm(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction, requestID uint32) error {
+	return decoder.CreateMultisigConfirmContext(context.Background(), wrapper, rawTx, requestID)
+}
+
+//CreateMultisigConfirmContext 确认多签请求的交易单，每个尚未确认的成员密钥一笔交易。
+//Required为执行请求还需要的确认数，交易单在签名者之间传递，各自签名持有的成员密钥，签名数达到Required后提交。
+func (decoder *TransactionDecoder) CreateMultisigConfirmContext(ctx context.Context, wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction, requestID uint32) error {
+	multisigAccount, err := multisigAccountID(rawTx)
+	if err != nil {
+		return err
+	}
+	if _, err := decoder.wm.Blockscanner.GetMultisigRequestContext(ctx, multisigAccount, requestID); err != nil {
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "multisig request %d not found: %v", requestID, err)
+	}
+	confirmations, err := decoder.wm.Blockscanner.GetMultisigConfirmationsContext(ctx, multisigAccount, requestID)
+	if err != nil {
+		return err
+	}
+	numConfirmations, err := decoder.wm.Blockscanner.GetMultisigNumConfirmationsContext(ctx, multisigAccount)
+	if err != nil {
+		return err
+	}
+	if uint64(len(confirmations)) >= numConfirmations {
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "multisig request %d already has %d confirmations", requestID, len(confirmations))
+	}
+	members, err := decoder.wm.Blockscanner.GetMultisigMemberKeysContext(ctx, multisigAccount)
+	if err != nil {
+		return err
+	}
+	pending := make([]string, 0, len(members))
+	for _, member := range members {
+		if !containsKey(confirmations, member) {
+			pending = append(pending, member)
+		}
+	}
+	required := numConfirmations - uint64(len(confirmations))
+	if uint64(len(pending)) < required {
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "multisig request %d needs %d confirmations, only %d members left", requestID, required, len(pending))
+	}
+	err = decoder.createMultisigRawTransaction(ctx, wrapper, rawTx, MultisigMethodConfirm, map[string]interface{}{"request_id": requestID}, pending, required)
+	if err != nil {
+		return err
+	}
+	return rawTx.SetExtParam(extParamMultisigRequestID, requestID)
+}
+
+//CreateMultisigDeleteRequest 删除多签请求的交易单，见CreateMultisigDeleteRequestContext
+func (decoder *TransactionDecoder) CreateMultisigDeleteRequest(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction, requestID uint32) error {
+	return decoder.CreateMultisigDeleteRequestContext(context.Background(), wrapper, rawTx, requestID)
+}
+
+//CreateMultisigDeleteRequestContext 删除多签请求的交易单，每个成员密钥一笔交易，Required为1。
+//合约只接受请求创建者的密钥，或请求已超过合约的冷却时间。
+func (decoder *TransactionDecoder) CreateMultisigDeleteRequestContext(ctx context.Context, wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction, requestID uint32) error {
+	multisigAccount, err := multisigAccountID(rawTx)
+	if err != nil {
+		return err
+	}
+	if _, err := decoder.wm.Blockscanner.GetMultisigRequestContext(ctx, multisigAccount, requestID); err != nil {
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "multisig request %d not found: %v", requestID, err)
+	}
+	members, err := decoder.wm.Blockscanner.GetMultisigMemberKeysContext(ctx, multisigAccount)
+	if err != nil {
+		return err
+	}
+	err = decoder.createMultisigRawTransaction(ctx, wrapper, rawTx, MultisigMethodDeleteRequest, map[string]interface{}{"request_id": requestID}, members, 1)
+	if err != nil {
+		return err
+	}
+	return rawTx.SetExtParam(extParamMultisigRequestID, requestID)
+}
+
+//createMultisigRawTransaction 每个成员密钥一笔调用多签合约的交易，各自使用成员密钥的nonce。
+//Signatures中每笔交易一个待签名记录，成员密钥属于本钱包时记录钱包地址，否则只记录公钥，由持有密钥的签名者签名。
+func (decoder *TransactionDecoder) createMultisigRawTransaction(
+	ctx context.Context,
+	wrapper openwallet.WalletDAI,
+	rawTx *openwallet.RawTransaction,
+	method string,
+	args interface{},
+	members []string,
+	required uint64,
+) (err error) {
+
+	multisigAccount := rawTx.Account.ContractAddress
+	if len(members) == 0 {
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "multisig account %s has no member keys", multisigAccount)
+	}
+
+	argsJSON, err := json.Marshal(args)
+	if err != nil {
+		return err
+	}
+	gasPrice, err := decoder.getFeeRate(ctx, rawTx.FeeRate)
+	if err != nil {
+		return err
+	}
+	refBlock, err := decoder.wm.Blockscanner.GetLatestRefBlockContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	//本钱包持有的成员密钥
+	walletAddresses := make(map[string]*openwallet.Address)
+	addresses, err := wrapper.GetAddressList(0, -1, "AccountID", rawTx.Account.AccountID)
+	if err != nil {
+		return err
+	}
+	for _, address := range addresses {
+		walletAddresses[strings.ToLower(address.PublicKey)] = address
+	}
+
+	var (
+		nearTxs     = make([]*neartransaction.Transaction, 0, len(members))
+		keySignList = make([]*openwallet.KeySignature, 0, len(members))
+		totalFees   = decimal.Zero
+	)
+	defer func() {
+		if err != nil {
+			decoder.releaseNonces(nearTxs)
+		}
+	}()
+
+	for i, member := range members {
+		var publicKey []byte
+		publicKey, err = ParsePublicKey(member)
+		if err != nil {
+			return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "invalid multisig member key %s: %v", member, err)
+		}
+		var nonce uint64
+		nonce, err = decoder.wm.NonceManager.ReserveContext(ctx, multisigAccount, neartransaction.FormatPublicKey(publicKey), 1, refBlock.Height)
+		if err != nil {
+			return err
+		}
+		var nearTx *neartransaction.Transaction
+		nearTx, err = neartransaction.NewTransactionWithSigner(multisigAccount, publicKey, multisigAccount, refBlock.Hash, nonce,
+			neartransaction.NewFunctionCallAction(method, argsJSON, MultisigGas, big.NewInt(0)))
+		if err != nil {
+			return err
+		}
+		nearTxs = append(nearTxs, nearTx)
+
+		var hash string
+		_, hash, err = nearTx.Serialize()
+		if err != nil {
+			return err
+		}
+
+		address, held := walletAddresses[hex.EncodeToString(publicKey)]
+		if !held {
+			address = &openwallet.Address{Address: multisigAccount, PublicKey: hex.EncodeToString(publicKey), Symbol: decoder.wm.Symbol()}
+		}
+		keySignList = append(keySignList, &openwallet.KeySignature{
+			EccType: decoder.wm.Config.CurveType,
+			Nonce:   strconv.FormatUint(nonce, 10),
+			Address: address,
+			Message: hash,
+		})
+
+		//只有Required笔交易会广播
+		if uint64(i) < required {
+			gas := decoder.wm.FeeEstimator.EstimateGasContext(ctx, nearTx.SignerID, nearTx.ReceiverID, nearTx.Actions)
+			totalFees = totalFees.Add(GasToNear(gas, gasPrice))
+		}
+	}
+
+	rawTx.RawHex, err = encodeRawTransactions(nearTxs)
+	if err != nil {
+		return err
+	}
+	err = decoder.setRefBlock(ctx, rawTx, refBlock)
+	if err != nil {
+		return err
+	}
+	err = setRawTransactionTxIDs(rawTx, nearTxs)
+	if err != nil {
+		return err
+	}
+	err = rawTx.SetExtParam(extParamMultisigAccount, multisigAccount)
+	if err != nil {
+		return err
+	}
+	err = rawTx.SetExtParam(extParamMultisigMethod, method)
+	if err != nil {
+		return err
+	}
+	if rawTx.Signatures == nil {
+		rawTx.Signatures = make(map[string][]*openwallet.KeySignature)
+	}
+	rawTx.Signatures[rawTx.Account.AccountID] = keySignList
+	rawTx.Required = required
+	rawTx.FeeRate = gasPrice.String()
+	rawTx.Fees = totalFees.String()
+	rawTx.IsBuilt = true
+	rawTx.IsCompleted = false
+	rawTx.TxAmount = "0"
+	rawTx.TxFrom = []string{multisigAccount + ":0"}
+	rawTx.TxTo = []string{}
+	return nil
+}
+
+//multisigAccountID 多签账户记录在资产账户的ContractAddress
+func multisigAccountID(rawTx *openwallet.RawTransaction) (string, error) {
+	if rawTx.Account == nil || len(rawTx.Account.ContractAddress) == 0 {
+		return "", openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "account is not a multisig contract account")
+	}
+	return rawTx.Account.ContractAddress, nil
+}
+
+//isMultisigRawTransaction 交易单为多签合约调用，成员各自签名，签名数达到Required即可提交
+func isMultisigRawTransaction(rawTx *openwallet.RawTransaction) bool {
+	return rawTx.GetExtParam().Get(extParamMultisigAccount).Exists()
+}
+
+//containsKey 公钥列表是否包含指定公钥
+func containsKey(keys []string, key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+//countSignedKeys 已签名的成员数
+func countSignedKeys(keySignatures []*openwallet.KeySignature) uint64 {
+	var signed uint64
+	for _, keySignature := range keySignatures {
+		if len(keySignature.Signature) > 0 {
+			signed++
+		}
+	}
+	return signed
+}
+
+//checkMultisigTransaction 多签交易只能由多签账户调用自身的合约方法，不附带转账
+func checkMultisigTransaction(rawTx *openwallet.RawTransaction, signedTx *neartransaction.Transaction) error {
+	ext := rawTx.GetExtParam()
+	multisigAccount := ext.Get(extParamMultisigAccount).String()
+	method := ext.Get(extParamMultisigMethod).String()
+	if signedTx.SignerID != multisigAccount || signedTx.ReceiverID != multisigAccount {
+		return fmt.Errorf("multisig transaction must be signed by and sent to %s", multisigAccount)
+	}
+	if len(signedTx.Actions) != 1 || signedTx.Actions[0].FunctionCall == nil ||
+		signedTx.Actions[0].FunctionCall.MethodName != method || signedTx.Actions[0].Deposit().Sign() != 0 {
+		return fmt.Errorf("multisig transaction must only call %s without deposit", method)
+	}
+	return nil
+}
+
+//parseMultisigRequestID add_request返回的请求ID
+func parseMultisigRequestID(result *TransactionResult) (uint32, bool) {
+	if result == nil || result.Status.SuccessValue == nil {
+		return 0, false
+	}
+	buf, err := base64.StdEncoding.DecodeString(*result.Status.SuccessValue)
+	if err != nil {
+		return 0, false
+	}
+	requestID, err := strconv.ParseUint(strings.TrimSpace(string(buf)), 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint32(requestID), true
+}
@@ -0,0 +1,415 @@
+package near
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/Assetsadapter/near-adapter/neartransaction"
+	"github.com/Assetsadapter/near-adapter/txsigner"
+	"github.com/blocktree/openwallet/openwallet"
+	"github.com/mr-tron/base58"
+	"github.com/shopspring/decimal"
+)
+
+//testMultisigNode 多签账户cold.near的节点，其他请求按名称返回results中的结果。
+//成员密钥i的链上nonce为10*(i+1)，广播的交易执行成功，返回值为5
+func testMultisigNode(memberKeys []string, results map[string]string) *testNode {
+	node := newTestNode(results)
+	keys := []string{`{"public_key":"ed25519:full","access_key":{"nonce":1,"permission":"FullAccess"}}`}
+	for _, key := range memberKeys {
+		keys = append(keys, `{"public_key":"`+key+`","access_key":{"nonce":1,"permission":{"FunctionCall":{"allowance":null,"receiver_id":"cold.near","method_names":[]}}}}`)
+	}
+	node.Set("query/view_access_key_list", `{"keys":[`+strings.Join(keys, ",")+`]}`)
+	node.Handle("query/view_access_key", func(ctx context.Context, params json.RawMessage) (string, error) {
+		query := struct {
+			PublicKey string `json:"public_key"`
+		}{}
+		json.Unmarshal(params, &query)
+		nonce := 1
+		for i, key := range memberKeys {
+			if key == query.PublicKey {
+				nonce = 10 * (i + 1)
+			}
+		}
+		return fmt.Sprintf(`{"nonce":%d,"permission":{"FunctionCall":{"allowance":null,"receiver_id":"cold.near","method_names":["add_request","add_request_and_confirm","confirm","delete_request"]}}}`, nonce), nil
+	})
+	node.HandleBroadcast("5")
+	return node
+}
+
+//testWrappingSigner 包装签名器返回的错误
+type testWrappingSigner struct {
+	txsigner.Signer
+}
+
+func (s *testWrappingSigner) SignHash(publicKey []byte, hash []byte) ([]byte, error) {
+	sig, err := s.Signer.SignHash(publicKey, hash)
+	if err != nil {
+		return nil, fmt.Errorf("wrapped signer: %w", err)
+	}
+	return sig, nil
+}
+
+//testMultisigResults 最新区块100，gas价格1亿，请求3需要2个确认，成员1已确认
+func testMultisigResults(members []string) map[string]string {
+	return map[string]string{
+		"/status":                     `{"sync_info":{"latest_block_height":100}}`,
+		"block":                       `{"header":{"height":100,"hash":"` + base58.Encode(make([]byte, 32)) + `"}}`,
+		"gas_price":                   `{"gas_price":"100000000"}`,
+		"EXPERIMENTAL_genesis_config": `{"transaction_validity_period":100}`,
+		"call/get_request":            `{"receiver_id":"bob.near","actions":[{"type":"Transfer","amount":"1000000000000000000000000"}]}`,
+		"call/get_confirmations":      `["` + members[0] + `"]`,
+		"call/get_num_confirmations":  `2`,
+	}
+}
+
+//checkMultisigCalls 每个成员一笔调用合约的交易，使用成员密钥的下一个nonce
+func checkMultisigCalls(t *testing.T, wm *WalletManager, rawTx *openwallet.RawTransaction, members [][]byte, nonces []uint64, method, args string) {
+	t.Helper()
+	nearTxs, err := decodeRawTransactions(rawTx.RawHex)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(nearTxs) != len(members) {
+		t.Fatalf("unexpected transactions: %d", len(nearTxs))
+	}
+	keySignatures := rawTx.Signatures["account"]
+	for i, nearTx := range nearTxs {
+		if nearTx.SignerID != "cold.near" || nearTx.ReceiverID != "cold.near" || hex.EncodeToString(nearTx.PublicKey) != hex.EncodeToString(members[i]) || nearTx.Nonce != nonces[i] {
+			t.Errorf("unexpected transaction %d: %s -> %s, nonce %d", i, nearTx.SignerID, nearTx.ReceiverID, nearTx.Nonce)
+		}
+		call := nearTx.Actions[0].FunctionCall
+		if len(nearTx.Actions) != 1 || call == nil || call.MethodName != method || string(call.Args) != args || call.Gas != MultisigGas || call.Deposit.Sign() != 0 {
+			t.Errorf("unexpected call %d: %+v", i, call)
+		}
+		if keySignatures[i].Nonce != fmt.Sprint(nonces[i]) || keySignatures[i].Address.PublicKey != hex.EncodeToString(members[i]) {
+			t.Errorf("unexpected key signature %d: %+v", i, keySignatures[i])
+		}
+	}
+	if rawTx.GetExtParam().Get(extParamMultisigMethod).String() != method || rawTx.FeeRate != "100000000" {
+		t.Errorf("unexpected raw transaction: %s, fee rate %s", rawTx.GetExtParam().Get(extParamMultisigMethod).String(), rawTx.FeeRate)
+	}
+
+	//只有Required笔交易广播，手续费按Required笔估算
+	fee := GasToNear(wm.FeeEstimator.EstimateGas("cold.near", "cold.near", nearTxs[0].Actions), decimal.New(100000000, 0))
+	if rawTx.Fees != fee.Mul(decimal.New(int64(rawTx.Required), 0)).String() {
+		t.Errorf("unexpected fees: %s, expected %s x %d", rawTx.Fees, fee.String(), rawTx.Required)
+	}
+}
+
+//testMultisigRawTx 成员确认请求的多签交易单，每个成员一笔交易
+func testMultisigRawTx(t *testing.T, publicKeys [][]byte, required uint64) *openwallet.RawTransaction {
+	nearTxs := make([]*neartransaction.Transaction, 0, len(publicKeys))
+	keySignatures := make([]*openwallet.KeySignature, 0, len(publicKeys))
+	for i, publicKey := range publicKeys {
+		nearTx, err := neartransaction.NewTransactionWithSigner("cold.near", publicKey, "cold.near", base58.Encode(make([]byte, 32)), uint64(10+i),
+			neartransaction.NewFunctionCallAction(MultisigMethodConfirm, []byte(`{"request_id":3}`), MultisigGas, big.NewInt(0)))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_, hash, err := nearTx.Serialize()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		nearTxs = append(nearTxs, nearTx)
+		keySignatures = append(keySignatures, &openwallet.KeySignature{
+			EccType: CurveType,
+			Nonce:   fmt.Sprint(nearTx.Nonce),
+			Address: &openwallet.Address{Address: "cold.near", PublicKey: hex.EncodeToString(publicKey)},
+			Message: hash,
+		})
+	}
+	rawHex, err := encodeRawTransactions(nearTxs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rawTx := &openwallet.RawTransaction{
+		Account:    &openwallet.AssetsAccount{AccountID: "account", ContractAddress: "cold.near"},
+		RawHex:     rawHex,
+		Required:   required,
+		Signatures: map[string][]*openwallet.KeySignature{"account": keySignatures},
+	}
+	rawTx.SetExtParam(extParamMultisigAccount, "cold.near")
+	rawTx.SetExtParam(extParamMultisigMethod, MultisigMethodConfirm)
+	rawTx.SetExtParam(extParamMultisigRequestID, 3)
+	return rawTx
+}
+
+func TestNearBlockScanner_ListMultisigRequests(t *testing.T) {
+	wm, clean := testWalletManager(t, testMultisigNode([]string{"ed25519:a", "ed25519:b"}, map[string]string{
+		"call/list_request_ids":      `[3]`,
+		"call/get_num_confirmations": `2`,
+		"call/get_request":           `{"receiver_id":"bob.near","actions":[{"type":"Transfer","amount":"1000000000000000000000000"}]}`,
+		"call/get_confirmations":     `["ed25519:a"]`,
+	}))
+	defer clean()
+
+	requests, err := wm.Blockscanner.ListMultisigRequests("cold.near")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(requests) != 1 {
+		t.Fatalf("unexpected requests: %v", requests)
+	}
+	request := requests[0]
+	if request.RequestID != 3 || request.Required != 2 || len(request.Confirmations) != 1 || request.Confirmations[0] != "ed25519:a" {
+		t.Errorf("unexpected request: %+v", request)
+	}
+	expected := NewMultisigTransferRequest("bob.near", "1")
+	if request.Request.ReceiverID != expected.ReceiverID || request.Request.Actions[0].Amount != expected.Actions[0].Amount {
+		t.Errorf("unexpected request: %+v", request.Request)
+	}
+
+	//全权限密钥不是多签成员
+	members, err := wm.Blockscanner.GetMultisigMemberKeysContext(context.Background(), "cold.near")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(members) != 2 || members[0] != "ed25519:a" || members[1] != "ed25519:b" {
+		t.Errorf("unexpected members: %v", members)
+	}
+
+	//合约要求FunctionCall的args为base64
+	action, _ := json.Marshal(NewMultisigFunctionCallAction("ft_transfer", []byte(`{}`), nil, 30000000000000))
+	if string(action) != `{"type":"FunctionCall","method_name":"ft_transfer","args":"e30=","deposit":"0","gas":"30000000000000"}` {
+		t.Errorf("unexpected action: %s", action)
+	}
+}
+
+func TestTransactionDecoder_CreateMultisigRequest(t *testing.T) {
+	privateKeys := make([][]byte, 0, 3)
+	publicKeys := make([][]byte, 0, 3)
+	members := make([]string, 0, 3)
+	for i := 0; i < 3; i++ {
+		_, _, privateKey, publicKey := testSigningKey(t)
+		privateKeys = append(privateKeys, privateKey)
+		publicKeys = append(publicKeys, publicKey)
+		members = append(members, neartransaction.FormatPublicKey(publicKey))
+	}
+	wm, clean := testWalletManager(t, testMultisigNode(members, testMultisigResults(members)))
+	defer clean()
+	decoder := NewTransactionDecoder(wm)
+
+	//本钱包持有成员2的密钥
+	wallet := &testAddressWallet{addresses: []*openwallet.Address{{AccountID: "account", Address: "cold.near", PublicKey: hex.EncodeToString(publicKeys[1])}}}
+	rawTx := &openwallet.RawTransaction{Account: &openwallet.AssetsAccount{AccountID: "account", ContractAddress: "cold.near"}}
+	err := decoder.CreateMultisigRequestContext(context.Background(), wallet, rawTx, NewMultisigTransferRequest("bob.near", "1"), true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkMultisigCalls(t, wm, rawTx, publicKeys, []uint64{11, 21, 31}, MultisigMethodAddRequestAndConfirm,
+		`{"request":{"receiver_id":"bob.near","actions":[{"type":"Transfer","amount":"1000000000000000000000000"}]}}`)
+	if rawTx.Required != 1 || len(rawTx.TxTo) != 1 || rawTx.TxTo[0] != "bob.near:1" {
+		t.Errorf("unexpected raw transaction: required %d, to %v", rawTx.Required, rawTx.TxTo)
+	}
+	if keySignatures := rawTx.Signatures["account"]; keySignatures[1].Address.AccountID != "account" || len(keySignatures[0].Address.AccountID) > 0 {
+		t.Errorf("wallet member key should use wallet address")
+	}
+
+	//任一成员签名即可提交，请求ID取自add_request的返回值
+	wm.Signer, _ = txsigner.NewLocalSigner(privateKeys[1])
+	if err := wm.TxDecoder.SignRawTransaction(nil, rawTx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := wm.TxDecoder.VerifyRawTransaction(nil, rawTx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tx, err := decoder.SubmitRawTransactionContext(context.Background(), nil, rawTx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	nearTxs, _ := decodeRawTransactions(rawTx.RawHex)
+	txID, _ := nearTxs[1].Hash()
+	if tx.TxID != txID || rawTx.TxID != txID {
+		t.Errorf("unexpected txid: %s, expected %s", tx.TxID, txID)
+	}
+	if id := rawTx.GetExtParam().Get(extParamMultisigRequestID).Uint(); id != 5 {
+		t.Errorf("unexpected request id of raw transaction: %d", id)
+	}
+	if id := tx.GetExtParam().Get(extParamMultisigRequestID).Uint(); id != 5 {
+		t.Errorf("unexpected request id of transaction: %d", id)
+	}
+
+	//空请求
+	if err := decoder.CreateMultisigRequest(wallet, &openwallet.RawTransaction{Account: rawTx.Account}, &MultisigRequest{ReceiverID: "bob.near"}, false); err == nil {
+		t.Errorf("empty request should fail")
+	}
+	//非多签账户
+	if err := decoder.CreateMultisigRequest(wallet, &openwallet.RawTransaction{Account: &openwallet.AssetsAccount{AccountID: "account"}}, NewMultisigTransferRequest("bob.near", "1"), false); err == nil {
+		t.Errorf("account without multisig contract should fail")
+	}
+}
+
+func TestTransactionDecoder_CreateMultisigConfirmAndDelete(t *testing.T) {
+	publicKeys := make([][]byte, 0, 3)
+	members := make([]string, 0, 3)
+	for i := 0; i < 3; i++ {
+		_, _, _, publicKey := testSigningKey(t)
+		publicKeys = append(publicKeys, publicKey)
+		members = append(members, neartransaction.FormatPublicKey(publicKey))
+	}
+	node := testMultisigNode(members, testMultisigResults(members))
+	wm, clean := testWalletManager(t, node)
+	defer clean()
+	decoder := NewTransactionDecoder(wm)
+	wallet := &testAddressWallet{}
+	account := &openwallet.AssetsAccount{AccountID: "account", ContractAddress: "cold.near"}
+
+	//成员1已确认，只为其余成员创建交易，还需要1个确认
+	rawTx := &openwallet.RawTransaction{Account: account}
+	if err := decoder.CreateMultisigConfirmContext(context.Background(), wallet, rawTx, 3); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkMultisigCalls(t, wm, rawTx, publicKeys[1:], []uint64{21, 31}, MultisigMethodConfirm, `{"request_id":3}`)
+	if rawTx.Required != 1 || rawTx.GetExtParam().Get(extParamMultisigRequestID).Uint() != 3 {
+		t.Errorf("unexpected raw transaction: required %d", rawTx.Required)
+	}
+
+	//预留的nonce不重复使用
+	rawTx = &openwallet.RawTransaction{Account: account}
+	if err := decoder.CreateMultisigDeleteRequestContext(context.Background(), wallet, rawTx, 3); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkMultisigCalls(t, wm, rawTx, publicKeys, []uint64{11, 22, 32}, MultisigMethodDeleteRequest, `{"request_id":3}`)
+	if rawTx.Required != 1 || rawTx.GetExtParam().Get(extParamMultisigRequestID).Uint() != 3 {
+		t.Errorf("unexpected raw transaction: required %d", rawTx.Required)
+	}
+
+	//确认数已达到
+	node.Set("call/get_confirmations", `["`+members[0]+`","`+members[1]+`"]`)
+	if err := decoder.CreateMultisigConfirm(wallet, &openwallet.RawTransaction{Account: account}, 3); err == nil {
+		t.Errorf("confirmed request should fail")
+	}
+	//请求不存在
+	node.Set("call/get_request", "error:unknown request")
+	if err := decoder.CreateMultisigConfirm(wallet, &openwallet.RawTransaction{Account: account}, 3); err == nil {
+		t.Errorf("missing request should fail")
+	}
+	if err := decoder.CreateMultisigDeleteRequest(wallet, &openwallet.RawTransaction{Account: account}, 3); err == nil {
+		t.Errorf("missing request should fail")
+	}
+}
+
+func TestParseMultisigRequestID(t *testing.T) {
+	value := func(s string) *TransactionResult {
+		result := &TransactionResult{}
+		result.Status.SuccessValue = &s
+		return result
+	}
+	if id, ok := parseMultisigRequestID(value(base64.StdEncoding.EncodeToString([]byte("12")))); !ok || id != 12 {
+		t.Errorf("unexpected request id: %d, %v", id, ok)
+	}
+	for _, result := range []*TransactionResult{nil, {}, value("!"), value(""), value(base64.StdEncoding.EncodeToString([]byte(`"x"`)))} {
+		if _, ok := parseMultisigRequestID(result); ok {
+			t.Errorf("invalid result should not have request id: %+v", result)
+		}
+	}
+}
+
+func TestTransactionDecoder_MultisigConfirm(t *testing.T) {
+	privateKeys := make([][]byte, 0, 3)
+	publicKeys := make([][]byte, 0, 3)
+	members := make([]string, 0, 3)
+	for i := 0; i < 3; i++ {
+		_, _, privateKey, publicKey := testSigningKey(t)
+		privateKeys = append(privateKeys, privateKey)
+		publicKeys = append(publicKeys, publicKey)
+		members = append(members, neartransaction.FormatPublicKey(publicKey))
+	}
+	node := testMultisigNode(members, nil)
+	wm, clean := testWalletManager(t, node)
+	defer clean()
+
+	//2/3多签，成员1和成员3分别签名，签名器包装的ErrKeyNotFound同样跳过
+	rawTx := testMultisigRawTx(t, publicKeys, 2)
+	signer, _ := txsigner.NewLocalSigner(privateKeys[0])
+	wm.Signer = &testWrappingSigner{signer}
+	if err := wm.TxDecoder.SignRawTransaction(nil, rawTx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rawTx.IsCompleted {
+		t.Errorf("multisig transaction with one signature should not be completed")
+	}
+	if err := wm.TxDecoder.VerifyRawTransaction(nil, rawTx); err == nil || !strings.Contains(err.Error(), "requires 2 signatures") {
+		t.Errorf("multisig transaction with one signature should fail: %v", err)
+	}
+
+	wm.Signer, _ = txsigner.NewLocalSigner(privateKeys[2])
+	if err := wm.TxDecoder.SignRawTransaction(nil, rawTx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	keySignatures := rawTx.Signatures["account"]
+	if !rawTx.IsCompleted || len(keySignatures[0].Signature) == 0 || len(keySignatures[1].Signature) > 0 || len(keySignatures[2].Signature) == 0 {
+		t.Fatalf("unexpected signatures, completed: %v", rawTx.IsCompleted)
+	}
+	if err := wm.TxDecoder.VerifyRawTransaction(nil, rawTx); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	//只广播Required笔已签名的交易
+	nearTxs, _ := decodeRawTransactions(rawTx.RawHex)
+	selected, unused, err := selectMultisigTransactions(nearTxs, rawTx.Required)
+	if err != nil || len(selected) != 2 || selected[1].Nonce != 12 || len(unused) != 1 || unused[0].Nonce != 11 {
+		t.Errorf("unexpected selected transactions: %v", err)
+	}
+
+	//广播失败时同样释放未选中成员交易的nonce
+	wm.NonceManager.reserve("cold.near", members[1], 1, 10, 0, 0, TxValidityPeriod)
+	node.Handle("broadcast_tx_commit", func(ctx context.Context, params json.RawMessage) (string, error) {
+		return "", errors.New("server error")
+	})
+	if _, err := wm.TxDecoder.SubmitRawTransaction(nil, rawTx); err == nil {
+		t.Errorf("failed broadcast should fail")
+	}
+	if list, _ := wm.NonceManager.GetReservations("cold.near", members[1]); len(list) != 0 {
+		t.Errorf("nonce of unused member transaction should be released: %+v", list)
+	}
+
+	//不持有任何成员密钥的签名者
+	_, _, otherKey, _ := testSigningKey(t)
+	wm.Signer, _ = txsigner.NewLocalSigner(otherKey)
+	if err := wm.TxDecoder.SignRawTransaction(nil, testMultisigRawTx(t, publicKeys, 2)); err == nil {
+		t.Errorf("signer without member keys should fail")
+	}
+
+	//多签交易只能调用多签账户自身
+	tamperRawTx(t, rawTx, func(nearTx *neartransaction.Transaction) {
+		nearTx.ReceiverID = "mallory.near"
+	})
+	if err := wm.TxDecoder.VerifyRawTransaction(nil, rawTx); err == nil {
+		t.Errorf("tampered multisig transaction should fail")
+	}
+}
+
+func TestTransactionDecoder_RebuildMultisigRawTransaction(t *testing.T) {
+	publicKeys := make([][]byte, 0, 3)
+	members := make([]string, 0, 3)
+	for i := 0; i < 3; i++ {
+		_, _, _, publicKey := testSigningKey(t)
+		publicKeys = append(publicKeys, publicKey)
+		members = append(members, neartransaction.FormatPublicKey(publicKey))
+	}
+	wm, clean := testWalletManager(t, testMultisigNode(members, testMultisigResults(members)))
+	defer clean()
+	decoder := NewTransactionDecoder(wm)
+
+	//每个成员交易使用各自密钥的下一个nonce
+	rawTx := testMultisigRawTx(t, publicKeys, 2)
+	if err := decoder.RebuildRawTransactionContext(context.Background(), &testAddressWallet{}, rawTx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkMultisigCalls(t, wm, rawTx, publicKeys, []uint64{11, 21, 31}, MultisigMethodConfirm, `{"request_id":3}`)
+	for i, member := range members {
+		list, _ := wm.NonceManager.GetReservations("cold.near", member)
+		if len(list) != 1 || list[0].Nonce != uint64(10*(i+1)+1) {
+			t.Errorf("unexpected reservations of member %d: %+v", i, list)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package near
 
 import (
+	"time"
+
+	"github.com/Assetsadapter/near-adapter/txsigner"
 	"github.com/astaxie/beego/config"
 	"github.com/blocktree/openwallet/log"
 	"github.com/blocktree/openwallet/openwallet"
@@ -58,10 +61,56 @@ func (wm *WalletManager) LoadAssetsConfig(c config.Configer) error {
 	wm.Config.FixFees = c.String("FixFees")
 	wm.Config.Network = c.String("Network")
 	wm.Config.AddressRetainAmount = c.String("AddressRetainAmount")
+	wm.Config.BroadcastAsync, _ = c.Bool("BroadcastAsync")
+	wm.Config.ExtractAllTransactions, _ = c.Bool("ExtractAllTransactions")
+	if threshold, err := c.Int64("ConfirmationThreshold"); err == nil && threshold > 0 {
+		wm.Config.ConfirmationThreshold = uint64(threshold)
+	}
+	if attempts, err := c.Int("UnscanMaxAttempts"); err == nil && attempts > 0 {
+		wm.Config.UnscanMaxAttempts = attempts
+	}
+	if interval, err := c.Int64("UnscanRetryInterval"); err == nil && interval > 0 {
+		wm.Config.UnscanRetryInterval = interval
+	}
+	if attempts, err := c.Int("NotifyMaxAttempts"); err == nil && attempts > 0 {
+		wm.Config.NotifyMaxAttempts = attempts
+	}
+	if interval, err := c.Int64("NotifyRetryInterval"); err == nil && interval > 0 {
+		wm.Config.NotifyRetryInterval = interval
+	}
+	if concurrency, err := c.Int("ExtractConcurrency"); err == nil && concurrency > 0 {
+		wm.Config.ExtractConcurrency = concurrency
+	}
+	if level := c.String("LogLevel"); len(level) > 0 {
+		wm.Config.LogLevel = level
+		wm.Logger.SetLevel(ParseLogLevel(level))
+	}
+	if threshold, err := c.Int64("ScanLagAlertThreshold"); err == nil && threshold > 0 {
+		wm.Config.ScanLagAlertThreshold = uint64(threshold)
+	}
+	if timeout, err := c.Int64("ShutdownTimeout"); err == nil && timeout > 0 {
+		wm.Config.ShutdownTimeout = timeout
+	}
+	if period, err := c.Int64("TxValidityPeriod"); err == nil && period > 0 {
+		//配置的交易有效期优先于创世配置，不再查询节点
+		wm.Blockscanner.setTxValidityPeriod(uint64(period))
+	}
+	if timeout, err := c.Int64("TxPollTimeout"); err == nil && timeout > 0 {
+		wm.Config.TxPollTimeout = timeout
+		wm.TxPoller.Timeout = time.Duration(timeout) * time.Second
+	}
+
+	wm.Config.RemoteSignerURL = c.String("RemoteSignerURL")
+	wm.Config.RemoteSignerToken = c.String("RemoteSignerToken")
+	if len(wm.Config.RemoteSignerURL) > 0 {
+		wm.Signer = txsigner.NewRemoteSigner(wm.Config.RemoteSignerURL, wm.Config.RemoteSignerToken)
+	}
 
 	//stellar客户端
 	wm.client = &Client{
 		BaseURL: wm.Config.ServerAPI,
+		Metrics: wm.Metrics,
+		Logger:  wm.Logger,
 	}
 
 	return nil
@@ -0,0 +1,169 @@
+package near
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/asdine/storm"
+	"github.com/asdine/storm/q"
+)
+
+const (
+	//nonce预留数据库文件
+	nonceDBFile = "nonce.db"
+)
+
+//NonceReservation 本地预留的nonce，交易广播上链前防止重复使用
+type NonceReservation struct {
+	ID             string `storm:"id"`
+	AccountID      string `storm:"index"`
+	PublicKey      string
+	Nonce          uint64
+	RefBlockHeight uint64 //交易引用的区块高度，超过有效期后预留作废
+	CreateAt       int64
+}
+
+func newNonceReservation(accountID, publicKey string, nonce, refBlockHeight uint64) *NonceReservation {
+	return &NonceReservation{
+		ID:             fmt.Sprintf("%s_%s_%d", accountID, publicKey, nonce),
+		AccountID:      accountID,
+		PublicKey:      publicKey,
+		Nonce:          nonce,
+		RefBlockHeight: refBlockHeight,
+		CreateAt:       time.Now().Unix(),
+	}
+}
+
+//NonceManager 按(账户, 公钥)管理nonce，支持并发创建交易
+type NonceManager struct {
+	wm     *WalletManager
+	mu     sync.Mutex
+	dbFile string
+}
+
+//NewNonceManager nonce管理器
+func NewNonceManager(wm *WalletManager) *NonceManager {
+	nm := NonceManager{}
+	nm.wm = wm
+	nm.dbFile = filepath.Join(wm.Config.dbPath, nonceDBFile)
+	return &nm
+}
+
+//Reserve 预留count个连续的nonce，返回第一个
+func (nm *NonceManager) Reserve(accountID, publicKey string, count int, refBlockHeight uint64) (uint64, error) {
+	return nm.ReserveContext(context.Background(), accountID, publicKey, count, refBlockHeight)
+}
+
+//ReserveContext 预留count个连续的nonce，返回第一个
+func (nm *NonceManager) ReserveContext(ctx context.Context, accountID, publicKey string, count int, refBlockHeight uint64) (uint64, error) {
+	chainNonce, err := nm.wm.Blockscanner.GetAccessKeyNonceContext(ctx, accountID, publicKey)
+	if err != nil {
+		return 0, err
+	}
+	currentHeight, err := nm.wm.Blockscanner.GetCurrentBlockContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	validityPeriod := nm.wm.Blockscanner.GetTxValidityPeriodContext(ctx)
+	return nm.reserve(accountID, publicKey, count, chainNonce, currentHeight, refBlockHeight, validityPeriod)
+}
+
+//Release 释放未使用的nonce，例如交易创建失败
+func (nm *NonceManager) Release(accountID, publicKey string, nonces ...uint64) error {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+
+	db, err := storm.Open(nm.dbFile)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	for _, nonce := range nonces {
+		err = db.DeleteStruct(newNonceReservation(accountID, publicKey, nonce, 0))
+		if err != nil && err != storm.ErrNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+//GetReservations 获取账户公钥当前的预留记录
+func (nm *NonceManager) GetReservations(accountID, publicKey string) ([]*NonceReservation, error) {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+
+	db, err := storm.Open(nm.dbFile)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var list []*NonceReservation
+	err = db.Select(q.Eq("AccountID", accountID), q.Eq("PublicKey", publicKey)).OrderBy("Nonce").Find(&list)
+	if err != nil && err != storm.ErrNotFound {
+		return nil, err
+	}
+	return list, nil
+}
+
+//reserve 与链上nonce对账：已上链的和引用区块过期的预留被清理，新nonce从二者最大值之后开始
+func (nm *NonceManager) reserve(accountID, publicKey string, count int, chainNonce, currentHeight, refBlockHeight, validityPeriod uint64) (uint64, error) {
+	if count <= 0 {
+		return 0, fmt.Errorf("nonce reserve count must be greater than 0")
+	}
+
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+
+	db, err := storm.Open(nm.dbFile)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin(true)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var list []*NonceReservation
+	err = tx.Select(q.Eq("AccountID", accountID), q.Eq("PublicKey", publicKey)).Find(&list)
+	if err != nil && err != storm.ErrNotFound {
+		return 0, err
+	}
+
+	next := chainNonce + 1
+	for _, r := range list {
+		if r.Nonce <= chainNonce || isReservationExpired(r, currentHeight, validityPeriod) {
+			if err := tx.DeleteStruct(r); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		if r.Nonce >= next {
+			next = r.Nonce + 1
+		}
+	}
+
+	for i := 0; i < count; i++ {
+		if err := tx.Save(newNonceReservation(accountID, publicKey, next+uint64(i), refBlockHeight)); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return next, nil
+}
+
+//isReservationExpired 引用区块超过交易有效期，交易不可能再上链
+func isReservationExpired(r *NonceReservation, currentHeight, validityPeriod uint64) bool {
+	return currentHeight > r.RefBlockHeight+validityPeriod
+}
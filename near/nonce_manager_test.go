@@ -0,0 +1,48 @@
+package near
+
+import (
+	"testing"
+)
+
+func TestNonceManager_Reserve(t *testing.T) {
+	wm, clean := testWalletManager(t, nil)
+	defer clean()
+	nm := wm.NonceManager
+
+	account := "c1a8d5c6ad2b3ff8a0e10d0f8a5d6c0c1e6d6a2f0f8a0e10d0f8a5d6c0c1e6d6"
+	publicKey, _ := implicitAccountPublicKey(account)
+
+	//连续创建的交易不会重复使用nonce
+	first, err := nm.reserve(account, publicKey, 2, 10, 1000, 900, TxValidityPeriod)
+	if err != nil || first != 11 {
+		t.Errorf("unexpected first nonce: %d, err: %v", first, err)
+	}
+	second, err := nm.reserve(account, publicKey, 1, 10, 1000, 900, TxValidityPeriod)
+	if err != nil || second != 13 {
+		t.Errorf("unexpected second nonce: %d, err: %v", second, err)
+	}
+
+	//链上nonce已追上，预留被清理
+	third, err := nm.reserve(account, publicKey, 1, 13, 1001, 901, TxValidityPeriod)
+	if err != nil || third != 14 {
+		t.Errorf("unexpected third nonce: %d, err: %v", third, err)
+	}
+	list, _ := nm.GetReservations(account, publicKey)
+	if len(list) != 1 || list[0].Nonce != 14 {
+		t.Errorf("unexpected reservations: %+v", list)
+	}
+
+	//引用区块过期，预留作废
+	fourth, err := nm.reserve(account, publicKey, 1, 13, 901+TxValidityPeriod+1, 90000, TxValidityPeriod)
+	if err != nil || fourth != 14 {
+		t.Errorf("unexpected fourth nonce: %d, err: %v", fourth, err)
+	}
+
+	if err := nm.Release(account, publicKey, fourth); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	list, _ = nm.GetReservations(account, publicKey)
+	if len(list) != 0 {
+		t.Errorf("unexpected reservations after release: %+v", list)
+	}
+}
@@ -0,0 +1,244 @@
+package near
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/asdine/storm"
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+const (
+	//待投递通知数据库文件
+	outboxDBFile = "outbox.db"
+	//通知去重键，记录在交易的扩展参数
+	extParamDedupKey = "dedupKey"
+	//重投间隔上限
+	maxNotifyRetryBackoff = time.Hour
+)
+
+//ObserverIdentifier 观测者实现此接口提供跨重启稳定的标识，投递失败的通知写入发件箱按标识重投。
+//未实现时通知只直接投递，失败时记录未扫区块，由区块重扫重新通知。
+type ObserverIdentifier interface {
+	ObserverID() string
+}
+
+//observerID 观测者标识，未实现ObserverIdentifier时返回类型名，只用于日志和监控，不用于持久化投递记录
+func observerID(o openwallet.BlockScanNotificationObject) (string, bool) {
+	if identifier, ok := o.(ObserverIdentifier); ok {
+		return identifier.ObserverID(), true
+	}
+	return fmt.Sprintf("%T", o), false
+}
+
+//GenNotifyDedupKey 通知去重键，同一交易对同一账户的同一状态只生成一个键，final后的重新通知生成新的键
+func GenNotifyDedupKey(sourceKey string, data *openwallet.TxExtractData) string {
+	tx := data.Transaction
+	final := tx.GetExtParam().Get("final").Bool()
+	key := fmt.Sprintf("%s_%s_%s_%d_%t", sourceKey, tx.WxID, tx.BlockHash, tx.BlockHeight, final)
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+//OutboxMessage 待投递给一个观测者的提取结果，投递成功后删除
+type OutboxMessage struct {
+	ID          string `storm:"id"`    //观测者标识和去重键
+	ObserverID  string `storm:"index"` //观测者标识
+	DedupKey    string
+	SourceKey   string
+	BlockHeight uint64
+	TxID        string
+	Data        *openwallet.TxExtractData
+	Attempts    int    //已投递失败次数
+	LastError   string //最后一次投递失败原因
+	NextRetryAt int64  //下次重投时间
+	Dead        bool   //超过最大投递次数，不再自动重投
+	CreateAt    int64
+	UpdateAt    int64
+}
+
+//NewOutboxMessage 待投递的提取结果
+func NewOutboxMessage(observerID, sourceKey, dedupKey string, data *openwallet.TxExtractData) *OutboxMessage {
+	return &OutboxMessage{
+		ID:          observerID + "_" + dedupKey,
+		ObserverID:  observerID,
+		DedupKey:    dedupKey,
+		SourceKey:   sourceKey,
+		BlockHeight: data.Transaction.BlockHeight,
+		TxID:        data.Transaction.TxID,
+		Data:        data,
+		CreateAt:    time.Now().Unix(),
+	}
+}
+
+//NotifyOutbox 持久化的通知发件箱，投递前写入，投递成功后删除，保证至少投递一次
+type NotifyOutbox struct {
+	wm     *WalletManager
+	mu     sync.Mutex
+	dbFile string
+}
+
+//NewNotifyOutbox 通知发件箱
+func NewNotifyOutbox(wm *WalletManager) *NotifyOutbox {
+	ob := NotifyOutbox{}
+	ob.wm = wm
+	ob.dbFile = filepath.Join(wm.Config.dbPath, outboxDBFile)
+	return &ob
+}
+
+//Put 在一个事务中写入待投递消息，已存在的消息保留原来的投递记录
+func (ob *NotifyOutbox) Put(messages []*OutboxMessage) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	return ob.update(func(tx storm.Node) error {
+		for _, msg := range messages {
+			var exist OutboxMessage
+			err := tx.One("ID", msg.ID, &exist)
+			if err == nil {
+				continue
+			}
+			if err != storm.ErrNotFound {
+				return err
+			}
+			if err := tx.Save(msg); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+//Delete 删除已投递的消息
+func (ob *NotifyOutbox) Delete(messages []*OutboxMessage) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	return ob.update(func(tx storm.Node) error {
+		for _, msg := range messages {
+			err := tx.DeleteStruct(&OutboxMessage{ID: msg.ID})
+			if err != nil && err != storm.ErrNotFound {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+//MarkFailed 记录一次投递失败，累加已持久化的失败次数，计算下次重投时间，超过最大次数不再重投
+func (ob *NotifyOutbox) MarkFailed(msg *OutboxMessage, reason error) error {
+	return ob.markFailed(msg, reason, time.Now())
+}
+
+//Due 消息是否到了重投时间，超过最大次数的消息不自动重投
+func (ob *NotifyOutbox) Due(msg *OutboxMessage) bool {
+	return ob.due(msg, time.Now())
+}
+
+//Retry 重新投递超过最大次数的消息，失败次数清零，下次扫描任务立即重投
+func (ob *NotifyOutbox) Retry(msg *OutboxMessage) error {
+	return ob.update(func(tx storm.Node) error {
+		stored := OutboxMessage{}
+		if err := tx.One("ID", msg.ID, &stored); err != nil {
+			return err
+		}
+		stored.Attempts = 0
+		stored.NextRetryAt = 0
+		stored.Dead = false
+		stored.UpdateAt = time.Now().Unix()
+		return tx.Save(&stored)
+	})
+}
+
+func (ob *NotifyOutbox) due(msg *OutboxMessage, now time.Time) bool {
+	return !msg.Dead && now.Unix() >= msg.NextRetryAt
+}
+
+func (ob *NotifyOutbox) markFailed(msg *OutboxMessage, reason error, now time.Time) error {
+	return ob.update(func(tx storm.Node) error {
+		//首次投递的消息是新建的，失败次数以发件箱中的记录为准
+		stored := *msg
+		err := tx.One("ID", msg.ID, &stored)
+		if err != nil && err != storm.ErrNotFound {
+			return err
+		}
+		stored.Attempts++
+		if reason != nil {
+			stored.LastError = reason.Error()
+		}
+		stored.NextRetryAt = now.Add(ob.backoff(stored.Attempts)).Unix()
+		stored.Dead = stored.Attempts >= ob.wm.Config.NotifyMaxAttempts
+		stored.UpdateAt = now.Unix()
+		if err := tx.Save(&stored); err != nil {
+			return err
+		}
+		*msg = stored
+		return nil
+	})
+}
+
+//backoff 第n次失败后的重投间隔，指数增长，不超过上限
+func (ob *NotifyOutbox) backoff(attempts int) time.Duration {
+	interval := time.Duration(ob.wm.Config.NotifyRetryInterval) * time.Second
+	for i := 1; i < attempts && interval < maxNotifyRetryBackoff; i++ {
+		interval *= 2
+	}
+	if interval > maxNotifyRetryBackoff {
+		interval = maxNotifyRetryBackoff
+	}
+	return interval
+}
+
+//List 观测者待投递的消息，按区块高度排序
+func (ob *NotifyOutbox) List(observerID string) ([]*OutboxMessage, error) {
+	var list []*OutboxMessage
+	err := ob.update(func(tx storm.Node) error {
+		err := tx.Find("ObserverID", observerID, &list)
+		if err == storm.ErrNotFound {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortOutboxMessages(list)
+	return list, nil
+}
+
+func (ob *NotifyOutbox) update(fn func(tx storm.Node) error) error {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	db, err := storm.Open(ob.dbFile)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+//sortOutboxMessages 按区块高度、创建时间排序
+func sortOutboxMessages(list []*OutboxMessage) {
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].BlockHeight != list[j].BlockHeight {
+			return list[i].BlockHeight < list[j].BlockHeight
+		}
+		return list[i].CreateAt < list[j].CreateAt
+	})
+}
@@ -0,0 +1,213 @@
+package near
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+type testObserver struct {
+	id       string
+	failures int
+	received []string
+}
+
+func (o *testObserver) ObserverID() string {
+	return o.id
+}
+
+func (o *testObserver) BlockScanNotify(header *openwallet.BlockHeader) error {
+	return nil
+}
+
+func (o *testObserver) BlockExtractDataNotify(sourceKey string, data *openwallet.TxExtractData) error {
+	if o.failures > 0 {
+		o.failures--
+		return errors.New("downstream unavailable")
+	}
+	o.received = append(o.received, data.Transaction.GetExtParam().Get(extParamDedupKey).String())
+	return nil
+}
+
+//testAnonymousObserver 没有实现ObserverIdentifier的观测者
+type testAnonymousObserver struct {
+	failures int
+	received int
+}
+
+func (o *testAnonymousObserver) BlockScanNotify(header *openwallet.BlockHeader) error {
+	return nil
+}
+
+func (o *testAnonymousObserver) BlockExtractDataNotify(sourceKey string, data *openwallet.TxExtractData) error {
+	if o.failures > 0 {
+		o.failures--
+		return errors.New("downstream unavailable")
+	}
+	o.received++
+	return nil
+}
+
+func TestNearBlockScanner_NotifyOutbox(t *testing.T) {
+	wm, clean := testWalletManager(t, nil)
+	defer clean()
+	bs := wm.Blockscanner
+
+	stable := &testObserver{id: "stable"}
+	flaky := &testObserver{id: "flaky", failures: 1}
+	bs.AddObserver(stable)
+	bs.AddObserver(flaky)
+
+	tx := TxTransfer{From: "a.near", To: "b.near", TxId: "tx1", Value: "1", Status: TxStatusSuccess}
+	scanTarget := func(target openwallet.ScanTarget) (string, bool) {
+		return target.Address, target.Address == "b.near"
+	}
+	result := bs.ExtractTransaction(100, "hash", 0, tx, scanTarget)
+	if err := bs.newExtractDataNotify(100, result.extractData); err != nil {
+		t.Errorf("observer failure should not fail the block: %v", err)
+	}
+	if len(stable.received) != 1 || len(flaky.received) != 0 || stable.received[0] == "" {
+		t.Errorf("unexpected deliveries: stable=%v flaky=%v", stable.received, flaky.received)
+	}
+
+	//只有失败的观测者留在发件箱
+	list, _ := bs.Outbox.List("flaky")
+	if len(list) != 1 || list[0].TxID != "tx1" || list[0].Attempts != 1 {
+		t.Errorf("unexpected outbox messages: %+v", list)
+	}
+	list, _ = bs.Outbox.List("stable")
+	if len(list) != 0 {
+		t.Errorf("unexpected outbox messages of stable observer: %+v", list)
+	}
+
+	//未到重投时间不投递
+	bs.RedeliverOutbox()
+	if len(flaky.received) != 0 {
+		t.Errorf("message should not be redelivered before backoff: %v", flaky.received)
+	}
+
+	//重投只投递给失败的观测者，去重键不变
+	bs.redeliverOutbox(time.Now().Add(time.Minute))
+	if len(stable.received) != 1 || len(flaky.received) != 1 || flaky.received[0] != stable.received[0] {
+		t.Errorf("unexpected redeliveries: stable=%v flaky=%v", stable.received, flaky.received)
+	}
+	list, _ = bs.Outbox.List("flaky")
+	if len(list) != 0 {
+		t.Errorf("unexpected outbox messages after redelivery: %+v", list)
+	}
+}
+
+func TestNearBlockScanner_NotifyOutboxMaxAttempts(t *testing.T) {
+	wm, clean := testWalletManager(t, nil)
+	defer clean()
+	bs := wm.Blockscanner
+	bs.wm.Config.NotifyMaxAttempts = 3
+	bs.wm.Config.NotifyRetryInterval = 10
+
+	broken := &testObserver{id: "broken", failures: 100}
+	bs.AddObserver(broken)
+
+	tx := TxTransfer{From: "a.near", To: "b.near", TxId: "tx1", Value: "1", Status: TxStatusSuccess}
+	scanTarget := func(target openwallet.ScanTarget) (string, bool) {
+		return target.Address, target.Address == "b.near"
+	}
+	result := bs.ExtractTransaction(100, "hash", 0, tx, scanTarget)
+	bs.newExtractDataNotify(100, result.extractData)
+
+	//失败次数按发件箱记录累加，重投间隔指数增长
+	now := time.Now()
+	for i, delay := range []time.Duration{10 * time.Second, 30 * time.Second} {
+		now = now.Add(delay)
+		bs.redeliverOutbox(now)
+		list, _ := bs.Outbox.List("broken")
+		if len(list) != 1 || list[0].Attempts != i+2 {
+			t.Fatalf("unexpected outbox messages: %+v", list)
+		}
+	}
+	list, _ := bs.Outbox.List("broken")
+	if !list[0].Dead || list[0].LastError != "downstream unavailable" {
+		t.Fatalf("message should stop redelivery after max attempts: %+v", list[0])
+	}
+
+	//超过最大次数后不再自动重投
+	failures := broken.failures
+	bs.redeliverOutbox(now.Add(24 * time.Hour))
+	if broken.failures != failures {
+		t.Errorf("dead message should not be redelivered")
+	}
+
+	//重新投递后恢复重投
+	broken.failures = 0
+	if err := bs.Outbox.Retry(list[0]); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	bs.RedeliverOutbox()
+	list, _ = bs.Outbox.List("broken")
+	if len(broken.received) != 1 || len(list) != 0 {
+		t.Errorf("unexpected redelivery after retry: received=%v outbox=%+v", broken.received, list)
+	}
+}
+
+func TestNearBlockScanner_AnonymousObserver(t *testing.T) {
+	wm, clean := testWalletManager(t, nil)
+	defer clean()
+	bs := wm.Blockscanner
+	anonymous := &testAnonymousObserver{failures: 1}
+	named := &testObserver{id: "named"}
+	bs.AddObserver(anonymous)
+	bs.AddObserver(named)
+
+	//没有稳定标识的观测者不写发件箱，投递失败时记录未扫区块，由重扫重新通知
+	tx := TxTransfer{From: "a.near", To: "b.near", TxId: "tx1", Value: "1", Status: TxStatusSuccess}
+	scanTarget := func(target openwallet.ScanTarget) (string, bool) {
+		return target.Address, target.Address == "b.near"
+	}
+	if bs.notifyExtractResult(100, bs.ExtractTransaction(100, "hash", 0, tx, scanTarget)) {
+		t.Errorf("failed notification should fail the transaction")
+	}
+	if list, _ := bs.Outbox.List("*near.testAnonymousObserver"); len(list) != 0 {
+		t.Errorf("anonymous observer should not use outbox: %+v", list)
+	}
+	list, _ := bs.GetUnscanRecords()
+	if len(list) != 1 || list[0].BlockHeight != 100 || list[0].TxID != "tx1" {
+		t.Errorf("unexpected unscan records: %+v", list)
+	}
+	if len(named.received) != 1 {
+		t.Errorf("named observer should be notified: %v", named.received)
+	}
+
+	if err := bs.newExtractDataNotify(100, bs.ExtractTransaction(100, "hash", 0, tx, scanTarget).extractData); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if anonymous.received != 1 {
+		t.Errorf("anonymous observer should be notified on rescan: %d", anonymous.received)
+	}
+}
+
+func TestNearBlockScanner_NotifyOutboxPutFailed(t *testing.T) {
+	wm, clean := testWalletManager(t, nil)
+	defer clean()
+	bs := wm.Blockscanner
+	named := &testObserver{id: "named"}
+	bs.AddObserver(named)
+
+	//发件箱不可写时不投递，记录未扫区块，重扫时重新通知
+	bs.Outbox.dbFile = filepath.Join(bs.Outbox.dbFile, "missing", outboxDBFile)
+	tx := TxTransfer{From: "a.near", To: "b.near", TxId: "tx1", Value: "1", Status: TxStatusSuccess}
+	scanTarget := func(target openwallet.ScanTarget) (string, bool) {
+		return target.Address, target.Address == "b.near"
+	}
+	if bs.notifyExtractResult(100, bs.ExtractTransaction(100, "hash", 0, tx, scanTarget)) {
+		t.Errorf("outbox failure should fail the transaction")
+	}
+	list, _ := bs.GetUnscanRecords()
+	if len(list) != 1 || list[0].BlockHeight != 100 || list[0].TxID != "tx1" {
+		t.Errorf("unexpected unscan records: %+v", list)
+	}
+	if len(named.received) != 0 {
+		t.Errorf("message should not be delivered without outbox record: %v", named.received)
+	}
+}
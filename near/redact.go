@@ -0,0 +1,112 @@
+package near
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/blocktree/openwallet/hdkeystore"
+	"github.com/mr-tron/base58"
+)
+
+//脱敏后的占位内容
+const redacted = "[REDACTED]"
+
+//sensitiveKeyNames 字段名包含这些词时不输出字段值，比较时忽略大小写、下划线和中划线
+var sensitiveKeyNames = []string{"privatekey", "prikey", "secret", "seed", "mnemonic", "password", "passphrase", "keybytes"}
+
+var (
+	//可能为密钥的base58串，带ed25519:前缀时64字节为私钥、32字节为公钥
+	keyTokenRegexp = regexp.MustCompile(`(?:(?:ed25519|secp256k1):)?[1-9A-HJ-NP-Za-km-z]{32,90}`)
+	//64字节私钥的hex串
+	hexSecretRegexp = regexp.MustCompile(`[0-9a-fA-F]{128}`)
+)
+
+//privateKeyHolder 持有私钥的类型，例如派生的子密钥
+type privateKeyHolder interface {
+	GetPrivateKeyBytes() ([]byte, error)
+}
+
+//Secret 密钥数据，任何格式化输出都不会包含内容
+type Secret []byte
+
+//String 实现fmt.Stringer
+func (s Secret) String() string {
+	return redacted
+}
+
+//GoString 实现fmt.GoStringer
+func (s Secret) GoString() string {
+	return redacted
+}
+
+//MarshalJSON 序列化时同样脱敏
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + redacted + `"`), nil
+}
+
+//isSensitiveKey 字段名是否表示密钥
+func isSensitiveKey(key string) bool {
+	return keyNameContains(key, sensitiveKeyNames)
+}
+
+//keyNameContains 比较时忽略大小写、下划线和中划线
+func keyNameContains(key string, names []string) bool {
+	normalized := strings.ToLower(key)
+	normalized = strings.Replace(normalized, "_", "", -1)
+	normalized = strings.Replace(normalized, "-", "", -1)
+	for _, name := range names {
+		if strings.Contains(normalized, name) {
+			return true
+		}
+	}
+	return false
+}
+
+//RedactField 字段脱敏：密钥字段名、密钥类型和原始字节不输出内容，其他值按RedactString处理
+func RedactField(field LogField) LogField {
+	if isSensitiveKey(field.Key) {
+		return LogField{Key: field.Key, Value: redacted}
+	}
+	switch v := field.Value.(type) {
+	case nil:
+		return field
+	case Secret, *hdkeystore.HDKey, privateKeyHolder:
+		return LogField{Key: field.Key, Value: redacted}
+	case []byte:
+		//原始字节可能是密钥，需要输出时由调用者编码为字符串
+		return LogField{Key: field.Key, Value: fmt.Sprintf("[%d bytes]", len(v))}
+	case string:
+		return LogField{Key: field.Key, Value: RedactString(v)}
+	case error:
+		return LogField{Key: field.Key, Value: RedactString(v.Error())}
+	case fmt.Stringer:
+		return LogField{Key: field.Key, Value: RedactString(v.String())}
+	default:
+		return LogField{Key: field.Key, Value: RedactString(fmt.Sprintf("%v", v))}
+	}
+}
+
+//RedactString 替换文本中的64字节私钥：ed25519:格式的私钥，以及不带前缀的base58串和hex串。
+//32字节编码与交易哈希、公钥、隐式账户无法区分，保留原文；32字节私钥种子须通过密钥字段名或Secret类型输出
+func RedactString(s string) string {
+	s = keyTokenRegexp.ReplaceAllStringFunc(s, func(token string) string {
+		if base58DecodedLen(token[strings.Index(token, ":")+1:]) != 64 {
+			return token
+		}
+		if i := strings.Index(token, ":"); i >= 0 {
+			return token[:i+1] + redacted
+		}
+		return redacted
+	})
+	return hexSecretRegexp.ReplaceAllString(s, redacted)
+}
+
+//base58DecodedLen base58解码后的字节数，64字节为ed25519私钥加公钥，32字节可能为私钥种子，不是base58时返回0
+func base58DecodedLen(s string) int {
+	buf, err := base58.Decode(s)
+	if err != nil {
+		return 0
+	}
+	return len(buf)
+}
@@ -0,0 +1,203 @@
+package near
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Assetsadapter/near-adapter/txsigner"
+	"github.com/blocktree/go-owcrypt"
+	"github.com/blocktree/openwallet/openwallet"
+	"github.com/mr-tron/base58"
+)
+
+//testSignHashWith 使用签名器签名交易单，返回签名和待签名哈希
+func testSignHashWith(t *testing.T, signer txsigner.Signer, publicKey []byte) ([]byte, []byte, error) {
+	rawTx := testUnsignedRawTx(t, publicKey, "")
+	wm := NewWalletManager()
+	wm.Signer = signer
+	//配置签名器后不使用钱包密钥
+	err := wm.TxDecoder.SignRawTransaction(nil, rawTx)
+	keySignature := rawTx.Signatures["account"][0]
+	msg, _ := hex.DecodeString(keySignature.Message)
+	sig, _ := hex.DecodeString(keySignature.Signature)
+	return sig, msg, err
+}
+
+func testVerifySignature(t *testing.T, publicKey, msg, sig []byte) {
+	if owcrypt.Verify(publicKey, nil, 0, msg, uint16(len(msg)), sig, owcrypt.ECC_CURVE_ED25519) != owcrypt.SUCCESS {
+		t.Errorf("signature verify failed")
+	}
+}
+
+func TestLocalSigner(t *testing.T) {
+	_, _, privateKey, publicKey := testSigningKey(t)
+	signer, err := txsigner.NewLocalSigner(privateKey)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sig, msg, err := testSignHashWith(t, signer, publicKey)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	testVerifySignature(t, publicKey, msg, sig)
+
+	if _, err := signer.SignHash(make([]byte, 32), msg); err != txsigner.ErrKeyNotFound {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+//softHSMSession 模拟SoftHSM会话，私钥以CKA_ID为公钥的对象保存
+type softHSMSession struct {
+	keys       map[txsigner.PKCS11ObjectHandle][]byte
+	ids        map[string]txsigner.PKCS11ObjectHandle
+	found      []txsigner.PKCS11ObjectHandle
+	signKey    []byte
+	findCalled int
+}
+
+func newSoftHSMSession(privateKeys ...[]byte) *softHSMSession {
+	s := &softHSMSession{keys: make(map[txsigner.PKCS11ObjectHandle][]byte), ids: make(map[string]txsigner.PKCS11ObjectHandle)}
+	for i, privateKey := range privateKeys {
+		publicKey, _ := owcrypt.GenPubkey(privateKey, owcrypt.ECC_CURVE_ED25519)
+		handle := txsigner.PKCS11ObjectHandle(i + 1)
+		s.keys[handle] = privateKey
+		s.ids[string(publicKey)] = handle
+	}
+	return s
+}
+
+func (s *softHSMSession) FindObjectsInit(template []*txsigner.PKCS11Attribute) error {
+	s.findCalled++
+	s.found = nil
+	for _, attr := range template {
+		if attr.Type == txsigner.CKA_ID {
+			if handle, exist := s.ids[string(attr.Value)]; exist {
+				s.found = append(s.found, handle)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *softHSMSession) FindObjects(max int) ([]txsigner.PKCS11ObjectHandle, bool, error) {
+	return s.found, false, nil
+}
+
+func (s *softHSMSession) FindObjectsFinal() error {
+	s.found = nil
+	return nil
+}
+
+func (s *softHSMSession) SignInit(mechanism uint, key txsigner.PKCS11ObjectHandle) error {
+	if mechanism != txsigner.CKM_EDDSA {
+		return errors.New("CKR_MECHANISM_INVALID")
+	}
+	s.signKey = s.keys[key]
+	return nil
+}
+
+func (s *softHSMSession) Sign(message []byte) ([]byte, error) {
+	sig, ret := owcrypt.Signature(s.signKey, nil, 0, message, uint16(len(message)), owcrypt.ECC_CURVE_ED25519)
+	if ret != owcrypt.SUCCESS {
+		return nil, errors.New("CKR_FUNCTION_FAILED")
+	}
+	return sig, nil
+}
+
+func TestPKCS11Signer(t *testing.T) {
+	_, _, privateKey, publicKey := testSigningKey(t)
+	session := newSoftHSMSession(privateKey)
+	signer := txsigner.NewPKCS11Signer(session)
+
+	for i := 0; i < 2; i++ {
+		sig, msg, err := testSignHashWith(t, signer, publicKey)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		testVerifySignature(t, publicKey, msg, sig)
+	}
+	if session.findCalled != 1 {
+		t.Errorf("key handle should be cached, find called %d times", session.findCalled)
+	}
+
+	_, _, _, otherKey := testSigningKey(t)
+	if _, _, err := testSignHashWith(t, signer, otherKey); err == nil {
+		t.Errorf("unknown key should fail")
+	}
+}
+
+func TestRemoteSigner(t *testing.T) {
+	_, _, privateKey, publicKey := testSigningKey(t)
+	local, _ := txsigner.NewLocalSigner(privateKey)
+	tamper := false
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/sign" || r.Header.Get("Authorization") != "Bearer secret-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		request := txsigner.RemoteSignRequest{}
+		json.NewDecoder(r.Body).Decode(&request)
+		pub, _ := base58.Decode(strings.TrimPrefix(request.PublicKey, "ed25519:"))
+		hash, _ := hex.DecodeString(request.Hash)
+		sig, err := local.SignHash(pub, hash)
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(txsigner.RemoteSignResponse{Error: err.Error()})
+			return
+		}
+		if tamper {
+			sig = bytes.Repeat([]byte{1}, len(sig))
+		}
+		json.NewEncoder(w).Encode(txsigner.RemoteSignResponse{Signature: hex.EncodeToString(sig)})
+	}))
+	defer stub.Close()
+
+	signer := txsigner.NewRemoteSigner(stub.URL+"/", "secret-token")
+	sig, msg, err := testSignHashWith(t, signer, publicKey)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	testVerifySignature(t, publicKey, msg, sig)
+
+	_, _, _, otherKey := testSigningKey(t)
+	if _, _, err := testSignHashWith(t, signer, otherKey); err == nil || !strings.Contains(err.Error(), txsigner.ErrKeyNotFound.Error()) {
+		t.Errorf("unknown key should fail: %v", err)
+	}
+
+	//签名服务返回的签名无法验证时拒绝
+	tamper = true
+	if _, _, err := testSignHashWith(t, signer, publicKey); err == nil {
+		t.Errorf("invalid remote signature should fail")
+	}
+
+	unauthorized := txsigner.NewRemoteSigner(stub.URL, "")
+	if _, _, err := testSignHashWith(t, unauthorized, publicKey); err == nil {
+		t.Errorf("unauthorized request should fail")
+	}
+}
+
+func TestTransactionDecoder_SignRawTransactionWalletKey(t *testing.T) {
+	key, hdPath, _, publicKey := testSigningKey(t)
+	rawTx := testUnsignedRawTx(t, publicKey, hdPath)
+	wm := NewWalletManager()
+	if err := wm.TxDecoder.SignRawTransaction(&testHDKeyWallet{key: key}, rawTx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	//地址公钥与派生密钥不一致时拒绝签名
+	_, _, _, otherKey := testSigningKey(t)
+	rawTx = testUnsignedRawTx(t, otherKey, hdPath)
+	err := wm.TxDecoder.SignRawTransaction(&testHDKeyWallet{key: key}, rawTx)
+	if err == nil {
+		t.Errorf("mismatched wallet key should fail")
+	}
+	if owErr, ok := err.(*openwallet.Error); ok && owErr.Code() != openwallet.ErrCreateRawTransactionFailed {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -1,23 +1,37 @@
 package near
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/Assetsadapter/near-adapter/neartransaction"
 	"github.com/Assetsadapter/near-adapter/txsigner"
-	"github.com/blocktree/go-owcrypt"
+	"github.com/blocktree/openwallet/common"
+	"github.com/blocktree/openwallet/hdkeystore"
 	"github.com/blocktree/openwallet/log"
 	"github.com/blocktree/openwallet/openwallet"
 	"github.com/mr-tron/base58"
 	"github.com/shopspring/decimal"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 )
 
 // txidPrefix is prepended to a transaction when computing its txid
 var txidPrefix = []byte("TX")
 
+//交易单扩展参数
+const (
+	extParamRefBlockHash     = "refBlockHash"     //引用区块hash
+	extParamRefBlockHeight   = "refBlockHeight"   //引用区块高度
+	extParamExpiryHeight     = "expiryHeight"     //交易过期高度
+	extParamExecutionFailure = "executionFailure" //交易执行失败原因
+)
+
 type TransactionDecoder struct {
 	openwallet.TransactionDecoderBase
 	wm *WalletManager //钱包管理者
@@ -31,18 +45,32 @@ func NewTransactionDecoder(wm *WalletManager) *TransactionDecoder {
 }
 
 func (decoder *TransactionDecoder) CreateRawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) error {
-	return decoder.CreateRawSimpleTransaction(wrapper, rawTx)
+	return decoder.CreateRawTransactionContext(context.Background(), wrapper, rawTx)
+}
+
+//CreateRawTransactionContext 创建交易单，上下文取消时中断节点查询
+func (decoder *TransactionDecoder) CreateRawTransactionContext(ctx context.Context, wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) error {
+	return decoder.createRawSimpleTransaction(ctx, wrapper, rawTx)
 }
 
 //CreateRawTransaction 创建交易单
 func (decoder *TransactionDecoder) CreateRawSimpleTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) error {
+	return decoder.createRawSimpleTransaction(context.Background(), wrapper, rawTx)
+}
+
+func (decoder *TransactionDecoder) createRawSimpleTransaction(ctx context.Context, wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) error {
 
 	var (
 		accountID       = rawTx.Account.AccountID
+		amountSent      = decimal.Zero
 		estimateFees    = decimal.Zero
 		findAddrBalance *AddrBalance
 	)
 
+	if len(rawTx.To) == 0 {
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "receiver addresses is empty")
+	}
+
 	//获取wallet
 	addresses, err := wrapper.GetAddressList(0, -1, "AccountID", accountID)
 	if err != nil {
@@ -53,36 +81,25 @@ func (decoder *TransactionDecoder) CreateRawSimpleTransaction(wrapper openwallet
 		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "[%s] have not addresses", accountID)
 	}
 
-	var amountStr string
-	for _, v := range rawTx.To {
-		amountStr = v
-		break
-	}
-
-	amountSent, _ := decimal.NewFromString(amountStr)
-
-	//if len(rawTx.FeeRate) > 0 {
-	//	estimateFees = common.StringNumToBigIntWithExp(rawTx.FeeRate, decimals)
-	//} else {
-	//	estimateFees = common.StringNumToBigIntWithExp(decoder.wm.Config.FixFees, decimals)
-	//}
-	gasPriceStr, err := decoder.wm.Blockscanner.GetGasPrice()
+	gasPrice, err := decoder.getFeeRate(ctx, rawTx.FeeRate)
 	if err != nil {
 		return err
 	}
-	gasPrice, err := decimal.NewFromString(gasPriceStr)
-	if err != nil {
-		return err
+
+	for _, amount := range rawTx.To {
+		amountDec, _ := decimal.NewFromString(amount)
+		amountSent = amountSent.Add(amountDec)
 	}
-	estimateFees = gasPrice.Mul(decimal.New(424555062500*2, 1)).Div(decimal.New(1, Decimal))
-	log.Info("estimateFees:", estimateFees)
 	//Accounts must have enough tokens cover its storage.
 	//Storage cost per byte is 0.0001 NEAR and an account with one access key must maintain a balance of at least 0.0182 NEAR. For more details, see
 	//账户一般消耗182
 	retainedBalance := decimal.NewFromFloat32(0.0182).Add(decimal.NewFromFloat32(182 * 0.0001))
 	log.Info("retainedBalance:", retainedBalance)
 	for _, addr := range addresses {
-		resp, _ := decoder.wm.Blockscanner.GetBalanceByAddress(addr.Address)
+		resp, err := decoder.wm.Blockscanner.GetBalanceByAddressContext(ctx, addr.Address)
+		if err != nil {
+			return err
+		}
 		if len(resp) == 0 {
 			continue
 		}
@@ -91,6 +108,10 @@ func (decoder *TransactionDecoder) CreateRawSimpleTransaction(wrapper openwallet
 			continue
 		}
 
+		//多个接收者时，每个接收者一笔交易，需要覆盖全部转账数量和手续费
+		estimateFees = decoder.estimateTransferFees(ctx, addr.Address, rawTx.To, gasPrice)
+		log.Info("estimateFees:", estimateFees)
+
 		//总消耗数量 = 转账数量 + 手续费
 		totalAmount := decimal.Zero
 		totalAmount = totalAmount.Add(amountSent)
@@ -108,11 +129,12 @@ func (decoder *TransactionDecoder) CreateRawSimpleTransaction(wrapper openwallet
 	}
 
 	if findAddrBalance == nil {
-		return openwallet.Errorf(openwallet.ErrInsufficientBalanceOfAccount, "all address's balance of account is not enough, an address required to retain at least %s algos", retainedBalance)
+		return openwallet.Errorf(openwallet.ErrInsufficientBalanceOfAccount, "all address's balance of account is not enough to send %s NEAR to %d receivers, an address required to retain at least %s NEAR", amountSent, len(rawTx.To), retainedBalance)
 	}
 
 	//最后创建交易单
 	err = decoder.createRawTransaction(
+		ctx,
 		wrapper,
 		rawTx,
 		findAddrBalance,
@@ -125,106 +147,208 @@ func (decoder *TransactionDecoder) CreateRawSimpleTransaction(wrapper openwallet
 
 }
 
-//SignRawTransaction 签名交易单
+//SignRawTransaction 签名交易单，配置了签名器时使用签名器，否则使用钱包的HD密钥在本地签名。
+//多签交易单只签名本签名者持有的成员密钥，已签名的记录保留，签名数达到Required时交易单完成。
 func (decoder *TransactionDecoder) SignRawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) error {
 
 	if rawTx.Signatures == nil || len(rawTx.Signatures) == 0 {
 		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "transaction signature is empty")
 	}
-	key, err := wrapper.HDKey()
+
+	nearTxs, err := decodeRawTransactions(rawTx.RawHex)
 	if err != nil {
-		return err
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "raw tx Unmarshal failed=%s", err)
 	}
 
 	keySignatures := rawTx.Signatures[rawTx.Account.AccountID]
-	if keySignatures != nil {
-		for _, keySignature := range keySignatures {
-
-			childKey, err := key.DerivedKeyWithPath(keySignature.Address.HDPath, keySignature.EccType)
-			keyBytes, err := childKey.GetPrivateKeyBytes()
-			if err != nil {
-				return err
-			}
+	if len(keySignatures) != len(nearTxs) {
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "transaction signature count %d not match transaction count %d", len(keySignatures), len(nearTxs))
+	}
 
-			publicKey, _ := hex.DecodeString(keySignature.Address.PublicKey)
+	logger := decoder.wm.Logger.With(F("account", rawTx.Account.AccountID))
 
-			msg, err := hex.DecodeString(keySignature.Message)
-			if err != nil {
-				return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "decoder transaction hash failed, unexpected err: %v", err)
-			}
+	multisig := isMultisigRawTransaction(rawTx)
+	signedCount := 0
+	var key *hdkeystore.HDKey
+	for i, keySignature := range keySignatures {
 
-			sig, err := txsigner.Default.SignTransactionHash(msg, keyBytes, keySignature.EccType)
-			if err != nil {
-				return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "sign transaction hash failed, unexpected err: %v", err)
-			}
+		if multisig && len(keySignature.Signature) > 0 {
+			continue
+		}
 
-			rawTxHex, err := hex.DecodeString(rawTx.RawHex)
-			if err != nil {
-				return err
-			}
-			nearTx := neartransaction.Transaction{}
-			if err := json.Unmarshal(rawTxHex, &nearTx); err != nil {
-				return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "sign transaction hash failed, unexpected err: %v", err)
+		signer := decoder.wm.Signer
+		if signer == nil {
+			hdPath := keySignature.Address.HDPath
+			if multisig {
+				//成员密钥可能属于其他签名者的钱包
+				address, held := findWalletAddress(wrapper, keySignature.Address.PublicKey)
+				if !held {
+					continue
+				}
+				hdPath = address.HDPath
 			}
-			nearTx.Signature = sig
-			_, _, err = nearTx.Serialize()
-			if err != nil {
-				return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "sign transaction hash failed, unexpected err: %v", err)
+			if key == nil {
+				key, err = wrapper.HDKey()
+				if err != nil {
+					return err
+				}
 			}
-			rawTx.RawHex = hex.EncodeToString(nearTx.RawTxByte)
+			signer, err = walletKeySigner(key, hdPath, keySignature.EccType)
 			if err != nil {
-				return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "raw tx Unmarshal failed=%s", err)
+				return err
 			}
-			decoder.wm.Log.Debugf("message: %s", hex.EncodeToString(msg))
-			decoder.wm.Log.Debugf("publicKey: %s", hex.EncodeToString(publicKey))
-			decoder.wm.Log.Errorf("privateKey: %s", base58.Encode(keyBytes))
+		}
+
+		publicKey, err := hex.DecodeString(keySignature.Address.PublicKey)
+		if err != nil {
+			return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "decoder public key failed, unexpected err: %v", err)
+		}
+
+		msg, err := hex.DecodeString(keySignature.Message)
+		if err != nil {
+			return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "decoder transaction hash failed, unexpected err: %v", err)
+		}
 
-			decoder.wm.Log.Debugf("nonce : %s", keySignature.Nonce)
-			decoder.wm.Log.Debugf("signature: %s", hex.EncodeToString(sig))
+		sig, err := signer.SignHash(publicKey, msg)
+		if multisig && errors.Is(err, txsigner.ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "sign transaction hash failed, unexpected err: %v", err)
+		}
 
-			keySignature.Signature = hex.EncodeToString(sig)
+		nearTx := nearTxs[i]
+		nearTx.Signature = sig
+		_, _, err = nearTx.Serialize()
+		if err != nil {
+			return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "sign transaction hash failed, unexpected err: %v", err)
 		}
+		//私钥、签名均不输出
+		logger.Debug("transaction hash signed",
+			F("txid", base58.Encode(msg)),
+			F("publicKey", keySignature.Address.PublicKey),
+			F("nonce", keySignature.Nonce))
+
+		keySignature.Signature = hex.EncodeToString(sig)
+		signedCount++
+	}
+
+	if multisig {
+		if signedCount == 0 {
+			return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "signer holds none of the multisig member keys")
+		}
+		rawTx.IsCompleted = countSignedKeys(keySignatures) >= rawTx.Required
+	}
+
+	rawTx.RawHex, err = encodeRawTransactions(nearTxs)
+	if err != nil {
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "raw tx Marshal failed=%s", err)
 	}
 
-	decoder.wm.Log.Info("transaction hash sign success")
+	logger.Info("transaction hash sign success", F("count", signedCount))
 
 	rawTx.Signatures[rawTx.Account.AccountID] = keySignatures
 
 	return nil
 }
 
+//walletKeySigner 由钱包HD密钥派生签名地址的私钥，作为本地签名器
+func walletKeySigner(key *hdkeystore.HDKey, hdPath string, eccType uint32) (txsigner.Signer, error) {
+	childKey, err := key.DerivedKeyWithPath(hdPath, eccType)
+	if err != nil {
+		return nil, err
+	}
+	keyBytes, err := childKey.GetPrivateKeyBytes()
+	if err != nil {
+		return nil, err
+	}
+	return txsigner.NewLocalSigner(keyBytes)
+}
+
+//findWalletAddress 按公钥查找钱包中的地址
+func findWalletAddress(wrapper openwallet.WalletDAI, publicKey string) (*openwallet.Address, bool) {
+	addresses, err := wrapper.GetAddressList(0, 1, "PublicKey", publicKey)
+	if err != nil || len(addresses) == 0 {
+		return nil, false
+	}
+	return addresses[0], true
+}
+
 //VerifyRawTransaction 验证交易单，验证交易单并返回加入签名后的交易单
 func (decoder *TransactionDecoder) VerifyRawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) error {
+	return decoder.VerifyRawTransactionContext(context.Background(), wrapper, rawTx)
+}
+
+//VerifyRawTransactionContext 验证交易单，上下文取消时中断节点查询。
+//NEAR没有原生多签，多签交易单为成员调用多签合约，只验证已签名的交易，且签名数须达到Required。
+func (decoder *TransactionDecoder) VerifyRawTransactionContext(ctx context.Context, wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) error {
 
 	if rawTx.Signatures == nil || len(rawTx.Signatures) == 0 {
 		//this.wm.Log.Std.Error("len of signatures error. ")
 		return openwallet.Errorf(openwallet.ErrVerifyRawTransactionFailed, "transaction signature is empty")
 	}
 
-	//支持多重签名
-	for accountID, keySignatures := range rawTx.Signatures {
-		decoder.wm.Log.Debug("accountID Signatures:", accountID)
-		for _, keySignature := range keySignatures {
+	if err := decoder.checkRawTransactionExpiry(ctx, rawTx); err != nil {
+		return openwallet.Errorf(openwallet.ErrVerifyRawTransactionFailed, "%v", err)
+	}
 
-			messsage, _ := hex.DecodeString(keySignature.Message)
-			signature, _ := hex.DecodeString(keySignature.Signature)
-			publicKey, _ := hex.DecodeString(keySignature.Address.PublicKey)
+	nearTxs, err := decodeRawTransactions(rawTx.RawHex)
+	if err != nil {
+		return openwallet.Errorf(openwallet.ErrVerifyRawTransactionFailed, "raw tx Unmarshal failed=%s", err)
+	}
 
-			// 验证签名
-			ret := owcrypt.Verify(publicKey, nil, 0, messsage, uint16(len(messsage)), signature, keySignature.EccType)
-			if ret != owcrypt.SUCCESS {
-				return openwallet.Errorf(openwallet.ErrVerifyRawTransactionFailed, "transaction verify failed")
+	//解析将要广播的已签名borsh，重新计算签名哈希并验证签名
+	multisig := isMultisigRawTransaction(rawTx)
+	signedTxs := make([]*neartransaction.Transaction, len(nearTxs))
+	hashes := make([][]byte, len(nearTxs))
+	var signedCount uint64
+	for i, nearTx := range nearTxs {
+		if multisig && len(nearTx.Signature) == 0 {
+			//其他成员未签名的交易不会广播
+			continue
+		}
+		signedTx, hash, err := decodeSignedTransaction(nearTx)
+		if err != nil {
+			return openwallet.Errorf(openwallet.ErrVerifyRawTransactionFailed, "transaction [%d] verify failed: %v", i, err)
+		}
+		if multisig {
+			if err := checkMultisigTransaction(rawTx, signedTx); err != nil {
+				return openwallet.Errorf(openwallet.ErrVerifyRawTransactionFailed, "transaction [%d] verify failed: %v", i, err)
 			}
+		}
+		signedTxs[i] = signedTx
+		hashes[i] = hash
+		signedCount++
+	}
+	if multisig && signedCount < rawTx.Required {
+		return openwallet.Errorf(openwallet.ErrVerifyRawTransactionFailed, "multisig transaction requires %d signatures, got %d", rawTx.Required, signedCount)
+	}
 
-			rawTxHex, err := hex.DecodeString(rawTx.RawHex)
-			if err != nil {
-				return openwallet.Errorf(openwallet.ErrVerifyRawTransactionFailed, "raw tx Unmarshal failed=%s", err)
+	//待签名列表须与已签名交易一致
+	for accountID, keySignatures := range rawTx.Signatures {
+		if len(keySignatures) != len(nearTxs) {
+			return openwallet.Errorf(openwallet.ErrVerifyRawTransactionFailed, "transaction signature count %d not match transaction count %d", len(keySignatures), len(nearTxs))
+		}
+		for i, keySignature := range keySignatures {
+			if signedTxs[i] == nil {
+				if len(keySignature.Signature) > 0 {
+					return openwallet.Errorf(openwallet.ErrVerifyRawTransactionFailed, "account %s transaction [%d] verify failed: signature is not applied to transaction", accountID, i)
+				}
+				continue
 			}
+			if err := checkKeySignature(keySignature, signedTxs[i], hashes[i]); err != nil {
+				return openwallet.Errorf(openwallet.ErrVerifyRawTransactionFailed, "account %s transaction [%d] verify failed: %v", accountID, i, err)
+			}
+		}
+	}
 
-			txBase64 := base64.StdEncoding.WithPadding(base64.StdPadding).EncodeToString(rawTxHex)
-			rawTx.RawHex = txBase64
-			break
-
+	//签名公钥须为签名账户在链上的访问密钥
+	for i, signedTx := range signedTxs {
+		if signedTx == nil {
+			continue
+		}
+		if err := decoder.checkAccessKey(ctx, signedTx); err != nil {
+			return openwallet.Errorf(openwallet.ErrVerifyRawTransactionFailed, "transaction [%d] verify failed: %v", i, err)
 		}
 	}
 
@@ -233,20 +357,85 @@ func (decoder *TransactionDecoder) VerifyRawTransaction(wrapper openwallet.Walle
 
 //SendRawTransaction 广播交易单
 func (decoder *TransactionDecoder) SubmitRawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) (*openwallet.Transaction, error) {
-	param := []interface{}{rawTx.RawHex}
-	result, err := decoder.wm.client.Call("broadcast_tx_commit", param)
+	return decoder.SubmitRawTransactionContext(context.Background(), wrapper, rawTx)
+}
+
+//SubmitRawTransactionContext 广播交易单，上下文取消时停止广播后续交易和轮询执行结果
+func (decoder *TransactionDecoder) SubmitRawTransactionContext(ctx context.Context, wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) (*openwallet.Transaction, error) {
+
+	if err := decoder.checkRawTransactionExpiry(ctx, rawTx); err != nil {
+		return nil, openwallet.Errorf(openwallet.ErrSubmitRawTransactionFailed, "%v", err)
+	}
+
+	nearTxs, err := decodeRawTransactions(rawTx.RawHex)
 	if err != nil {
-		return nil, err
+		return nil, openwallet.Errorf(openwallet.ErrSubmitRawTransactionFailed, "raw tx Unmarshal failed=%s", err)
+	}
+
+	multisig := isMultisigRawTransaction(rawTx)
+	var unusedTxs []*neartransaction.Transaction
+	if multisig {
+		nearTxs, unusedTxs, err = selectMultisigTransactions(nearTxs, rawTx.Required)
+		if err != nil {
+			return nil, openwallet.Errorf(openwallet.ErrSubmitRawTransactionFailed, "%v", err)
+		}
+		//未选中的成员交易不会再广播，无论广播结果如何都释放nonce
+		defer decoder.releaseNonces(unusedTxs)
 	}
-	txId := result.Get("transaction.hash").String()
-	if txId == "" {
-		return nil, errors.New("submit transaction fail")
+
+	//批量交易按nonce顺序依次广播
+	txIDs := make([]string, 0, len(nearTxs))
+	results := make([]*TransactionResult, 0, len(nearTxs))
+	for i, nearTx := range nearTxs {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			//上下文已取消，剩余交易都未广播
+			rawTx.IsSubmit = len(txIDs) > 0
+			decoder.releaseNonces(nearTxs[i:])
+			return nil, openwallet.Errorf(openwallet.ErrSubmitRawTransactionFailed, "submit canceled before transaction with nonce %d, submitted: %v, err: %v", nearTx.Nonce, txIDs, ctxErr)
+		}
+		txId, result, err := decoder.broadcastTransaction(ctx, nearTx)
+		if err != nil && isAlreadyProcessedError(err) {
+			//重复提交，按本地交易哈希查询已上链的交易
+			txId, result, err = decoder.lookupProcessedTransaction(ctx, nearTx, err)
+		}
+		if err != nil {
+			rawTx.IsSubmit = len(txIDs) > 0
+			//后续交易未广播，释放nonce；本笔交易可能已到达节点，保留nonce
+			decoder.releaseNonces(nearTxs[i+1:])
+			if failure := FailureFromError(err); failure != nil && failure.IsInvalidTxError() {
+				//无效交易未上链，释放未使用的nonce
+				decoder.releaseNonces(nearTxs[i : i+1])
+				rawTx.SetExtParam(extParamExecutionFailure, failure)
+				return nil, openwallet.Errorf(openwallet.ErrSubmitRawTransactionFailed, "transaction with nonce %d is invalid, submitted: %v, failure: %v", nearTx.Nonce, txIDs, failure)
+			}
+			if len(txIDs) > 0 {
+				return nil, openwallet.Errorf(openwallet.ErrSubmitRawTransactionFailed, "submit transaction with nonce %d failed, submitted: %v, unexpected err: %v", nearTx.Nonce, txIDs, err)
+			}
+			return nil, err
+		}
+		decoder.wm.Logger.Info("transaction submitted", F("txid", txId), F("account", rawTx.Account.AccountID), F("nonce", nearTx.Nonce))
+		txIDs = append(txIDs, txId)
+		results = append(results, result)
+	}
+
+	//异步广播，全部广播后再轮询执行结果
+	for i, result := range results {
+		if result == nil {
+			results[i] = decoder.wm.TxPoller.WaitFinalContext(ctx, txIDs[i], nearTxs[i].SignerID)
+		}
 	}
-	log.Infof("Transaction [%s] submitted to the network successfully.", txId)
 
-	rawTx.TxID = txId
+	rawTx.TxID = txIDs[0]
 	rawTx.IsSubmit = true
 
+	//交易已上链但执行失败，手续费已扣除
+	for _, result := range results {
+		if result.IsFailure() {
+			rawTx.SetExtParam(extParamExecutionFailure, result.Failure)
+			return nil, openwallet.Errorf(openwallet.ErrSubmitRawTransactionFailed, "transaction [%s] execution failed: %v", result.TxID, result.Failure)
+		}
+	}
+
 	decimals := decoder.wm.Decimal()
 
 	//记录一个交易单
@@ -262,18 +451,221 @@ func (decoder *TransactionDecoder) SubmitRawTransaction(wrapper openwallet.Walle
 		SubmitTime: time.Now().Unix(),
 	}
 
+	//批量转账记录全部txid
+	if len(txIDs) > 1 {
+		tx.SetExtParam("txIDs", txIDs)
+	}
+
+	if multisig {
+		ext := rawTx.GetExtParam()
+		tx.SetExtParam(extParamMultisigAccount, ext.Get(extParamMultisigAccount).String())
+		tx.SetExtParam(extParamMultisigMethod, ext.Get(extParamMultisigMethod).String())
+		requestID := ext.Get(extParamMultisigRequestID)
+		if id, ok := parseMultisigRequestID(results[0]); ok && !requestID.Exists() {
+			//add_request返回新请求的ID
+			rawTx.SetExtParam(extParamMultisigRequestID, id)
+			tx.SetExtParam(extParamMultisigRequestID, id)
+		} else if requestID.Exists() {
+			tx.SetExtParam(extParamMultisigRequestID, requestID.Uint())
+		}
+	}
+
+	decoder.setTransactionResults(tx, results)
+
 	tx.WxID = openwallet.GenTransactionWxID(tx)
 
 	return tx, nil
 }
 
+//broadcastTransaction 广播交易，返回本地计算的交易哈希。
+//同步广播返回执行结果；异步广播或同步广播超时返回nil结果，需轮询。
+func (decoder *TransactionDecoder) broadcastTransaction(ctx context.Context, nearTx *neartransaction.Transaction) (string, *TransactionResult, error) {
+	txId, err := nearTx.Hash()
+	if err != nil {
+		return "", nil, err
+	}
+	_, _, err = nearTx.Serialize()
+	if err != nil {
+		return "", nil, err
+	}
+	txBase64 := base64.StdEncoding.WithPadding(base64.StdPadding).EncodeToString(nearTx.RawTxByte)
+	param := []interface{}{txBase64}
+
+	if decoder.wm.Config.BroadcastAsync {
+		result, err := decoder.wm.client.CallContext(ctx, "broadcast_tx_async", param)
+		if err != nil {
+			return "", nil, err
+		}
+		if result.String() != txId {
+			return "", nil, fmt.Errorf("broadcast transaction hash: %s is not equal to local hash: %s", result.String(), txId)
+		}
+		return txId, nil, nil
+	}
+
+	result, err := decoder.wm.client.CallContext(ctx, "broadcast_tx_commit", param)
+	if err != nil {
+		//上下文取消时请求可能未发出，不能当作已广播
+		if ctx.Err() != nil {
+			return "", nil, err
+		}
+		//节点等待执行超时，交易已被节点接收，改为轮询
+		if isTimeoutError(err) {
+			decoder.wm.Logger.Warn("transaction broadcast timeout, waiting for status", F("txid", txId), F("error", err))
+			return txId, nil, nil
+		}
+		return "", nil, err
+	}
+	if result.Get("transaction.hash").String() != txId {
+		return "", nil, errors.New("submit transaction fail")
+	}
+	txResp := TransactionStatus{}
+	err = json.Unmarshal([]byte(result.Raw), &txResp)
+	if err != nil {
+		return "", nil, err
+	}
+	txResult, err := decoder.wm.TxPoller.newTransactionResult(txId, txResp)
+	if err != nil {
+		return "", nil, err
+	}
+	return txId, txResult, nil
+}
+
+//setTransactionResults 记录执行状态、回执和实际燃烧的手续费，未完成的交易状态留空
+func (decoder *TransactionDecoder) setTransactionResults(tx *openwallet.Transaction, results []*TransactionResult) {
+	var (
+		final    = true
+		status   = openwallet.TxStatusSuccess
+		fees     = decimal.Zero
+		receipts = make(map[string][]string)
+	)
+	for _, result := range results {
+		receipts[result.TxID] = result.ReceiptIDs
+		if !result.Final {
+			final = false
+			continue
+		}
+		if result.IsFailure() {
+			status = openwallet.TxStatusFail
+		}
+		burnt, _ := decimal.NewFromString(result.TokensBurnt)
+		fees = fees.Add(burnt)
+	}
+	tx.SetExtParam("receipts", receipts)
+	if !final {
+		return
+	}
+	tx.Status = status
+	tx.Fees = fees.String()
+}
+
+//lookupProcessedTransaction 节点拒绝重复交易时，按本地交易哈希查询，交易存在则视为提交成功
+func (decoder *TransactionDecoder) lookupProcessedTransaction(ctx context.Context, nearTx *neartransaction.Transaction, broadcastErr error) (string, *TransactionResult, error) {
+	txId, err := nearTx.Hash()
+	if err != nil {
+		return "", nil, err
+	}
+	result, err := decoder.wm.TxPoller.QueryTransactionContext(ctx, txId, nearTx.SignerID)
+	if err != nil {
+		return "", nil, broadcastErr
+	}
+	decoder.wm.Logger.Warn("transaction has already been processed", F("txid", txId), F("error", broadcastErr))
+	if !result.Final {
+		return txId, nil, nil
+	}
+	return txId, result, nil
+}
+
+//nonceKey 预留nonce的签名者和访问密钥
+type nonceKey struct{ accountID, publicKey string }
+
+func newNonceKey(nearTx *neartransaction.Transaction) nonceKey {
+	return nonceKey{nearTx.SignerID, neartransaction.FormatPublicKey(nearTx.PublicKey)}
+}
+
+//releaseNonces 释放未上链交易预留的nonce，多签交易按成员密钥分别释放
+func (decoder *TransactionDecoder) releaseNonces(nearTxs []*neartransaction.Transaction) {
+	keys := make([]nonceKey, 0)
+	nonces := make(map[nonceKey][]uint64)
+	for _, nearTx := range nearTxs {
+		key := newNonceKey(nearTx)
+		if _, exist := nonces[key]; !exist {
+			keys = append(keys, key)
+		}
+		nonces[key] = append(nonces[key], nearTx.Nonce)
+	}
+	for _, key := range keys {
+		if err := decoder.wm.NonceManager.Release(key.accountID, key.publicKey, nonces[key]...); err != nil {
+			decoder.wm.Logger.Warn("release nonces failed", F("account", key.accountID), F("publicKey", key.publicKey), F("nonces", nonces[key]), F("error", err))
+		}
+	}
+}
+
+//selectMultisigTransactions 多签交易单只广播前Required笔已签名的成员交易，返回其余未广播的交易
+func selectMultisigTransactions(nearTxs []*neartransaction.Transaction, required uint64) ([]*neartransaction.Transaction, []*neartransaction.Transaction, error) {
+	selected := make([]*neartransaction.Transaction, 0, required)
+	unused := make([]*neartransaction.Transaction, 0, len(nearTxs))
+	for _, nearTx := range nearTxs {
+		if len(nearTx.Signature) > 0 && uint64(len(selected)) < required {
+			selected = append(selected, nearTx)
+		} else {
+			unused = append(unused, nearTx)
+		}
+	}
+	if len(selected) == 0 || uint64(len(selected)) < required {
+		return nil, nil, fmt.Errorf("multisig transaction requires %d signatures, got %d", required, len(selected))
+	}
+	return selected, unused, nil
+}
+
+//setRawTransactionTxIDs 广播前记录本地计算的交易哈希，批量交易记录全部txid
+func setRawTransactionTxIDs(rawTx *openwallet.RawTransaction, nearTxs []*neartransaction.Transaction) error {
+	txIDs := make([]string, 0, len(nearTxs))
+	for _, nearTx := range nearTxs {
+		txId, err := nearTx.Hash()
+		if err != nil {
+			return err
+		}
+		txIDs = append(txIDs, txId)
+	}
+	rawTx.TxID = txIDs[0]
+	if len(txIDs) > 1 {
+		return rawTx.SetExtParam("txIDs", txIDs)
+	}
+	return nil
+}
+
+//isAlreadyProcessedError 交易已被处理或重复提交，nonce已被使用也可能是同一笔交易已上链
+func isAlreadyProcessedError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, keyword := range []string{"already processed", "already known", "duplicate", "invalidnonce"} {
+		if strings.Contains(msg, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+//isTimeoutError 节点处理超时，不代表交易失败
+func isTimeoutError(err error) bool {
+	return strings.Contains(strings.ToLower(err.Error()), "timeout")
+}
+
 //汇总币种
 func (decoder *TransactionDecoder) CreateSummaryRawTransaction(wrapper openwallet.WalletDAI, sumRawTx *openwallet.SummaryRawTransaction) ([]*openwallet.RawTransaction, error) {
-	return decoder.CreateSimpleSummaryRawTransaction(wrapper, sumRawTx)
+	return decoder.CreateSummaryRawTransactionContext(context.Background(), wrapper, sumRawTx)
+}
+
+//CreateSummaryRawTransactionContext 汇总币种，上下文取消时停止创建后续汇总交易并返回错误
+func (decoder *TransactionDecoder) CreateSummaryRawTransactionContext(ctx context.Context, wrapper openwallet.WalletDAI, sumRawTx *openwallet.SummaryRawTransaction) ([]*openwallet.RawTransaction, error) {
+	return decoder.createSimpleSummaryRawTransaction(ctx, wrapper, sumRawTx)
 }
 
 //CreateSummaryRawTransaction 创建RIA汇总交易
 func (decoder *TransactionDecoder) CreateSimpleSummaryRawTransaction(wrapper openwallet.WalletDAI, sumRawTx *openwallet.SummaryRawTransaction) ([]*openwallet.RawTransaction, error) {
+	return decoder.createSimpleSummaryRawTransaction(context.Background(), wrapper, sumRawTx)
+}
+
+func (decoder *TransactionDecoder) createSimpleSummaryRawTransaction(ctx context.Context, wrapper openwallet.WalletDAI, sumRawTx *openwallet.SummaryRawTransaction) ([]*openwallet.RawTransaction, error) {
 
 	var (
 		rawTxArray         = make([]*openwallet.RawTransaction, 0)
@@ -298,16 +690,11 @@ func (decoder *TransactionDecoder) CreateSimpleSummaryRawTransaction(wrapper ope
 	if len(addresses) == 0 {
 		return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "[%s] have not addresses", accountID)
 	}
-	gasPriceStr, err := decoder.wm.Blockscanner.GetGasPrice()
-	if err != nil {
-		return nil, err
-	}
-	gasPrice, err := decimal.NewFromString(gasPriceStr)
+	gasPrice, err := decoder.getFeeRate(ctx, sumRawTx.FeeRate)
 	if err != nil {
 		return nil, err
 	}
-	estimateFees = gasPrice.Mul(decimal.New(424555062500*2, 1)).Div(decimal.New(1, Decimal))
-	log.Info("estimateFees:", estimateFees)
+
 	//Accounts must have enough tokens cover its storage.
 	//Storage cost per byte is 0.0001 NEAR and an account with one access key must maintain a balance of at least 0.0182 NEAR. For more details, see
 	//账户一般消耗182
@@ -316,7 +703,10 @@ func (decoder *TransactionDecoder) CreateSimpleSummaryRawTransaction(wrapper ope
 
 	for _, addr := range addresses {
 
-		balance, _ := decoder.wm.Blockscanner.GetBalanceByAddress(addr.Address)
+		balance, err := decoder.wm.Blockscanner.GetBalanceByAddressContext(ctx, addr.Address)
+		if err != nil {
+			return nil, err
+		}
 		if len(balance) == 0 {
 			continue
 		}
@@ -327,6 +717,9 @@ func (decoder *TransactionDecoder) CreateSimpleSummaryRawTransaction(wrapper ope
 		if addrBalance_BI.Cmp(minTransfer) < 0 || addrBalance_BI.Cmp(decimal.Zero) <= 0 {
 			continue
 		}
+		//汇总地址可能是本地址，按实际签名者估算
+		estimateFees = decoder.estimateTransferFee(ctx, addr.Address, sumRawTx.SummaryAddress, "0", gasPrice)
+
 		//计算汇总数量 = 余额 - 保留余额 - 减去手续费
 		summaryAmount := addrBalance_BI.Sub(retainedBalance).Sub(estimateFees)
 
@@ -334,9 +727,7 @@ func (decoder *TransactionDecoder) CreateSimpleSummaryRawTransaction(wrapper ope
 			continue
 		}
 
-		decoder.wm.Log.Debugf("balance: %v", addrBalance_BI.String())
-		decoder.wm.Log.Debugf("fees: %v", estimateFees)
-		decoder.wm.Log.Debugf("sumAmount: %v", summaryAmount)
+		decoder.wm.Logger.Debug("summary", F("balance", addrBalance_BI.String()), F("fees", estimateFees), F("sumAmount", summaryAmount))
 
 		//创建一笔交易单
 		rawTx := &openwallet.RawTransaction{
@@ -345,12 +736,14 @@ func (decoder *TransactionDecoder) CreateSimpleSummaryRawTransaction(wrapper ope
 			To: map[string]string{
 				sumRawTx.SummaryAddress: summaryAmount.String(),
 			},
+			FeeRate:  sumRawTx.FeeRate,
 			Required: 1,
 		}
 
 		findAddrBalance := NewAddrBalance(balance[0])
 
 		createErr := decoder.createRawTransaction(
+			ctx,
 			wrapper,
 			rawTx,
 			findAddrBalance,
@@ -367,79 +760,131 @@ func (decoder *TransactionDecoder) CreateSimpleSummaryRawTransaction(wrapper ope
 	return rawTxArray, nil
 }
 
-//createRawTransaction
+//createRawTransaction 按接收者拆分为多笔交易，同一签名者nonce依次递增
 func (decoder *TransactionDecoder) createRawTransaction(
+	ctx context.Context,
 	wrapper openwallet.WalletDAI,
 	rawTx *openwallet.RawTransaction,
 	addrBalance *AddrBalance,
-) error {
+) (err error) {
 
 	var (
 		accountTotalSent = decimal.Zero
+		totalSent        = decimal.Zero
+		totalFees        = decimal.Zero
 		txFrom           = make([]string, 0)
 		txTo             = make([]string, 0)
 		keySignList      = make([]*openwallet.KeySignature, 0)
-		amountStr        string
-		destination      string
+		nearTxs          = make([]*neartransaction.Transaction, 0)
+		destinations     = make([]string, 0, len(rawTx.To))
 	)
 
 	decimals := decoder.wm.Decimal()
-	for k, v := range rawTx.To {
-		destination = k
-		amountStr = v
-		break
+	for k := range rawTx.To {
+		destinations = append(destinations, k)
 	}
+	sort.Strings(destinations)
 
-	//计算账户的实际转账amount
-	accountTotalSentAddresses, findErr := wrapper.GetAddressList(0, -1, "AccountID", rawTx.Account.AccountID, "Address", destination)
-	if findErr != nil || len(accountTotalSentAddresses) == 0 {
-		amountDec, _ := decimal.NewFromString(amountStr)
-		accountTotalSent = accountTotalSent.Add(amountDec)
+	gasPrice, err := decoder.getFeeRate(ctx, rawTx.FeeRate)
+	if err != nil {
+		return err
 	}
 
 	addr, err := wrapper.GetAddress(addrBalance.Address)
 	if err != nil {
 		return err
 	}
-	accountNonce, err := decoder.wm.Blockscanner.GetAccountNonce(addrBalance.Address)
+	refBlock, err := decoder.wm.Blockscanner.GetLatestRefBlockContext(ctx)
 	if err != nil {
 		return err
 	}
-	refBlockHash, err := decoder.wm.Blockscanner.GetLatestRefBlockHash()
-	nearTx, err := neartransaction.NewTransaction(addrBalance.Address, destination, refBlockHash, amountStr, accountNonce+1)
+
+	//签名密钥取自钱包地址的公钥，支持命名账户
+	signingKey, err := ParsePublicKey(addr.PublicKey)
 	if err != nil {
-		return err
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "invalid public key of address %s: %v", addrBalance.Address, err)
 	}
 
-	_, hash, err := nearTx.Serialize()
+	//本地预留nonce，避免并发创建的交易使用相同nonce
+	publicKey := neartransaction.FormatPublicKey(signingKey)
+	firstNonce, err := decoder.wm.NonceManager.ReserveContext(ctx, addrBalance.Address, publicKey, len(destinations), refBlock.Height)
 	if err != nil {
 		return err
 	}
-	var buf []byte
+	reservedNonces := make([]uint64, 0, len(destinations))
+	for i := range destinations {
+		reservedNonces = append(reservedNonces, firstNonce+uint64(i))
+	}
+	defer func() {
+		if err != nil {
+			decoder.wm.NonceManager.Release(addrBalance.Address, publicKey, reservedNonces...)
+		}
+	}()
+
+	for i, destination := range destinations {
+		amountStr := rawTx.To[destination]
+		amountDec, _ := decimal.NewFromString(amountStr)
+
+		//计算账户的实际转账amount
+		accountTotalSentAddresses, findErr := wrapper.GetAddressList(0, -1, "AccountID", rawTx.Account.AccountID, "Address", destination)
+		if findErr != nil || len(accountTotalSentAddresses) == 0 {
+			accountTotalSent = accountTotalSent.Add(amountDec)
+		}
+
+		nonce := reservedNonces[i]
+		var nearTx *neartransaction.Transaction
+		nearTx, err = neartransaction.NewTransactionWithSigner(addrBalance.Address, signingKey, destination, refBlock.Hash, nonce,
+			neartransaction.NewTransferAction(common.StringNumToBigIntWithExp(amountStr, Decimal)))
+		if err != nil {
+			return err
+		}
+
+		var hash string
+		_, hash, err = nearTx.Serialize()
+		if err != nil {
+			return err
+		}
+
+		signature := openwallet.KeySignature{
+			EccType: decoder.wm.Config.CurveType,
+			Nonce:   strconv.FormatUint(nonce, 10),
+			Address: addr,
+			Message: hash,
+		}
+		keySignList = append(keySignList, &signature)
+
+		//按交易动作估算燃烧的手续费
+		gas := decoder.wm.FeeEstimator.EstimateGasContext(ctx, nearTx.SignerID, nearTx.ReceiverID, nearTx.Actions)
+		totalFees = totalFees.Add(GasToNear(gas, gasPrice))
+
+		totalSent = totalSent.Add(amountDec)
+		txTo = append(txTo, destination+":"+amountDec.String())
+		nearTxs = append(nearTxs, nearTx)
+	}
+	txFrom = append(txFrom, addrBalance.Address+":"+totalSent.String())
 
-	if buf, err = json.Marshal(nearTx); err != nil {
+	rawTx.RawHex, err = encodeRawTransactions(nearTxs)
+	if err != nil {
+		return err
+	}
+	err = decoder.setRefBlock(ctx, rawTx, refBlock)
+	if err != nil {
+		return err
+	}
+	err = setRawTransactionTxIDs(rawTx, nearTxs)
+	if err != nil {
 		return err
 	}
-	rawTx.RawHex = hex.EncodeToString(buf)
 	if rawTx.Signatures == nil {
 		rawTx.Signatures = make(map[string][]*openwallet.KeySignature)
 	}
 
-	signature := openwallet.KeySignature{
-		EccType: decoder.wm.Config.CurveType,
-		Address: addr,
-		Message: hash,
-	}
-	keySignList = append(keySignList, &signature)
-
-	//固定费用
-	feesAmount, _ := decimal.NewFromString("0")
 	//主币加上交易费
 	accountTotalSent = decimal.Zero.Sub(accountTotalSent)
 
 	rawTx.Signatures[rawTx.Account.AccountID] = keySignList
-	rawTx.FeeRate = feesAmount.String()
-	rawTx.Fees = feesAmount.String()
+	rawTx.FeeRate = gasPrice.String()
+	rawTx.Fees = totalFees.String()
 	rawTx.IsBuilt = true
 	rawTx.TxAmount = accountTotalSent.StringFixed(decimals)
 	rawTx.TxFrom = txFrom
@@ -448,10 +893,235 @@ func (decoder *TransactionDecoder) createRawTransaction(
 	return nil
 }
 
+//RebuildRawTransaction 引用区块过期的交易单重新选择引用区块和nonce，按当前gas价格重新估算手续费，重建后需要重新签名
+func (decoder *TransactionDecoder) RebuildRawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) error {
+	return decoder.RebuildRawTransactionContext(context.Background(), wrapper, rawTx)
+}
+
+//RebuildRawTransactionContext 重建交易单，上下文取消时中断节点查询
+func (decoder *TransactionDecoder) RebuildRawTransactionContext(ctx context.Context, wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) (err error) {
+
+	nearTxs, err := decodeRawTransactions(rawTx.RawHex)
+	if err != nil {
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "raw tx Unmarshal failed=%s", err)
+	}
+
+	keySignatures := rawTx.Signatures[rawTx.Account.AccountID]
+	if len(keySignatures) != len(nearTxs) {
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "transaction signature count %d not match transaction count %d", len(keySignatures), len(nearTxs))
+	}
+
+	refBlock, err := decoder.wm.Blockscanner.GetLatestRefBlockContext(ctx)
+	if err != nil {
+		return err
+	}
+	refBlockHash, err := base58.Decode(refBlock.Hash)
+	if err != nil {
+		return err
+	}
+	//原交易单的FeeRate是创建时的gas价格，不作为上限
+	gasPrice, err := decoder.getFeeRate(ctx, "")
+	if err != nil {
+		return err
+	}
+
+	//按签名者和访问密钥分别预留nonce，多签交易单的成员交易使用各自密钥的nonce
+	oldTxs := make([]*neartransaction.Transaction, 0, len(nearTxs))
+	keyTxs := make(map[nonceKey][]*neartransaction.Transaction)
+	keys := make([]nonceKey, 0)
+	for _, nearTx := range nearTxs {
+		oldTxs = append(oldTxs, &neartransaction.Transaction{SignerID: nearTx.SignerID, PublicKey: nearTx.PublicKey, Nonce: nearTx.Nonce})
+		key := newNonceKey(nearTx)
+		if _, exist := keyTxs[key]; !exist {
+			keys = append(keys, key)
+		}
+		keyTxs[key] = append(keyTxs[key], nearTx)
+	}
+
+	reservedTxs := make([]*neartransaction.Transaction, 0, len(nearTxs))
+	defer func() {
+		if err != nil {
+			decoder.releaseNonces(reservedTxs)
+		}
+	}()
+	for _, key := range keys {
+		var firstNonce uint64
+		firstNonce, err = decoder.wm.NonceManager.ReserveContext(ctx, key.accountID, key.publicKey, len(keyTxs[key]), refBlock.Height)
+		if err != nil {
+			return err
+		}
+		for j, nearTx := range keyTxs[key] {
+			nearTx.Nonce = firstNonce + uint64(j)
+			reservedTxs = append(reservedTxs, nearTx)
+		}
+	}
+
+	for i, nearTx := range nearTxs {
+		nearTx.BlockHash = refBlockHash
+		nearTx.Signature = nil
+		var hash string
+		_, hash, err = nearTx.Serialize()
+		if err != nil {
+			return err
+		}
+		keySignatures[i].Nonce = strconv.FormatUint(nearTx.Nonce, 10)
+		keySignatures[i].Message = hash
+		keySignatures[i].Signature = ""
+	}
+
+	//多签交易单只广播Required笔成员交易
+	feeTxs := nearTxs
+	if isMultisigRawTransaction(rawTx) && uint64(len(feeTxs)) > rawTx.Required {
+		feeTxs = feeTxs[:rawTx.Required]
+	}
+	totalFees := decimal.Zero
+	for _, nearTx := range feeTxs {
+		gas := decoder.wm.FeeEstimator.EstimateGasContext(ctx, nearTx.SignerID, nearTx.ReceiverID, nearTx.Actions)
+		totalFees = totalFees.Add(GasToNear(gas, gasPrice))
+	}
+
+	rawTx.RawHex, err = encodeRawTransactions(nearTxs)
+	if err != nil {
+		return err
+	}
+	err = decoder.setRefBlock(ctx, rawTx, refBlock)
+	if err != nil {
+		return err
+	}
+	err = setRawTransactionTxIDs(rawTx, nearTxs)
+	if err != nil {
+		return err
+	}
+	rawTx.FeeRate = gasPrice.String()
+	rawTx.Fees = totalFees.String()
+	rawTx.IsCompleted = false
+
+	//旧交易不会再广播，释放原来的nonce
+	decoder.releaseNonces(oldTxs)
+
+	return nil
+}
+
+//setRefBlock 记录引用区块和过期高度
+func (decoder *TransactionDecoder) setRefBlock(ctx context.Context, rawTx *openwallet.RawTransaction, refBlock *BlockHeader) error {
+	expiryHeight := refBlock.Height + decoder.wm.Blockscanner.GetTxValidityPeriodContext(ctx)
+	if err := rawTx.SetExtParam(extParamRefBlockHash, refBlock.Hash); err != nil {
+		return err
+	}
+	if err := rawTx.SetExtParam(extParamRefBlockHeight, refBlock.Height); err != nil {
+		return err
+	}
+	return rawTx.SetExtParam(extParamExpiryHeight, expiryHeight)
+}
+
+//checkRawTransactionExpiry 引用区块已过期的交易会被节点拒绝，需要重建交易单
+func (decoder *TransactionDecoder) checkRawTransactionExpiry(ctx context.Context, rawTx *openwallet.RawTransaction) error {
+	expiryHeight := rawTx.GetExtParam().Get(extParamExpiryHeight).Uint()
+	if expiryHeight == 0 {
+		return nil
+	}
+	currentHeight, err := decoder.wm.Blockscanner.GetCurrentBlockContext(ctx)
+	if err != nil {
+		return err
+	}
+	if currentHeight >= expiryHeight {
+		return fmt.Errorf("transaction reference block expired at height %d, current height %d, rebuild the transaction", expiryHeight, currentHeight)
+	}
+	return nil
+}
+
+//EstimateRawTransactionFee 预估手续费
+func (decoder *TransactionDecoder) EstimateRawTransactionFee(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) error {
+	return decoder.EstimateRawTransactionFeeContext(context.Background(), wrapper, rawTx)
+}
+
+//EstimateRawTransactionFeeContext 预估手续费
+func (decoder *TransactionDecoder) EstimateRawTransactionFeeContext(ctx context.Context, wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) error {
+
+	gasPrice, err := decoder.getFeeRate(ctx, rawTx.FeeRate)
+	if err != nil {
+		return err
+	}
+
+	//尚未选择付款地址，取账户的第一个地址作为签名者
+	addresses, err := wrapper.GetAddressList(0, 1, "AccountID", rawTx.Account.AccountID)
+	if err != nil {
+		return err
+	}
+	if len(addresses) == 0 {
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "[%s] have not addresses", rawTx.Account.AccountID)
+	}
+	totalFees := decoder.estimateTransferFees(ctx, addresses[0].Address, rawTx.To, gasPrice)
+
+	rawTx.FeeRate = gasPrice.String()
+	rawTx.Fees = totalFees.String()
+
+	return nil
+}
+
+//GetRawTransactionFeeRate 获取交易单的费率，即当前gas价格（yoctoNEAR/gas）
+func (decoder *TransactionDecoder) GetRawTransactionFeeRate() (feeRate string, unit string, err error) {
+	return decoder.GetRawTransactionFeeRateContext(context.Background())
+}
+
+//GetRawTransactionFeeRateContext 获取交易单的费率
+func (decoder *TransactionDecoder) GetRawTransactionFeeRateContext(ctx context.Context) (feeRate string, unit string, err error) {
+	gasPrice, err := decoder.wm.Blockscanner.GetGasPriceContext(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	return gasPrice, "gas", nil
+}
+
+//getFeeRate 获取当前gas价格，maxFeeRate为调用者可接受的最高gas价格，为空则不限制
+func (decoder *TransactionDecoder) getFeeRate(ctx context.Context, maxFeeRate string) (decimal.Decimal, error) {
+	gasPriceStr, _, err := decoder.GetRawTransactionFeeRateContext(ctx)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	gasPrice, err := decimal.NewFromString(gasPriceStr)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	if len(maxFeeRate) > 0 {
+		maxGasPrice, err := decimal.NewFromString(maxFeeRate)
+		if err != nil {
+			return decimal.Zero, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "invalid fee rate: %s", maxFeeRate)
+		}
+		if gasPrice.GreaterThan(maxGasPrice) {
+			return decimal.Zero, openwallet.Errorf(openwallet.ErrInsufficientFees, "current gas price %s exceeds fee rate limit %s", gasPrice.String(), maxFeeRate)
+		}
+	}
+	return gasPrice, nil
+}
+
+//estimateTransferFees 估算签名者向每个接收者各转账一笔的手续费合计，单位NEAR
+func (decoder *TransactionDecoder) estimateTransferFees(ctx context.Context, from string, to map[string]string, gasPrice decimal.Decimal) decimal.Decimal {
+	totalFees := decimal.Zero
+	for receiver, amount := range to {
+		totalFees = totalFees.Add(decoder.estimateTransferFee(ctx, from, receiver, amount, gasPrice))
+	}
+	return totalFees
+}
+
+//estimateTransferFee 估算单笔转账的手续费，单位NEAR，签名者与接收者相同时按sir费用计算
+func (decoder *TransactionDecoder) estimateTransferFee(ctx context.Context, from, to, amount string, gasPrice decimal.Decimal) decimal.Decimal {
+	actions := []neartransaction.Action{
+		neartransaction.NewTransferAction(common.StringNumToBigIntWithExp(amount, Decimal)),
+	}
+	gas := decoder.wm.FeeEstimator.EstimateGasContext(ctx, from, to, actions)
+	return GasToNear(gas, gasPrice)
+}
+
 //CreateSummaryRawTransactionWithError 创建汇总交易，返回能原始交易单数组（包含带错误的原始交易单）
 func (decoder *TransactionDecoder) CreateSummaryRawTransactionWithError(wrapper openwallet.WalletDAI, sumRawTx *openwallet.SummaryRawTransaction) ([]*openwallet.RawTransactionWithError, error) {
+	return decoder.CreateSummaryRawTransactionWithErrorContext(context.Background(), wrapper, sumRawTx)
+}
+
+//CreateSummaryRawTransactionWithErrorContext 创建汇总交易，上下文取消时返回错误
+func (decoder *TransactionDecoder) CreateSummaryRawTransactionWithErrorContext(ctx context.Context, wrapper openwallet.WalletDAI, sumRawTx *openwallet.SummaryRawTransaction) ([]*openwallet.RawTransactionWithError, error) {
 	raTxWithErr := make([]*openwallet.RawTransactionWithError, 0)
-	rawTxs, err := decoder.CreateSummaryRawTransaction(wrapper, sumRawTx)
+	rawTxs, err := decoder.CreateSummaryRawTransactionContext(ctx, wrapper, sumRawTx)
 	if err != nil {
 		return nil, err
 	}
@@ -463,3 +1133,28 @@ func (decoder *TransactionDecoder) CreateSummaryRawTransactionWithError(wrapper
 	}
 	return raTxWithErr, nil
 }
+
+//encodeRawTransactions RawHex为交易列表json的hex编码，每个接收者一笔交易
+func encodeRawTransactions(nearTxs []*neartransaction.Transaction) (string, error) {
+	buf, err := json.Marshal(nearTxs)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+//decodeRawTransactions 解析RawHex中的交易列表
+func decodeRawTransactions(rawHex string) ([]*neartransaction.Transaction, error) {
+	buf, err := hex.DecodeString(rawHex)
+	if err != nil {
+		return nil, err
+	}
+	nearTxs := make([]*neartransaction.Transaction, 0)
+	if err := json.Unmarshal(buf, &nearTxs); err != nil {
+		return nil, err
+	}
+	if len(nearTxs) == 0 {
+		return nil, errors.New("raw transaction is empty")
+	}
+	return nearTxs, nil
+}
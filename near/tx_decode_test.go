@@ -1,5 +1,90 @@
 package near
 
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Assetsadapter/near-adapter/neartransaction"
+	"github.com/astaxie/beego/config"
+	"github.com/blocktree/openwallet/openwallet"
+	"github.com/mr-tron/base58"
+	"github.com/shopspring/decimal"
+)
+
+func TestEncodeRawTransactions(t *testing.T) {
+	from := "c1a8d5c6ad2b3ff8a0e10d0f8a5d6c0c1e6d6a2f0f8a0e10d0f8a5d6c0c1e6d6"
+	refBlockHash := "GJ6h4kQhDwDbmsuyvVFYVjD9WPzj6ERtGDTEUBZcmvHu"
+	nearTxs := make([]*neartransaction.Transaction, 0)
+	for i, to := range []string{"a.near", "b.near"} {
+		nearTx, err := neartransaction.NewTransaction(from, to, refBlockHash, "1.5", uint64(10+i))
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+			return
+		}
+		nearTxs = append(nearTxs, nearTx)
+	}
+
+	rawHex, err := encodeRawTransactions(nearTxs)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+	decoded, err := decodeRawTransactions(rawHex)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+	if len(decoded) != len(nearTxs) {
+		t.Errorf("unexpected transaction count: %d", len(decoded))
+		return
+	}
+	for i := range nearTxs {
+		_, hash1, _ := nearTxs[i].Serialize()
+		_, hash2, _ := decoded[i].Serialize()
+		if hash1 != hash2 || decoded[i].Nonce != uint64(10+i) {
+			t.Errorf("transaction [%d] changed after decode", i)
+		}
+	}
+}
+
+func TestSetRawTransactionTxIDs(t *testing.T) {
+	from := "c1a8d5c6ad2b3ff8a0e10d0f8a5d6c0c1e6d6a2f0f8a0e10d0f8a5d6c0c1e6d6"
+	refBlockHash := "GJ6h4kQhDwDbmsuyvVFYVjD9WPzj6ERtGDTEUBZcmvHu"
+	nearTx, _ := neartransaction.NewTransaction(from, "a.near", refBlockHash, "1.5", 10)
+	nearTx2, _ := neartransaction.NewTransaction(from, "b.near", refBlockHash, "1.5", 11)
+
+	rawTx := &openwallet.RawTransaction{}
+	if err := setRawTransactionTxIDs(rawTx, []*neartransaction.Transaction{nearTx, nearTx2}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+	txId, _ := nearTx.Hash()
+	if rawTx.TxID != txId || rawTx.GetExtParam().Get("txIDs.#").Int() != 2 {
+		t.Errorf("unexpected txid: %s, ext: %s", rawTx.TxID, rawTx.ExtParam)
+	}
+
+	//签名不影响交易哈希
+	nearTx.Signature = make([]byte, 64)
+	signedTxId, _ := nearTx.Hash()
+	if signedTxId != txId {
+		t.Errorf("txid changed after sign: %s", signedTxId)
+	}
+}
+
+func TestIsAlreadyProcessedError(t *testing.T) {
+	if !isAlreadyProcessedError(errors.New(`[-32000]Server error: {"TxExecutionError":{"InvalidTxError":{"InvalidNonce":{"tx_nonce":10,"ak_nonce":10}}}}`)) {
+		t.Errorf("invalid nonce should be checked by txid")
+	}
+	if isAlreadyProcessedError(errors.New("[-32000]Server error: NotEnoughBalance")) {
+		t.Errorf("unexpected already processed error")
+	}
+}
+
 //
 //import (
 //	"encoding/hex"
@@ -129,3 +214,265 @@ package near
 //	tx.XdrEnvelope.Signatures = append(tx.XdrEnvelope.Signatures, xdrSig)
 //	//tx.XdrEnvelope.postTransaction(tx)
 //}
+
+//testAddressWallet 提供HDKey和地址列表的钱包，按AccountID、Address、PublicKey过滤
+type testAddressWallet struct {
+	testHDKeyWallet
+	addresses []*openwallet.Address
+}
+
+func (w *testAddressWallet) GetAddressList(offset, limit int, cols ...interface{}) ([]*openwallet.Address, error) {
+	list := make([]*openwallet.Address, 0)
+	for _, address := range w.addresses {
+		match := true
+		for i := 0; i+1 < len(cols); i += 2 {
+			var value string
+			switch cols[i] {
+			case "AccountID":
+				value = address.AccountID
+			case "Address":
+				value = address.Address
+			case "PublicKey":
+				value = address.PublicKey
+			}
+			match = match && value == cols[i+1]
+		}
+		if match {
+			list = append(list, address)
+		}
+	}
+	if limit > 0 && len(list) > limit {
+		list = list[:limit]
+	}
+	return list, nil
+}
+
+func (w *testAddressWallet) GetAddress(address string) (*openwallet.Address, error) {
+	for _, a := range w.addresses {
+		if a.Address == address {
+			return a, nil
+		}
+	}
+	return nil, errors.New("address not found")
+}
+
+func TestTransactionDecoder_FeeRate(t *testing.T) {
+	//节点不支持EXPERIMENTAL_protocol_config时使用默认费用配置
+	node := newTestNode(map[string]string{"gas_price": `{"gas_price":"100000000"}`})
+	wm, clean := testWalletManager(t, node)
+	defer clean()
+	wallet := &testAddressWallet{addresses: []*openwallet.Address{{AccountID: "account", Address: "a.near"}}}
+
+	feeRate, unit, err := wm.TxDecoder.GetRawTransactionFeeRate()
+	if err != nil || feeRate != "100000000" || unit != "gas" {
+		t.Errorf("unexpected fee rate: %s %s, %v", feeRate, unit, err)
+	}
+
+	rawTx := &openwallet.RawTransaction{
+		Account: &openwallet.AssetsAccount{AccountID: "account"},
+		To:      map[string]string{"b.near": "1", "c.near": "2"},
+	}
+	if err := wm.TxDecoder.EstimateRawTransactionFee(wallet, rawTx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rawTx.FeeRate != "100000000" || rawTx.Fees != GasToNear(2*2*223182562500, decimal.New(100000000, 0)).String() {
+		t.Errorf("unexpected fees: %s, fee rate: %s", rawTx.Fees, rawTx.FeeRate)
+	}
+
+	//调用者限制的最高gas价格
+	rawTx.FeeRate = "200000000"
+	if err := wm.TxDecoder.EstimateRawTransactionFee(wallet, rawTx); err != nil || rawTx.FeeRate != "100000000" {
+		t.Errorf("gas price under limit should pass: %v", err)
+	}
+	for _, feeRate := range []string{"50000000", "abc"} {
+		rawTx.FeeRate = feeRate
+		err := wm.TxDecoder.EstimateRawTransactionFee(wallet, rawTx)
+		if err == nil {
+			t.Errorf("fee rate %s should fail", feeRate)
+			continue
+		}
+		if owErr, ok := err.(*openwallet.Error); feeRate == "50000000" && (!ok || owErr.Code() != openwallet.ErrInsufficientFees) {
+			t.Errorf("gas price over limit should report insufficient fees: %v", err)
+		}
+	}
+
+	//节点查询失败时不能返回费率
+	node.Set("gas_price", "error:server error")
+	if _, _, err := wm.TxDecoder.GetRawTransactionFeeRate(); err == nil {
+		t.Errorf("gas price query failure should fail")
+	}
+}
+
+func TestTransactionDecoder_RebuildExpiredRawTransaction(t *testing.T) {
+	refBlockHash := base58.Encode(bytes.Repeat([]byte{2}, 32))
+	wm, clean := testWalletManager(t, newTestNode(map[string]string{
+		"/status":                     `{"sync_info":{"latest_block_height":200}}`,
+		"block":                       `{"header":{"height":190,"hash":"` + refBlockHash + `"}}`,
+		"EXPERIMENTAL_genesis_config": `{"transaction_validity_period":100}`,
+		"query/view_access_key":       `{"nonce":20,"permission":"FullAccess"}`,
+		"gas_price":                   `{"gas_price":"200000000"}`,
+	}))
+	defer clean()
+
+	key, hdPath, _, publicKey := testSigningKey(t)
+	wallet := &testHDKeyWallet{key: key}
+	rawTx := testUnsignedRawTx(t, publicKey, hdPath)
+	rawTx.SetExtParam(extParamExpiryHeight, 150)
+	rawTx.FeeRate = "100000000"
+	if err := wm.TxDecoder.SignRawTransaction(wallet, rawTx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	//当前高度已超过过期高度，拒绝验证和广播
+	if err := wm.TxDecoder.VerifyRawTransaction(wallet, rawTx); err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Errorf("expired transaction should be refused: %v", err)
+	}
+	if _, err := wm.TxDecoder.SubmitRawTransaction(wallet, rawTx); err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Errorf("expired transaction should not be submitted: %v", err)
+	}
+
+	decoder := NewTransactionDecoder(wm)
+	if err := decoder.RebuildRawTransaction(wallet, rawTx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ext := rawTx.GetExtParam()
+	if ext.Get(extParamRefBlockHash).String() != refBlockHash || ext.Get(extParamRefBlockHeight).Uint() != 190 || ext.Get(extParamExpiryHeight).Uint() != 290 {
+		t.Errorf("unexpected reference block: %s", rawTx.ExtParam)
+	}
+	keySignature := rawTx.Signatures["account"][0]
+	if keySignature.Nonce != "21" || len(keySignature.Signature) > 0 || rawTx.IsCompleted {
+		t.Errorf("rebuilt transaction should use a new nonce and be unsigned: %+v", keySignature)
+	}
+	//按当前gas价格重新估算手续费
+	if rawTx.FeeRate != "200000000" || rawTx.Fees != GasToNear(2*223182562500, decimal.New(200000000, 0)).String() {
+		t.Errorf("unexpected fees: %s, fee rate: %s", rawTx.Fees, rawTx.FeeRate)
+	}
+
+	if err := wm.TxDecoder.SignRawTransaction(wallet, rawTx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := wm.TxDecoder.VerifyRawTransaction(wallet, rawTx); err != nil {
+		t.Errorf("rebuilt transaction should pass: %v", err)
+	}
+}
+
+func TestTransactionDecoder_CreateNamedAccountRawTransaction(t *testing.T) {
+	wm, clean := testWalletManager(t, newTestNode(map[string]string{
+		"/status":                     `{"sync_info":{"latest_block_height":200}}`,
+		"block":                       `{"header":{"height":190,"hash":"` + base58.Encode(bytes.Repeat([]byte{2}, 32)) + `"}}`,
+		"EXPERIMENTAL_genesis_config": `{"transaction_validity_period":100}`,
+		"query/view_access_key":       `{"nonce":20,"permission":"FullAccess"}`,
+		"gas_price":                   `{"gas_price":"100000000"}`,
+	}))
+	defer clean()
+
+	//命名账户使用钱包地址的公钥签名
+	_, _, _, publicKey := testSigningKey(t)
+	wallet := &testAddressWallet{addresses: []*openwallet.Address{{AccountID: "account", Address: "alice.near", PublicKey: hex.EncodeToString(publicKey)}}}
+	rawTx := &openwallet.RawTransaction{
+		Account: &openwallet.AssetsAccount{AccountID: "account"},
+		To:      map[string]string{"b.near": "1", "c.near": "2"},
+	}
+	decoder := NewTransactionDecoder(wm)
+	if err := decoder.createRawTransaction(context.Background(), wallet, rawTx, &AddrBalance{Address: "alice.near"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	nearTxs, err := decodeRawTransactions(rawTx.RawHex)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i, nearTx := range nearTxs {
+		if nearTx.SignerID != "alice.near" || !bytes.Equal(nearTx.PublicKey, publicKey) || nearTx.Nonce != uint64(21+i) {
+			t.Errorf("unexpected transaction %d: %s, nonce %d", i, nearTx.SignerID, nearTx.Nonce)
+		}
+	}
+	list, _ := wm.NonceManager.GetReservations("alice.near", neartransaction.FormatPublicKey(publicKey))
+	if len(list) != 2 {
+		t.Errorf("nonces should be reserved on the address key: %+v", list)
+	}
+
+	//地址没有公钥时不能创建
+	wallet.addresses[0].PublicKey = ""
+	if err := decoder.createRawTransaction(context.Background(), wallet, &openwallet.RawTransaction{
+		Account: &openwallet.AssetsAccount{AccountID: "account"},
+		To:      map[string]string{"b.near": "1"},
+	}, &AddrBalance{Address: "alice.near"}); err == nil {
+		t.Errorf("address without public key should fail")
+	}
+}
+
+func TestTransactionDecoder_SubmitCanceled(t *testing.T) {
+	node := newTestNode(map[string]string{
+		"/status":                     `{"sync_info":{"latest_block_height":200}}`,
+		"block":                       `{"header":{"height":190,"hash":"` + base58.Encode(bytes.Repeat([]byte{2}, 32)) + `"}}`,
+		"EXPERIMENTAL_genesis_config": `{"transaction_validity_period":100}`,
+		"query/view_access_key":       `{"nonce":20,"permission":"FullAccess"}`,
+		"gas_price":                   `{"gas_price":"100000000"}`,
+	})
+	node.Hang("broadcast_tx_commit")
+	wm, clean := testWalletManager(t, node)
+	defer clean()
+
+	key, hdPath, _, publicKey := testSigningKey(t)
+	address := hex.EncodeToString(publicKey)
+	wallet := &testAddressWallet{
+		testHDKeyWallet: testHDKeyWallet{key: key},
+		addresses:       []*openwallet.Address{{AccountID: "account", Address: address, PublicKey: address, HDPath: hdPath}},
+	}
+	rawTx := &openwallet.RawTransaction{
+		Account: &openwallet.AssetsAccount{AccountID: "account"},
+		To:      map[string]string{"b.near": "1", "c.near": "2"},
+	}
+	decoder := NewTransactionDecoder(wm)
+	if err := decoder.createRawTransaction(context.Background(), wallet, rawTx, &AddrBalance{Address: address}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rawTx.SetExtParam(extParamExpiryHeight, 0)
+	if err := decoder.SignRawTransaction(wallet, rawTx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	//广播请求被取消时交易可能未发出，不能当作已提交；后续交易未广播，释放nonce
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if tx, err := decoder.SubmitRawTransactionContext(ctx, wallet, rawTx); err == nil || tx != nil || rawTx.IsSubmit {
+		t.Errorf("canceled broadcast should fail, submitted: %v, err: %v", rawTx.IsSubmit, err)
+	}
+	list, _ := wm.NonceManager.GetReservations(address, neartransaction.FormatPublicKey(publicKey))
+	if len(list) != 1 || list[0].Nonce != 21 {
+		t.Errorf("only the nonce of the in-flight transaction should stay reserved: %+v", list)
+	}
+
+	//上下文已取消时不再广播，释放全部nonce
+	if _, err := decoder.SubmitRawTransactionContext(ctx, wallet, rawTx); err == nil || rawTx.IsSubmit {
+		t.Errorf("submit with canceled context should fail: %v", err)
+	}
+	if list, _ := wm.NonceManager.GetReservations(address, neartransaction.FormatPublicKey(publicKey)); len(list) != 0 {
+		t.Errorf("unsent nonces should be released: %+v", list)
+	}
+}
+
+func TestWalletManager_LoadTxValidityPeriod(t *testing.T) {
+	node := newTestNode(map[string]string{"EXPERIMENTAL_genesis_config": `{"transaction_validity_period":100}`})
+	defer node.Close()
+
+	//配置的交易有效期优先于创世配置
+	wm := NewWalletManager()
+	c, err := config.NewConfigData("ini", []byte("ServerAPI = "+node.URL+"\nTxValidityPeriod = 500\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := wm.LoadAssetsConfig(c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if period := wm.Blockscanner.GetTxValidityPeriod(); period != 500 {
+		t.Errorf("unexpected validity period: %d", period)
+	}
+
+	wm = NewWalletManager()
+	c, _ = config.NewConfigData("ini", []byte("ServerAPI = "+node.URL+"\n"))
+	wm.LoadAssetsConfig(c)
+	if period := wm.Blockscanner.GetTxValidityPeriod(); period != 100 {
+		t.Errorf("unexpected genesis validity period: %d", period)
+	}
+}
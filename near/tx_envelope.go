@@ -0,0 +1,95 @@
+package near
+
+import (
+	"encoding/hex"
+	"strings"
+
+	"github.com/Assetsadapter/near-adapter/neartransaction"
+	"github.com/blocktree/go-owcrypt"
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+//ExportUnsignedEnvelope 导出离线签名交易单，交由离线签名机通过txsigner签名
+func (decoder *TransactionDecoder) ExportUnsignedEnvelope(rawTx *openwallet.RawTransaction) (*neartransaction.Envelope, error) {
+	nearTxs, keySignatures, err := decodeRawTransactionWithSignatures(rawTx)
+	if err != nil {
+		return nil, err
+	}
+	ext := rawTx.GetExtParam()
+	env, err := neartransaction.NewEnvelope(nearTxs, ext.Get(extParamRefBlockHeight).Uint(), ext.Get(extParamExpiryHeight).Uint())
+	if err != nil {
+		return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "create envelope failed, unexpected err: %v", err)
+	}
+	for i, etx := range env.Transactions {
+		if etx.Hash != strings.ToLower(keySignatures[i].Message) {
+			return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "transaction [%d] message does not match raw transaction", i)
+		}
+		if keySignatures[i].Address != nil {
+			etx.HDPath = keySignatures[i].Address.HDPath
+		}
+	}
+	return env, nil
+}
+
+//ImportSignedEnvelope 导入离线签名结果，交易单内容必须与导出时一致，签名验证通过后写入交易单
+func (decoder *TransactionDecoder) ImportSignedEnvelope(rawTx *openwallet.RawTransaction, env *neartransaction.Envelope) error {
+	if err := env.Validate(); err != nil {
+		return openwallet.Errorf(openwallet.ErrVerifyRawTransactionFailed, "invalid envelope: %v", err)
+	}
+	nearTxs, keySignatures, err := decodeRawTransactionWithSignatures(rawTx)
+	if err != nil {
+		return err
+	}
+	if len(env.Transactions) != len(nearTxs) {
+		return openwallet.Errorf(openwallet.ErrVerifyRawTransactionFailed, "envelope transaction count %d not match transaction count %d", len(env.Transactions), len(nearTxs))
+	}
+
+	for i, etx := range env.Transactions {
+		if etx.Hash != strings.ToLower(keySignatures[i].Message) {
+			return openwallet.Errorf(openwallet.ErrVerifyRawTransactionFailed, "envelope transaction [%d] does not match raw transaction", i)
+		}
+		msg, err := etx.HashBytes()
+		if err != nil {
+			return openwallet.Errorf(openwallet.ErrVerifyRawTransactionFailed, "envelope transaction [%d] hash invalid: %v", i, err)
+		}
+		sig, err := hex.DecodeString(etx.Signature)
+		if err != nil || len(sig) == 0 {
+			return openwallet.Errorf(openwallet.ErrVerifyRawTransactionFailed, "envelope transaction [%d] is not signed", i)
+		}
+		nearTx := nearTxs[i]
+		if owcrypt.Verify(nearTx.PublicKey, nil, 0, msg, uint16(len(msg)), sig, owcrypt.ECC_CURVE_ED25519) != owcrypt.SUCCESS {
+			return openwallet.Errorf(openwallet.ErrVerifyRawTransactionFailed, "envelope transaction [%d] signature verify failed", i)
+		}
+		nearTx.Signature = sig
+		if _, _, err := nearTx.Serialize(); err != nil {
+			return openwallet.Errorf(openwallet.ErrVerifyRawTransactionFailed, "serialize signed transaction failed, unexpected err: %v", err)
+		}
+	}
+
+	rawTx.RawHex, err = encodeRawTransactions(nearTxs)
+	if err != nil {
+		return openwallet.Errorf(openwallet.ErrVerifyRawTransactionFailed, "raw tx Marshal failed=%s", err)
+	}
+	for i, etx := range env.Transactions {
+		keySignatures[i].Signature = strings.ToLower(etx.Signature)
+	}
+
+	decoder.wm.Logger.Info("offline signature imported", F("account", rawTx.Account.AccountID), F("count", len(nearTxs)))
+	return nil
+}
+
+//decodeRawTransactionWithSignatures 解析交易单中的交易和当前账户的待签名列表，两者一一对应
+func decodeRawTransactionWithSignatures(rawTx *openwallet.RawTransaction) ([]*neartransaction.Transaction, []*openwallet.KeySignature, error) {
+	if rawTx.Account == nil {
+		return nil, nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "raw transaction account is empty")
+	}
+	nearTxs, err := decodeRawTransactions(rawTx.RawHex)
+	if err != nil {
+		return nil, nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "raw tx Unmarshal failed=%s", err)
+	}
+	keySignatures := rawTx.Signatures[rawTx.Account.AccountID]
+	if len(keySignatures) != len(nearTxs) {
+		return nil, nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "transaction signature count %d not match transaction count %d", len(keySignatures), len(nearTxs))
+	}
+	return nearTxs, keySignatures, nil
+}
@@ -0,0 +1,211 @@
+package near
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/Assetsadapter/near-adapter/neartransaction"
+	"github.com/Assetsadapter/near-adapter/txsigner"
+	"github.com/blocktree/go-owcrypt"
+	"github.com/blocktree/openwallet/hdkeystore"
+	"github.com/blocktree/openwallet/openwallet"
+	"github.com/mr-tron/base58"
+)
+
+//testSigningKey 随机HD密钥和派生的ed25519子密钥
+func testSigningKey(t *testing.T) (*hdkeystore.HDKey, string, []byte, []byte) {
+	seed, err := hdkeystore.GenerateSeed(32)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	key, err := hdkeystore.NewHDKey(seed, "test", "m/44'/397'")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	hdPath := "m/44'/397'/0'/0'"
+	childKey, err := key.DerivedKeyWithPath(hdPath, CurveType)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	privateKey, err := childKey.GetPrivateKeyBytes()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return key, hdPath, privateKey, childKey.GetPublicKeyBytes()
+}
+
+//testUnsignedRawTx 隐式账户转账给bob.near的待签名交易单
+func testUnsignedRawTx(t *testing.T, publicKey []byte, hdPath string) *openwallet.RawTransaction {
+	address := hex.EncodeToString(publicKey)
+	nearTx, err := neartransaction.NewTransaction(address, "bob.near", base58.Encode(make([]byte, 32)), "1", 7)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, hash, err := nearTx.Serialize()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rawHex, err := encodeRawTransactions([]*neartransaction.Transaction{nearTx})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rawTx := &openwallet.RawTransaction{
+		Account: &openwallet.AssetsAccount{AccountID: "account"},
+		RawHex:  rawHex,
+		Signatures: map[string][]*openwallet.KeySignature{
+			"account": {{
+				EccType: CurveType,
+				Nonce:   "7",
+				Address: &openwallet.Address{Address: address, PublicKey: address, HDPath: hdPath},
+				Message: hash,
+			}},
+		},
+	}
+	rawTx.SetExtParam(extParamRefBlockHeight, 100)
+	rawTx.SetExtParam(extParamExpiryHeight, 86500)
+	return rawTx
+}
+
+func TestDeserializeTransaction(t *testing.T) {
+	publicKey := bytes.Repeat([]byte{1}, 32)
+	nearTx, err := neartransaction.NewTransactionWithActions(hex.EncodeToString(publicKey), "bob.near", base58.Encode(make([]byte, 32)), 9,
+		neartransaction.Action{CreateAccount: &neartransaction.CreateAccount{}},
+		neartransaction.NewFunctionCallAction("ft_transfer", []byte(`{"amount":"1"}`), 30000000000000, big.NewInt(1)),
+		neartransaction.NewTransferAction(new(big.Int).Exp(big.NewInt(10), big.NewInt(24), nil)),
+		neartransaction.Action{AddKey: &neartransaction.AddKey{PublicKey: publicKey, AccessKey: neartransaction.AccessKey{
+			Permission: &neartransaction.FunctionCallPermission{Allowance: big.NewInt(5), ReceiverID: "c.near", MethodNames: []string{"a", "b"}},
+		}}},
+		neartransaction.Action{AddKey: &neartransaction.AddKey{PublicKey: publicKey}},
+		neartransaction.Action{DeleteKey: &neartransaction.DeleteKey{PublicKey: publicKey}},
+		neartransaction.Action{DeleteAccount: &neartransaction.DeleteAccount{BeneficiaryID: "bob.near"}},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	nearTx.Signature = bytes.Repeat([]byte{2}, 64)
+	rawHex, _, err := nearTx.Serialize()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	decoded, err := neartransaction.Deserialize(nearTx.RawTxByte)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(decoded.Signature, nearTx.Signature) || decoded.Nonce != 9 || len(decoded.Actions) != 7 {
+		t.Errorf("unexpected decoded transaction: %+v", decoded)
+	}
+	if decodedHex, _, _ := decoded.Serialize(); decodedHex != rawHex {
+		t.Errorf("round trip mismatch:\n%s\n%s", decodedHex, rawHex)
+	}
+
+	if _, err := neartransaction.Deserialize(nearTx.RawTxByte[:len(nearTx.RawTxByte)-1]); err == nil {
+		t.Errorf("truncated transaction should fail")
+	}
+}
+
+func TestTransactionDecoder_OfflineEnvelope(t *testing.T) {
+	key, hdPath, privateKey, publicKey := testSigningKey(t)
+	rawTx := testUnsignedRawTx(t, publicKey, hdPath)
+	decoder := NewWalletManager().TxDecoder.(*TransactionDecoder)
+
+	env, err := decoder.ExportUnsignedEnvelope(rawTx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if env.ExpiryHeight != 86500 || env.Transactions[0].HDPath != hdPath || env.Transactions[0].PublicKey != neartransaction.FormatPublicKey(publicKey) {
+		t.Errorf("unexpected envelope: %+v", env.Transactions[0])
+	}
+
+	//在线端导出二维码文本，离线签名机导入
+	text, err := env.MarshalText()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(string(text), "NEARTX1:") || strings.ToUpper(string(text)) != string(text) {
+		t.Errorf("text should be QR alphanumeric: %s", text)
+	}
+	offline, err := neartransaction.ParseEnvelope(text)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	//私钥与签名公钥不匹配时拒绝签名
+	_, _, otherKey, _ := testSigningKey(t)
+	err = txsigner.Default.SignEnvelope(offline, func(pub []byte, path string) ([]byte, error) {
+		return otherKey, nil
+	})
+	if err == nil {
+		t.Errorf("mismatched private key should fail")
+	}
+
+	err = txsigner.Default.SignEnvelope(offline, func(pub []byte, path string) ([]byte, error) {
+		childKey, err := key.DerivedKeyWithPath(path, owcrypt.ECC_CURVE_ED25519)
+		if err != nil {
+			return nil, err
+		}
+		return childKey.GetPrivateKeyBytes()
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	//离线签名机以json返回签名结果
+	signedJSON, err := json.Marshal(offline)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	signed, err := neartransaction.ParseEnvelope(signedJSON)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := decoder.ImportSignedEnvelope(rawTx, signed); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	nearTxs, err := decodeRawTransactions(rawTx.RawHex)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	msg, _ := hex.DecodeString(rawTx.Signatures["account"][0].Message)
+	expected, _ := owcrypt.Signature(privateKey, nil, 0, msg, uint16(len(msg)), owcrypt.ECC_CURVE_ED25519)
+	if !bytes.Equal(nearTxs[0].Signature, expected) || rawTx.Signatures["account"][0].Signature != hex.EncodeToString(expected) {
+		t.Errorf("signature not imported")
+	}
+}
+
+func TestEnvelope_RejectTampered(t *testing.T) {
+	_, hdPath, _, publicKey := testSigningKey(t)
+	rawTx := testUnsignedRawTx(t, publicKey, hdPath)
+	decoder := NewWalletManager().TxDecoder.(*TransactionDecoder)
+	env, err := decoder.ExportUnsignedEnvelope(rawTx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	//展示的接收者与borsh内容不一致
+	env.Transactions[0].ReceiverID = "mallory.near"
+	if err := env.Validate(); err == nil {
+		t.Errorf("tampered receiver should fail")
+	}
+	env.Transactions[0].ReceiverID = "bob.near"
+
+	//替换borsh内容而不更新哈希
+	nearTx, _ := neartransaction.NewTransaction(hex.EncodeToString(publicKey), "mallory.near", env.RefBlockHash, "1000", 7)
+	nearTx.Serialize()
+	env.Transactions[0].Borsh = base64.StdEncoding.EncodeToString(nearTx.RawTxByte)
+	env.Transactions[0].ReceiverID = "mallory.near"
+	if err := env.Validate(); err == nil {
+		t.Errorf("tampered borsh should fail")
+	}
+
+	env.Version = 2
+	if err := env.Validate(); err == nil {
+		t.Errorf("unknown version should fail")
+	}
+}
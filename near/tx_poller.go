@@ -0,0 +1,142 @@
+package near
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+//TransactionResult 交易执行结果
+type TransactionResult struct {
+	TxID        string
+	Final       bool              //执行已完成，未完成时结果仍可能变化
+	Status      ExecutionStatus   //交易最终执行状态
+	Failure     *ExecutionFailure //执行失败原因
+	ReceiptIDs  []string          //交易产生的全部回执
+	TokensBurnt string            //交易及回执燃烧的手续费，已转换精度，失败的交易同样燃烧手续费
+}
+
+//IsSuccess 交易执行成功
+func (r *TransactionResult) IsSuccess() bool {
+	return r.Final && r.Status.IsSuccess()
+}
+
+//IsFailure 交易执行失败
+func (r *TransactionResult) IsFailure() bool {
+	return r.Final && r.Status.IsFailure()
+}
+
+//TxStatus 对应openwallet的交易状态，未完成返回TxStatusPending
+func (r *TransactionResult) TxStatus() string {
+	if r.IsSuccess() {
+		return TxStatusSuccess
+	}
+	if r.IsFailure() {
+		return TxStatusFail
+	}
+	return TxStatusPending
+}
+
+//Reason 执行失败原因
+func (r *TransactionResult) Reason() string {
+	if r.Failure == nil {
+		return ""
+	}
+	return r.Failure.Error()
+}
+
+//TxPoller 轮询交易状态直到执行完成
+type TxPoller struct {
+	wm       *WalletManager
+	Interval time.Duration
+	Timeout  time.Duration
+}
+
+//NewTxPoller 交易状态轮询器
+func NewTxPoller(wm *WalletManager) *TxPoller {
+	p := TxPoller{}
+	p.wm = wm
+	p.Interval = TxPollInterval * time.Second
+	p.Timeout = time.Duration(wm.Config.TxPollTimeout) * time.Second
+	return &p
+}
+
+//QueryTransaction 查询交易执行结果，优先使用EXPERIMENTAL_tx_status，节点不支持时使用tx
+func (p *TxPoller) QueryTransaction(txID, senderID string) (*TransactionResult, error) {
+	return p.QueryTransactionContext(context.Background(), txID, senderID)
+}
+
+//QueryTransactionContext 查询交易执行结果，上下文取消时中断查询
+func (p *TxPoller) QueryTransactionContext(ctx context.Context, txID, senderID string) (*TransactionResult, error) {
+	param := []interface{}{txID, senderID}
+	result, err := p.wm.client.CallContext(ctx, "EXPERIMENTAL_tx_status", param)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		result, err = p.wm.client.CallContext(ctx, "tx", param)
+		if err != nil {
+			return nil, err
+		}
+	}
+	txResp := TransactionStatus{}
+	err = json.Unmarshal([]byte(result.Raw), &txResp)
+	if err != nil {
+		return nil, err
+	}
+	return p.newTransactionResult(txID, txResp)
+}
+
+//WaitFinal 轮询直到交易执行完成。超时不代表交易失败，返回Final为false的结果
+func (p *TxPoller) WaitFinal(txID, senderID string) *TransactionResult {
+	return p.WaitFinalContext(context.Background(), txID, senderID)
+}
+
+//WaitFinalContext 轮询直到交易执行完成、超时或上下文取消，未完成时返回Final为false的结果
+func (p *TxPoller) WaitFinalContext(ctx context.Context, txID, senderID string) *TransactionResult {
+	ctx, cancel := context.WithTimeout(ctx, p.Timeout)
+	defer cancel()
+	for {
+		res, err := p.QueryTransactionContext(ctx, txID, senderID)
+		if err == nil && res.Final {
+			return res
+		}
+		if ctx.Err() == nil {
+			select {
+			case <-time.After(p.Interval):
+				continue
+			case <-ctx.Done():
+			}
+		}
+		if err != nil {
+			p.wm.Logger.Warn("transaction status unknown", F("txid", txID), F("reason", ctx.Err()), F("error", err))
+			return &TransactionResult{TxID: txID}
+		}
+		p.wm.Logger.Warn("transaction still pending", F("txid", txID), F("reason", ctx.Err()))
+		return res
+	}
+}
+
+//newTransactionResult 从tx/EXPERIMENTAL_tx_status/broadcast_tx_commit的结果生成执行结果
+func (p *TxPoller) newTransactionResult(txID string, txResp TransactionStatus) (*TransactionResult, error) {
+	res := &TransactionResult{
+		TxID:   txID,
+		Final:  txResp.Status.IsFinal(),
+		Status: txResp.Status,
+	}
+	failure, err := txResp.Status.FailureReason()
+	if err != nil {
+		return nil, err
+	}
+	res.Failure = failure
+	for _, receipt := range txResp.ReceiptsOutcome {
+		res.ReceiptIDs = append(res.ReceiptIDs, receipt.ID)
+	}
+	//未完成的交易为已执行部分燃烧的手续费
+	fees, err := p.wm.Blockscanner.gatherTxFee(txResp)
+	if err != nil {
+		return nil, err
+	}
+	res.TokensBurnt = fees
+	return res, nil
+}
@@ -0,0 +1,67 @@
+package near
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestTxPoller_NewTransactionResult(t *testing.T) {
+	statusJson := `{
+    "status": {"SuccessValue": ""},
+    "transaction": {"hash": "9Y9SxjV8ZDQ1r3FEYbBuLwWyVDvpN6FeEaFvr3EzuPx2", "signer_id": "a.near", "receiver_id": "b.near", "nonce": 1},
+    "transaction_outcome": {"id": "9Y9SxjV8ZDQ1r3FEYbBuLwWyVDvpN6FeEaFvr3EzuPx2", "outcome": {"gas_burnt": 223182562500, "tokens_burnt": "22318256250000000000", "receipt_ids": ["r1"], "status": {"SuccessReceiptId": "r1"}}},
+    "receipts_outcome": [
+      {"id": "r1", "outcome": {"gas_burnt": 223182562500, "tokens_burnt": "22318256250000000000", "receipt_ids": ["r2"], "status": {"SuccessValue": ""}}},
+      {"id": "r2", "outcome": {"gas_burnt": 0, "tokens_burnt": "0", "receipt_ids": [], "status": {"SuccessValue": ""}}}
+    ]
+  }`
+	txResp := TransactionStatus{}
+	if err := json.Unmarshal([]byte(statusJson), &txResp); err != nil {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+	p := NewTxPoller(NewWalletManager())
+	res, err := p.newTransactionResult(txResp.Transaction.Hash, txResp)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+	if !res.IsSuccess() || res.TxStatus() != "1" {
+		t.Errorf("unexpected status: %+v", res.Status)
+	}
+	if len(res.ReceiptIDs) != 2 || res.TokensBurnt != "0.0000446365125" {
+		t.Errorf("unexpected result: %+v", res)
+	}
+
+	//未完成的交易不是失败
+	if err := json.Unmarshal([]byte(`{"status": "Started"}`), &txResp); err != nil {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+	res, _ = p.newTransactionResult(txResp.Transaction.Hash, txResp)
+	if res.Final || res.IsFailure() || res.TxStatus() != TxStatusPending {
+		t.Errorf("unexpected pending result: %+v", res)
+	}
+}
+
+func TestTxPoller_WaitFinalContext(t *testing.T) {
+	node := newTestNode(nil)
+	node.Hang("*")
+	wm, clean := testWalletManager(t, node)
+	defer clean()
+	p := NewTxPoller(wm)
+	p.Timeout = time.Minute
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	res := p.WaitFinalContext(ctx, "tx1", "a.near")
+	if res.Final || res.TxID != "tx1" {
+		t.Errorf("unexpected result: %+v", res)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("wait should stop on context cancel, took %v", time.Since(start))
+	}
+}
@@ -0,0 +1,103 @@
+package near
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/Assetsadapter/near-adapter/neartransaction"
+	"github.com/blocktree/go-owcrypt"
+	"github.com/blocktree/openwallet/openwallet"
+	"github.com/mr-tron/base58"
+)
+
+//decodeSignedTransaction 按广播时的方式序列化交易，解析已签名的borsh，重新计算签名哈希并用交易内的公钥验证签名。
+//交易单中保存的borsh与交易字段不一致时视为被篡改。
+func decodeSignedTransaction(nearTx *neartransaction.Transaction) (*neartransaction.Transaction, []byte, error) {
+	if len(nearTx.Signature) == 0 {
+		return nil, nil, errors.New("transaction is not signed")
+	}
+	stored := nearTx.RawTxByte
+	if _, _, err := nearTx.Serialize(); err != nil {
+		return nil, nil, err
+	}
+	if len(stored) > 0 && !bytes.Equal(stored, nearTx.RawTxByte) {
+		return nil, nil, errors.New("signed borsh does not match transaction fields")
+	}
+	signedTx, err := neartransaction.Deserialize(nearTx.RawTxByte)
+	if err != nil {
+		return nil, nil, fmt.Errorf("decode signed borsh failed: %v", err)
+	}
+	txid, err := signedTx.Hash()
+	if err != nil {
+		return nil, nil, err
+	}
+	hash, err := base58.Decode(txid)
+	if err != nil {
+		return nil, nil, err
+	}
+	if owcrypt.Verify(signedTx.PublicKey, nil, 0, hash, uint16(len(hash)), signedTx.Signature, owcrypt.ECC_CURVE_ED25519) != owcrypt.SUCCESS {
+		return nil, nil, errors.New("signature does not match transaction")
+	}
+	return signedTx, hash, nil
+}
+
+//checkKeySignature 待签名记录的消息、公钥和签名须与已签名交易一致
+func checkKeySignature(keySignature *openwallet.KeySignature, signedTx *neartransaction.Transaction, hash []byte) error {
+	message, err := hex.DecodeString(keySignature.Message)
+	if err != nil || !bytes.Equal(message, hash) {
+		return errors.New("message is not the hash of the signed transaction")
+	}
+	if keySignature.Address == nil {
+		return errors.New("signer address is empty")
+	}
+	publicKey, err := hex.DecodeString(keySignature.Address.PublicKey)
+	if err != nil || !bytes.Equal(publicKey, signedTx.PublicKey) {
+		return fmt.Errorf("signer public key %s does not match transaction public key %s", keySignature.Address.PublicKey, neartransaction.FormatPublicKey(signedTx.PublicKey))
+	}
+	signature, err := hex.DecodeString(keySignature.Signature)
+	if err != nil || !bytes.Equal(signature, signedTx.Signature) {
+		return errors.New("signature does not match signed transaction")
+	}
+	return nil
+}
+
+//checkAccessKey 签名公钥须为签名账户的访问密钥，函数调用密钥只能签名其允许的调用
+func (decoder *TransactionDecoder) checkAccessKey(ctx context.Context, signedTx *neartransaction.Transaction) error {
+	publicKey := neartransaction.FormatPublicKey(signedTx.PublicKey)
+	accessKey, err := decoder.wm.Blockscanner.GetAccessKeyContext(ctx, signedTx.SignerID, publicKey)
+	if err != nil {
+		return fmt.Errorf("view access key %s of %s failed: %v", publicKey, signedTx.SignerID, err)
+	}
+	if accessKey.Permission.IsFullAccess() {
+		return nil
+	}
+	permission := accessKey.Permission.FunctionCall
+	if signedTx.ReceiverID != permission.ReceiverID {
+		return fmt.Errorf("access key %s can only call %s", publicKey, permission.ReceiverID)
+	}
+	for _, action := range signedTx.Actions {
+		if action.FunctionCall == nil || action.Deposit().Sign() != 0 {
+			return fmt.Errorf("access key %s can only sign function calls without deposit", publicKey)
+		}
+		if !containsMethod(permission.MethodNames, action.FunctionCall.MethodName) {
+			return fmt.Errorf("access key %s can not call method %s", publicKey, action.FunctionCall.MethodName)
+		}
+	}
+	return nil
+}
+
+//containsMethod 方法列表为空时允许调用全部方法
+func containsMethod(methodNames []string, method string) bool {
+	if len(methodNames) == 0 {
+		return true
+	}
+	for _, name := range methodNames {
+		if name == method {
+			return true
+		}
+	}
+	return false
+}
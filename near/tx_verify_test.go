@@ -0,0 +1,91 @@
+package near
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Assetsadapter/near-adapter/neartransaction"
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+//testSignedRawTx 已签名的交易单，不检查过期高度
+func testSignedRawTx(t *testing.T, wm *WalletManager) *openwallet.RawTransaction {
+	key, hdPath, _, publicKey := testSigningKey(t)
+	rawTx := testUnsignedRawTx(t, publicKey, hdPath)
+	rawTx.SetExtParam(extParamExpiryHeight, 0)
+	if err := wm.TxDecoder.SignRawTransaction(&testHDKeyWallet{key: key}, rawTx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return rawTx
+}
+
+//tamperRawTx 修改交易单中的交易
+func tamperRawTx(t *testing.T, rawTx *openwallet.RawTransaction, tamper func(nearTx *neartransaction.Transaction)) {
+	nearTxs, err := decodeRawTransactions(rawTx.RawHex)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tamper(nearTxs[0])
+	rawTx.RawHex, _ = encodeRawTransactions(nearTxs)
+}
+
+func TestTransactionDecoder_VerifyRawTransaction(t *testing.T) {
+	node := newTestNode(map[string]string{"query/view_access_key": `{"nonce":6,"permission":"FullAccess","block_height":1}`})
+	wm, clean := testWalletManager(t, node)
+	defer clean()
+
+	rawTx := testSignedRawTx(t, wm)
+	if err := wm.TxDecoder.VerifyRawTransaction(nil, rawTx); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(rawTx *openwallet.RawTransaction)
+	}{
+		{"receiver", func(rawTx *openwallet.RawTransaction) {
+			//同步更新borsh，签名不再匹配
+			tamperRawTx(t, rawTx, func(nearTx *neartransaction.Transaction) {
+				nearTx.ReceiverID = "mallory.near"
+				nearTx.Serialize()
+			})
+		}},
+		{"borsh", func(rawTx *openwallet.RawTransaction) {
+			tamperRawTx(t, rawTx, func(nearTx *neartransaction.Transaction) {
+				nearTx.ReceiverID = "mallory.near"
+			})
+		}},
+		{"message", func(rawTx *openwallet.RawTransaction) {
+			rawTx.Signatures["account"][0].Message = strings.Repeat("00", 32)
+		}},
+		{"signer key", func(rawTx *openwallet.RawTransaction) {
+			rawTx.Signatures["account"][0].Address.PublicKey = strings.Repeat("01", 32)
+		}},
+	}
+	for _, test := range tests {
+		rawTx := testSignedRawTx(t, wm)
+		test.tamper(rawTx)
+		if err := wm.TxDecoder.VerifyRawTransaction(nil, rawTx); err == nil {
+			t.Errorf("tampered %s should fail", test.name)
+		}
+	}
+}
+
+func TestTransactionDecoder_VerifyRawTransactionAccessKey(t *testing.T) {
+	tests := []struct {
+		name   string
+		result string
+	}{
+		{"missing key", `{"error":"access key does not exist while viewing","block_height":1}`},
+		{"function call key", `{"nonce":6,"permission":{"FunctionCall":{"allowance":null,"receiver_id":"bob.near","method_names":[]}}}`},
+	}
+	for _, test := range tests {
+		wm, clean := testWalletManager(t, newTestNode(map[string]string{"query/view_access_key": test.result}))
+		rawTx := testSignedRawTx(t, wm)
+		err := wm.TxDecoder.VerifyRawTransaction(nil, rawTx)
+		if err == nil {
+			t.Errorf("%s should fail", test.name)
+		}
+		clean()
+	}
+}
@@ -0,0 +1,151 @@
+package near
+
+import (
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/asdine/storm"
+	"github.com/asdine/storm/q"
+)
+
+const (
+	//未扫记录重试数据库文件
+	unscanRetryDBFile = "unscan_retry.db"
+	//重试间隔上限
+	maxUnscanRetryBackoff = time.Hour
+)
+
+//UnscanRetry 未扫区块的重试记录，超过最大重试次数后进入死信列表不再自动重试
+type UnscanRetry struct {
+	BlockHeight uint64 `storm:"id"`
+	Attempts    int    //已失败次数
+	LastError   string //最后一次失败原因
+	NextRetryAt int64  //下次重试时间
+	Dead        bool   `storm:"index"` //已进入死信列表
+	UpdateAt    int64
+}
+
+//UnscanRetryManager 未扫记录重试策略，失败后按指数退避重试
+type UnscanRetryManager struct {
+	wm     *WalletManager
+	mu     sync.Mutex
+	dbFile string
+}
+
+//NewUnscanRetryManager 未扫记录重试管理器
+func NewUnscanRetryManager(wm *WalletManager) *UnscanRetryManager {
+	rm := UnscanRetryManager{}
+	rm.wm = wm
+	rm.dbFile = filepath.Join(wm.Config.dbPath, unscanRetryDBFile)
+	return &rm
+}
+
+//Due 区块是否到了重试时间，死信不自动重试
+func (rm *UnscanRetryManager) Due(height uint64) bool {
+	return rm.due(height, time.Now())
+}
+
+//Fail 记录一次失败，计算下次重试时间，超过最大次数进入死信列表
+func (rm *UnscanRetryManager) Fail(height uint64, reason error) (*UnscanRetry, error) {
+	return rm.fail(height, reason, time.Now())
+}
+
+//Succeed 重扫成功，删除重试记录
+func (rm *UnscanRetryManager) Succeed(height uint64) error {
+	return rm.update(func(db *storm.DB) error {
+		err := db.DeleteStruct(&UnscanRetry{BlockHeight: height})
+		if err != nil && err != storm.ErrNotFound {
+			return err
+		}
+		return nil
+	})
+}
+
+//ListDeadLetters 死信列表
+func (rm *UnscanRetryManager) ListDeadLetters() ([]*UnscanRetry, error) {
+	var list []*UnscanRetry
+	err := rm.update(func(db *storm.DB) error {
+		err := db.Select(q.Eq("Dead", true)).OrderBy("BlockHeight").Find(&list)
+		if err == storm.ErrNotFound {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+//Retry 死信重新加入重试，重试次数清零，下次扫描任务立即重试
+func (rm *UnscanRetryManager) Retry(height uint64) error {
+	return rm.Succeed(height)
+}
+
+//Get 获取区块的重试记录
+func (rm *UnscanRetryManager) Get(height uint64) (*UnscanRetry, error) {
+	var retry UnscanRetry
+	err := rm.update(func(db *storm.DB) error {
+		return db.One("BlockHeight", height, &retry)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &retry, nil
+}
+
+func (rm *UnscanRetryManager) due(height uint64, now time.Time) bool {
+	retry, err := rm.Get(height)
+	if err != nil {
+		return true
+	}
+	return !retry.Dead && now.Unix() >= retry.NextRetryAt
+}
+
+func (rm *UnscanRetryManager) fail(height uint64, reason error, now time.Time) (*UnscanRetry, error) {
+	retry := &UnscanRetry{BlockHeight: height}
+	err := rm.update(func(db *storm.DB) error {
+		err := db.One("BlockHeight", height, retry)
+		if err != nil && err != storm.ErrNotFound {
+			return err
+		}
+		retry.Attempts++
+		if reason != nil {
+			retry.LastError = reason.Error()
+		}
+		retry.NextRetryAt = now.Add(rm.backoff(retry.Attempts)).Unix()
+		retry.Dead = retry.Attempts >= rm.wm.Config.UnscanMaxAttempts
+		retry.UpdateAt = now.Unix()
+		return db.Save(retry)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return retry, nil
+}
+
+//backoff 第n次失败后的重试间隔，指数增长，不超过上限
+func (rm *UnscanRetryManager) backoff(attempts int) time.Duration {
+	interval := time.Duration(rm.wm.Config.UnscanRetryInterval) * time.Second
+	for i := 1; i < attempts && interval < maxUnscanRetryBackoff; i++ {
+		interval *= 2
+	}
+	if interval > maxUnscanRetryBackoff {
+		interval = maxUnscanRetryBackoff
+	}
+	return interval
+}
+
+func (rm *UnscanRetryManager) update(fn func(db *storm.DB) error) error {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	db, err := storm.Open(rm.dbFile)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return fn(db)
+}
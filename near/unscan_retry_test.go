@@ -0,0 +1,73 @@
+package near
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestUnscanRetryManager_Backoff(t *testing.T) {
+	wm, clean := testWalletManager(t, nil)
+	defer clean()
+	rm := wm.Blockscanner.UnscanRetry
+
+	rm.wm.Config.UnscanMaxAttempts = 3
+	rm.wm.Config.UnscanRetryInterval = 10
+	now := time.Unix(1600000000, 0)
+
+	if !rm.due(100, now) {
+		t.Errorf("height without retry record should be due")
+	}
+
+	//首次失败10秒后重试，第二次20秒后重试
+	retry, err := rm.fail(100, errors.New("timeout"), now)
+	if err != nil || retry.Attempts != 1 || retry.NextRetryAt != now.Unix()+10 || retry.LastError != "timeout" {
+		t.Errorf("unexpected retry: %+v, err: %v", retry, err)
+	}
+	if rm.due(100, now.Add(5*time.Second)) || !rm.due(100, now.Add(10*time.Second)) {
+		t.Errorf("unexpected due time")
+	}
+	retry, _ = rm.fail(100, errors.New("timeout"), now)
+	if retry.NextRetryAt != now.Unix()+20 || retry.Dead {
+		t.Errorf("unexpected retry: %+v", retry)
+	}
+
+	if rm.backoff(20) != maxUnscanRetryBackoff {
+		t.Errorf("unexpected max backoff: %v", rm.backoff(20))
+	}
+}
+
+func TestUnscanRetryManager_DeadLetters(t *testing.T) {
+	wm, clean := testWalletManager(t, nil)
+	defer clean()
+	rm := wm.Blockscanner.UnscanRetry
+
+	rm.wm.Config.UnscanMaxAttempts = 2
+	now := time.Unix(1600000000, 0)
+
+	rm.fail(100, errors.New("block not found"), now)
+	retry, _ := rm.fail(100, errors.New("block not found"), now)
+	if !retry.Dead {
+		t.Errorf("retry should be dead after max attempts: %+v", retry)
+	}
+	//死信不自动重试
+	if rm.due(100, now.Add(24*time.Hour)) {
+		t.Errorf("dead letter should not be due")
+	}
+
+	list, err := rm.ListDeadLetters()
+	if err != nil || len(list) != 1 || list[0].BlockHeight != 100 {
+		t.Errorf("unexpected dead letters: %+v, err: %v", list, err)
+	}
+
+	if err := rm.Retry(100); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if !rm.due(100, now) {
+		t.Errorf("retried dead letter should be due")
+	}
+	list, _ = rm.ListDeadLetters()
+	if len(list) != 0 {
+		t.Errorf("unexpected dead letters after retry: %+v", list)
+	}
+}
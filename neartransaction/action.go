@@ -0,0 +1,180 @@
+package neartransaction
+
+import (
+	"math/big"
+
+	"github.com/blocktree/openwallet/common"
+	"github.com/juju/errors"
+)
+
+//Borsh枚举序号
+//https://github.com/near/nearcore/blob/master/core/primitives/src/transaction.rs
+const (
+	ActionCreateAccount  byte = 0
+	ActionDeployContract byte = 1
+	ActionFunctionCall   byte = 2
+	ActionTransfer       byte = 3
+	ActionStake          byte = 4
+	ActionAddKey         byte = 5
+	ActionDeleteKey      byte = 6
+	ActionDeleteAccount  byte = 7
+)
+
+//Action 交易动作，与节点json结构一致，有且只有一个字段不为空
+type Action struct {
+	CreateAccount  *CreateAccount  `json:"CreateAccount,omitempty"`
+	DeployContract *DeployContract `json:"DeployContract,omitempty"`
+	FunctionCall   *FunctionCall   `json:"FunctionCall,omitempty"`
+	Transfer       *Transfer       `json:"Transfer,omitempty"`
+	Stake          *Stake          `json:"Stake,omitempty"`
+	AddKey         *AddKey         `json:"AddKey,omitempty"`
+	DeleteKey      *DeleteKey      `json:"DeleteKey,omitempty"`
+	DeleteAccount  *DeleteAccount  `json:"DeleteAccount,omitempty"`
+}
+
+type CreateAccount struct {
+}
+
+type DeployContract struct {
+	Code []byte
+}
+
+type FunctionCall struct {
+	MethodName string
+	Args       []byte
+	Gas        uint64
+	Deposit    *big.Int
+}
+
+type Transfer struct {
+	Deposit *big.Int
+}
+
+type Stake struct {
+	Stake     *big.Int
+	PublicKey []byte
+}
+
+type AddKey struct {
+	PublicKey []byte
+	AccessKey AccessKey
+}
+
+//AccessKey Permission为空时表示FullAccess
+type AccessKey struct {
+	Nonce      uint64
+	Permission *FunctionCallPermission
+}
+
+//FunctionCallPermission Allowance为空时表示不限额度
+type FunctionCallPermission struct {
+	Allowance   *big.Int
+	ReceiverID  string
+	MethodNames []string
+}
+
+type DeleteKey struct {
+	PublicKey []byte
+}
+
+type DeleteAccount struct {
+	BeneficiaryID string
+}
+
+func NewTransferAction(deposit *big.Int) Action {
+	return Action{Transfer: &Transfer{Deposit: deposit}}
+}
+
+func NewFunctionCallAction(methodName string, args []byte, gas uint64, deposit *big.Int) Action {
+	return Action{FunctionCall: &FunctionCall{MethodName: methodName, Args: args, Gas: gas, Deposit: deposit}}
+}
+
+//Deposit 动作附带的转账数量
+func (a Action) Deposit() *big.Int {
+	switch {
+	case a.Transfer != nil && a.Transfer.Deposit != nil:
+		return a.Transfer.Deposit
+	case a.FunctionCall != nil && a.FunctionCall.Deposit != nil:
+		return a.FunctionCall.Deposit
+	}
+	return big.NewInt(0)
+}
+
+//Serialize borsh序列化，包含枚举序号
+func (a Action) Serialize() ([]byte, error) {
+	bytesData := []byte{}
+	switch {
+	case a.CreateAccount != nil:
+		bytesData = append(bytesData, ActionCreateAccount)
+	case a.DeployContract != nil:
+		bytesData = append(bytesData, ActionDeployContract)
+		bytesData = append(bytesData, serializeBytes(a.DeployContract.Code)...)
+	case a.FunctionCall != nil:
+		bytesData = append(bytesData, ActionFunctionCall)
+		bytesData = append(bytesData, serializeString(a.FunctionCall.MethodName)...)
+		bytesData = append(bytesData, serializeBytes(a.FunctionCall.Args)...)
+		bytesData = append(bytesData, uint64ToLittleEndianBytes(a.FunctionCall.Gas)...)
+		bytesData = append(bytesData, serializeU128(a.FunctionCall.Deposit)...)
+	case a.Transfer != nil:
+		bytesData = append(bytesData, ActionTransfer)
+		bytesData = append(bytesData, serializeU128(a.Transfer.Deposit)...)
+	case a.Stake != nil:
+		bytesData = append(bytesData, ActionStake)
+		bytesData = append(bytesData, serializeU128(a.Stake.Stake)...)
+		bytesData = append(bytesData, serializePublicKey(a.Stake.PublicKey)...)
+	case a.AddKey != nil:
+		bytesData = append(bytesData, ActionAddKey)
+		bytesData = append(bytesData, serializePublicKey(a.AddKey.PublicKey)...)
+		bytesData = append(bytesData, uint64ToLittleEndianBytes(a.AddKey.AccessKey.Nonce)...)
+		permission := a.AddKey.AccessKey.Permission
+		if permission == nil {
+			bytesData = append(bytesData, byte(1))
+		} else {
+			bytesData = append(bytesData, byte(0))
+			if permission.Allowance == nil {
+				bytesData = append(bytesData, byte(0))
+			} else {
+				bytesData = append(bytesData, byte(1))
+				bytesData = append(bytesData, serializeU128(permission.Allowance)...)
+			}
+			bytesData = append(bytesData, serializeString(permission.ReceiverID)...)
+			bytesData = append(bytesData, uint32ToLittleEndianBytes(uint32(len(permission.MethodNames)))...)
+			for _, name := range permission.MethodNames {
+				bytesData = append(bytesData, serializeString(name)...)
+			}
+		}
+	case a.DeleteKey != nil:
+		bytesData = append(bytesData, ActionDeleteKey)
+		bytesData = append(bytesData, serializePublicKey(a.DeleteKey.PublicKey)...)
+	case a.DeleteAccount != nil:
+		bytesData = append(bytesData, ActionDeleteAccount)
+		bytesData = append(bytesData, serializeString(a.DeleteAccount.BeneficiaryID)...)
+	default:
+		return nil, errors.New("empty action")
+	}
+	return bytesData, nil
+}
+
+func serializeString(s string) []byte {
+	return serializeBytes([]byte(s))
+}
+
+func serializeBytes(b []byte) []byte {
+	bytesData := uint32ToLittleEndianBytes(uint32(len(b)))
+	return append(bytesData, b...)
+}
+
+//serializeU128 小端16字节
+func serializeU128(amount *big.Int) []byte {
+	if amount == nil {
+		return make([]byte, 16)
+	}
+	amountOriginBytes := reverseBytes(amount.Bytes())
+	return common.RightPadBytes(amountOriginBytes, 16)
+}
+
+//serializePublicKey ed25519 公钥
+func serializePublicKey(publicKey []byte) []byte {
+	bytesData := []byte{byte(0)}
+	return append(bytesData, publicKey...)
+}
@@ -0,0 +1,174 @@
+package neartransaction
+
+import (
+	"encoding/hex"
+	"math/big"
+
+	"github.com/juju/errors"
+)
+
+//Deserialize 解析borsh序列化的交易，末尾带签名时为已签名交易(SignedTransaction)
+func Deserialize(data []byte) (*Transaction, error) {
+	r := &borshReader{data: data}
+	tx := Transaction{}
+	tx.SignerID = r.readString()
+	tx.PublicKey = r.readPublicKey()
+	tx.Nonce = r.readU64()
+	tx.ReceiverID = r.readString()
+	tx.BlockHash = r.read(32)
+	count := r.readU32()
+	for i := uint32(0); i < count && r.err == nil; i++ {
+		action, err := r.readAction()
+		if err != nil {
+			return nil, err
+		}
+		tx.Actions = append(tx.Actions, action)
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if r.remaining() > 0 {
+		//签名：ed25519枚举序号 + 64字节
+		if keyType := r.readByte(); r.err == nil && keyType != 0 {
+			return nil, errors.Errorf("unsupported signature type %d", keyType)
+		}
+		tx.Signature = r.read(64)
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if r.remaining() > 0 {
+		return nil, errors.Errorf("unexpected %d trailing bytes", r.remaining())
+	}
+	tx.RawTxByte = append([]byte(nil), data...)
+	tx.RawTxHex = hex.EncodeToString(data)
+	return &tx, nil
+}
+
+//borshReader 顺序读取borsh数据，出错后后续读取均返回零值
+type borshReader struct {
+	data   []byte
+	offset int
+	err    error
+}
+
+func (r *borshReader) remaining() int {
+	return len(r.data) - r.offset
+}
+
+func (r *borshReader) read(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || r.remaining() < n {
+		r.err = errors.Errorf("unexpected end of data at offset %d", r.offset)
+		return nil
+	}
+	buf := append([]byte(nil), r.data[r.offset:r.offset+n]...)
+	r.offset += n
+	return buf
+}
+
+func (r *borshReader) readByte() byte {
+	buf := r.read(1)
+	if buf == nil {
+		return 0
+	}
+	return buf[0]
+}
+
+func (r *borshReader) readU32() uint32 {
+	buf := r.read(4)
+	if buf == nil {
+		return 0
+	}
+	return littleEndianBytesToUint32(buf)
+}
+
+func (r *borshReader) readU64() uint64 {
+	buf := r.read(8)
+	if buf == nil {
+		return 0
+	}
+	return littleEndianBytesToUint64(buf)
+}
+
+//readU128 小端16字节
+func (r *borshReader) readU128() *big.Int {
+	buf := r.read(16)
+	if buf == nil {
+		return nil
+	}
+	return new(big.Int).SetBytes(reverseBytes(buf))
+}
+
+func (r *borshReader) readBytes() []byte {
+	return r.read(int(r.readU32()))
+}
+
+func (r *borshReader) readString() string {
+	return string(r.readBytes())
+}
+
+//readPublicKey 只支持ed25519公钥
+func (r *borshReader) readPublicKey() []byte {
+	keyType := r.readByte()
+	if r.err == nil && keyType != 0 {
+		r.err = errors.Errorf("unsupported public key type %d", keyType)
+		return nil
+	}
+	return r.read(32)
+}
+
+func (r *borshReader) readAction() (Action, error) {
+	action := Action{}
+	switch kind := r.readByte(); kind {
+	case ActionCreateAccount:
+		action.CreateAccount = &CreateAccount{}
+	case ActionDeployContract:
+		action.DeployContract = &DeployContract{Code: r.readBytes()}
+	case ActionFunctionCall:
+		action.FunctionCall = &FunctionCall{
+			MethodName: r.readString(),
+			Args:       r.readBytes(),
+			Gas:        r.readU64(),
+			Deposit:    r.readU128(),
+		}
+	case ActionTransfer:
+		action.Transfer = &Transfer{Deposit: r.readU128()}
+	case ActionStake:
+		action.Stake = &Stake{Stake: r.readU128(), PublicKey: r.readPublicKey()}
+	case ActionAddKey:
+		addKey := &AddKey{PublicKey: r.readPublicKey()}
+		addKey.AccessKey.Nonce = r.readU64()
+		switch permission := r.readByte(); permission {
+		case 0:
+			p := &FunctionCallPermission{}
+			if r.readByte() == 1 {
+				p.Allowance = r.readU128()
+			}
+			p.ReceiverID = r.readString()
+			count := r.readU32()
+			for i := uint32(0); i < count && r.err == nil; i++ {
+				p.MethodNames = append(p.MethodNames, r.readString())
+			}
+			addKey.AccessKey.Permission = p
+		case 1:
+			//FullAccess
+		default:
+			if r.err == nil {
+				return action, errors.Errorf("unknown access key permission %d", permission)
+			}
+		}
+		action.AddKey = addKey
+	case ActionDeleteKey:
+		action.DeleteKey = &DeleteKey{PublicKey: r.readPublicKey()}
+	case ActionDeleteAccount:
+		action.DeleteAccount = &DeleteAccount{BeneficiaryID: r.readString()}
+	default:
+		if r.err == nil {
+			return action, errors.Errorf("unknown action type %d", kind)
+		}
+	}
+	return action, r.err
+}
@@ -0,0 +1,213 @@
+package neartransaction
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/mr-tron/base58"
+)
+
+const (
+	EnvelopeFormat  = "near-unsigned-transaction" //交易单格式标识
+	EnvelopeVersion = 1                           //当前交易单格式版本
+
+	//文本格式前缀，内容为压缩后的json，使用base32编码以适配二维码字母数字模式
+	envelopeTextPrefix = "NEARTX1:"
+)
+
+//envelopeTextEncoding 大写字母和数字，无填充
+var envelopeTextEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+//Envelope 离线签名交易单，包含签名所需的全部信息，可导出为json或二维码文本
+type Envelope struct {
+	Format         string                 `json:"format"`
+	Version        int                    `json:"version"`
+	RefBlockHash   string                 `json:"refBlockHash"`   //引用区块hash，base58
+	RefBlockHeight uint64                 `json:"refBlockHeight"` //引用区块高度
+	ExpiryHeight   uint64                 `json:"expiryHeight"`   //超过该高度交易过期，需要重建
+	Transactions   []*EnvelopeTransaction `json:"transactions"`
+}
+
+//EnvelopeTransaction 单笔待签名交易
+type EnvelopeTransaction struct {
+	Borsh      string `json:"borsh"`            //未签名交易的borsh序列化，base64
+	Hash       string `json:"hash"`             //签名哈希，borsh的sha256，hex
+	SignerID   string `json:"signerId"`         //签名账户
+	PublicKey  string `json:"publicKey"`        //签名公钥，ed25519:<base58>
+	HDPath     string `json:"hdPath,omitempty"` //签名机派生私钥的路径
+	Nonce      uint64 `json:"nonce"`
+	ReceiverID string `json:"receiverId"`
+	Signature  string `json:"signature,omitempty"` //签名，hex，签名后填写
+}
+
+//NewEnvelope 由未签名交易创建交易单
+func NewEnvelope(txs []*Transaction, refBlockHeight, expiryHeight uint64) (*Envelope, error) {
+	if len(txs) == 0 {
+		return nil, errors.New("transaction is empty")
+	}
+	env := Envelope{}
+	env.Format = EnvelopeFormat
+	env.Version = EnvelopeVersion
+	env.RefBlockHash = base58.Encode(txs[0].BlockHash)
+	env.RefBlockHeight = refBlockHeight
+	env.ExpiryHeight = expiryHeight
+	for _, tx := range txs {
+		unsigned := *tx
+		unsigned.Signature = nil
+		_, hash, err := unsigned.Serialize()
+		if err != nil {
+			return nil, err
+		}
+		env.Transactions = append(env.Transactions, &EnvelopeTransaction{
+			Borsh:      base64.StdEncoding.EncodeToString(unsigned.RawTxByte),
+			Hash:       hash,
+			SignerID:   tx.SignerID,
+			PublicKey:  FormatPublicKey(tx.PublicKey),
+			Nonce:      tx.Nonce,
+			ReceiverID: tx.ReceiverID,
+		})
+	}
+	return &env, nil
+}
+
+//Validate 检查格式版本，并逐笔校验交易内容与描述字段一致
+func (env *Envelope) Validate() error {
+	if env.Format != EnvelopeFormat {
+		return errors.Errorf("unknown envelope format %q", env.Format)
+	}
+	if env.Version != EnvelopeVersion {
+		return errors.Errorf("unsupported envelope version %d", env.Version)
+	}
+	if len(env.Transactions) == 0 {
+		return errors.New("envelope has no transaction")
+	}
+	for i, etx := range env.Transactions {
+		tx, err := etx.Decode()
+		if err != nil {
+			return errors.Annotatef(err, "transaction [%d]", i)
+		}
+		if base58.Encode(tx.BlockHash) != env.RefBlockHash {
+			return errors.Errorf("transaction [%d] reference block does not match envelope", i)
+		}
+	}
+	return nil
+}
+
+//Decode 解析borsh内容，重新计算哈希，并与描述字段逐一比对，防止签名内容与展示内容不一致
+func (etx *EnvelopeTransaction) Decode() (*Transaction, error) {
+	raw, err := base64.StdEncoding.DecodeString(etx.Borsh)
+	if err != nil {
+		return nil, errors.Annotate(err, "decode borsh")
+	}
+	tx, err := Deserialize(raw)
+	if err != nil {
+		return nil, err
+	}
+	if len(tx.Signature) > 0 {
+		return nil, errors.New("borsh must be the unsigned transaction")
+	}
+	digest := sha256.Sum256(raw)
+	if hex.EncodeToString(digest[:]) != strings.ToLower(etx.Hash) {
+		return nil, errors.New("hash does not match borsh")
+	}
+	if tx.SignerID != etx.SignerID {
+		return nil, errors.Errorf("signer %s does not match borsh signer %s", etx.SignerID, tx.SignerID)
+	}
+	if FormatPublicKey(tx.PublicKey) != etx.PublicKey {
+		return nil, errors.Errorf("public key %s does not match borsh public key", etx.PublicKey)
+	}
+	if tx.Nonce != etx.Nonce {
+		return nil, errors.Errorf("nonce %d does not match borsh nonce %d", etx.Nonce, tx.Nonce)
+	}
+	if tx.ReceiverID != etx.ReceiverID {
+		return nil, errors.Errorf("receiver %s does not match borsh receiver %s", etx.ReceiverID, tx.ReceiverID)
+	}
+	return tx, nil
+}
+
+//HashBytes 签名哈希
+func (etx *EnvelopeTransaction) HashBytes() ([]byte, error) {
+	return hex.DecodeString(etx.Hash)
+}
+
+//MarshalText 二维码友好的文本格式：前缀 + base32(deflate(json))
+func (env *Envelope) MarshalText() ([]byte, error) {
+	buf, err := json.Marshal((*envelopeJSON)(env))
+	if err != nil {
+		return nil, err
+	}
+	compressed := bytes.Buffer{}
+	w, err := flate.NewWriter(&compressed, flate.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(buf); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return []byte(envelopeTextPrefix + envelopeTextEncoding.EncodeToString(compressed.Bytes())), nil
+}
+
+//UnmarshalText 解析文本格式
+func (env *Envelope) UnmarshalText(text []byte) error {
+	s := strings.TrimSpace(string(text))
+	if !strings.HasPrefix(strings.ToUpper(s), envelopeTextPrefix) {
+		return errors.New("unknown envelope text prefix")
+	}
+	compressed, err := envelopeTextEncoding.DecodeString(strings.ToUpper(s[len(envelopeTextPrefix):]))
+	if err != nil {
+		return err
+	}
+	buf, err := ioutil.ReadAll(flate.NewReader(bytes.NewReader(compressed)))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(buf, (*envelopeJSON)(env))
+}
+
+//envelopeJSON 避免json序列化时使用MarshalText
+type envelopeJSON Envelope
+
+//MarshalJSON json格式
+func (env *Envelope) MarshalJSON() ([]byte, error) {
+	return json.Marshal((*envelopeJSON)(env))
+}
+
+//UnmarshalJSON json格式
+func (env *Envelope) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, (*envelopeJSON)(env))
+}
+
+//ParseEnvelope 解析json或文本格式的交易单，并校验内容
+func ParseEnvelope(data []byte) (*Envelope, error) {
+	env := Envelope{}
+	trimmed := bytes.TrimSpace(data)
+	var err error
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		err = env.UnmarshalJSON(trimmed)
+	} else {
+		err = env.UnmarshalText(trimmed)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := env.Validate(); err != nil {
+		return nil, err
+	}
+	return &env, nil
+}
+
+//FormatPublicKey ed25519公钥格式 ed25519:<base58>
+func FormatPublicKey(publicKey []byte) string {
+	return "ed25519:" + base58.Encode(publicKey)
+}
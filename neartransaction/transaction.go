@@ -7,7 +7,6 @@ import (
 	"github.com/blocktree/openwallet/common"
 	"github.com/juju/errors"
 	"github.com/mr-tron/base58"
-	"math/big"
 )
 
 // Transaction struct
@@ -18,35 +17,38 @@ type Transaction struct {
 	ReceiverID string
 	BlockHash  []byte
 	Signature  []byte
-	Actions    []Transfer
+	Actions    []Action
 	RawTxHex   string
 	RawTxByte  []byte
 }
 
-type Transfer struct {
-	Deposit *big.Int
+func NewTransaction(from, to, refBlockHash, transferAmount string, nonce uint64) (*Transaction, error) {
+	amount := common.StringNumToBigIntWithExp(transferAmount, 24)
+	return NewTransactionWithActions(from, to, refBlockHash, nonce, NewTransferAction(amount))
 }
 
-func NewTransaction(from, to, refBlockHash, transferAmount string, nonce uint64) (*Transaction, error) {
-	tx := Transaction{}
-	tx.SignerID = from
+//NewTransactionWithActions 创建包含任意动作的交易，签名者为隐式账户
+func NewTransactionWithActions(from, to, refBlockHash string, nonce uint64, actions ...Action) (*Transaction, error) {
 	singerPubKey, err := hex.DecodeString(from)
 	if err != nil {
 		return nil, err
 	}
+	return NewTransactionWithSigner(from, singerPubKey, to, refBlockHash, nonce, actions...)
+}
+
+//NewTransactionWithSigner 创建由指定账户和访问密钥签名的交易，用于命名账户，例如多签合约账户
+func NewTransactionWithSigner(signerID string, publicKey []byte, to, refBlockHash string, nonce uint64, actions ...Action) (*Transaction, error) {
+	var err error
+	tx := Transaction{}
+	tx.SignerID = signerID
 	tx.ReceiverID = to
-	tx.PublicKey = singerPubKey
+	tx.PublicKey = publicKey
 	tx.Nonce = nonce
 	tx.BlockHash, err = base58.Decode(refBlockHash)
 	if err != nil {
 		return nil, err
 	}
-	amount := common.StringNumToBigIntWithExp(transferAmount, 24)
-	if err != nil {
-		return nil, err
-	}
-	transferAction := Transfer{Deposit: amount}
-	tx.Actions = append(tx.Actions, transferAction)
+	tx.Actions = append(tx.Actions, actions...)
 	return &tx, nil
 }
 
@@ -86,10 +88,11 @@ func (tx *Transaction) Serialize() (string, string, error) {
 	//actions
 	bytesData = append(bytesData, uint32ToLittleEndianBytes(uint32(len(tx.Actions)))...)
 	for _, action := range tx.Actions {
-		bytesData = append(bytesData, byte(3))
-		amountOriginBytes := reverseBytes(action.Deposit.Bytes())
-		amountResult := common.RightPadBytes(amountOriginBytes, 16)
-		bytesData = append(bytesData, amountResult...)
+		actionBytes, err := action.Serialize()
+		if err != nil {
+			return "", "", err
+		}
+		bytesData = append(bytesData, actionBytes...)
 	}
 	if len(tx.Signature) > 0 {
 		bytesData = append(bytesData, byte(0))
@@ -114,3 +117,13 @@ func (tx Transaction) digest() (string, error) {
 	digest := sha256.Sum256(msgBuffer.Bytes())
 	return hex.EncodeToString(digest[:]), nil
 }
+
+//Hash 交易哈希，未签名交易Borsh序列化后sha256的base58编码，与节点返回的transaction.hash一致
+func (tx Transaction) Hash() (string, error) {
+	tx.Signature = nil
+	if _, _, err := tx.Serialize(); err != nil {
+		return "", err
+	}
+	digest := sha256.Sum256(tx.RawTxByte)
+	return base58.Encode(digest[:]), nil
+}
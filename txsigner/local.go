@@ -0,0 +1,58 @@
+package txsigner
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/blocktree/go-owcrypt"
+)
+
+//LocalSigner 本进程内持有ed25519私钥的签名器，使用owcrypt签名
+type LocalSigner struct {
+	keys map[string]localKey //hex公钥 -> 私钥
+}
+
+type localKey struct {
+	privateKey []byte
+	eccType    uint32
+}
+
+//NewLocalSigner 由openwallet HD派生的私钥创建签名器，公钥由私钥计算
+func NewLocalSigner(privateKeys ...[]byte) (*LocalSigner, error) {
+	return newLocalSigner(owcrypt.ECC_CURVE_ED25519, privateKeys)
+}
+
+//NewSeedSigner 由标准ed25519种子私钥创建签名器，例如从near-cli导入的密钥
+func NewSeedSigner(seeds ...[]byte) (*LocalSigner, error) {
+	return newLocalSigner(owcrypt.ECC_CURVE_ED25519_NORMAL, seeds)
+}
+
+func newLocalSigner(eccType uint32, privateKeys [][]byte) (*LocalSigner, error) {
+	s := LocalSigner{}
+	s.keys = make(map[string]localKey, len(privateKeys))
+	for _, privateKey := range privateKeys {
+		if len(privateKey) != 32 {
+			return nil, fmt.Errorf("invalid ed25519 private key length %d", len(privateKey))
+		}
+		publicKey, ret := owcrypt.GenPubkey(privateKey, eccType)
+		if ret != owcrypt.SUCCESS {
+			return nil, fmt.Errorf("invalid ed25519 private key")
+		}
+		s.keys[hex.EncodeToString(publicKey)] = localKey{privateKey: append([]byte(nil), privateKey...), eccType: eccType}
+	}
+	return &s, nil
+}
+
+//SignHash 实现Signer
+func (s *LocalSigner) SignHash(publicKey []byte, hash []byte) ([]byte, error) {
+	key, exist := s.keys[hex.EncodeToString(publicKey)]
+	if !exist {
+		return nil, ErrKeyNotFound
+	}
+	return Default.SignTransactionHash(hash, key.privateKey, key.eccType)
+}
+
+//String 不输出私钥
+func (s *LocalSigner) String() string {
+	return fmt.Sprintf("LocalSigner(%d keys)", len(s.keys))
+}
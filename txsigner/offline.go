@@ -0,0 +1,64 @@
+package txsigner
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/Assetsadapter/near-adapter/neartransaction"
+)
+
+//PrivateKeyFunc 离线签名机按签名公钥和派生路径加载私钥
+type PrivateKeyFunc func(publicKey []byte, hdPath string) ([]byte, error)
+
+// SignEnvelope 离线签名交易单
+// 逐笔解析borsh并重新计算哈希，确认私钥与签名公钥匹配后签名，签名写入交易单的Signature
+func (singer *TransactionSigner) SignEnvelope(env *neartransaction.Envelope, privateKey PrivateKeyFunc) error {
+	return singer.signEnvelope(env, func(etx *neartransaction.EnvelopeTransaction, tx *neartransaction.Transaction) (Signer, error) {
+		key, err := privateKey(tx.PublicKey, etx.HDPath)
+		if err != nil {
+			return nil, fmt.Errorf("load private key failed: %v", err)
+		}
+		local, err := NewLocalSigner(key)
+		if err != nil {
+			return nil, err
+		}
+		return local, nil
+	})
+}
+
+// SignEnvelopeWithSigner 使用签名器签名交易单，例如离线签名机上的HSM
+func (singer *TransactionSigner) SignEnvelopeWithSigner(env *neartransaction.Envelope, signer Signer) error {
+	return singer.signEnvelope(env, func(etx *neartransaction.EnvelopeTransaction, tx *neartransaction.Transaction) (Signer, error) {
+		return signer, nil
+	})
+}
+
+func (singer *TransactionSigner) signEnvelope(env *neartransaction.Envelope, signerFor func(etx *neartransaction.EnvelopeTransaction, tx *neartransaction.Transaction) (Signer, error)) error {
+	if err := env.Validate(); err != nil {
+		return err
+	}
+	for i, etx := range env.Transactions {
+		tx, err := etx.Decode()
+		if err != nil {
+			return fmt.Errorf("transaction [%d]: %v", i, err)
+		}
+		signer, err := signerFor(etx, tx)
+		if err != nil {
+			return fmt.Errorf("transaction [%d]: %v", i, err)
+		}
+		hash, err := etx.HashBytes()
+		if err != nil {
+			return fmt.Errorf("transaction [%d]: %v", i, err)
+		}
+		sig, err := signer.SignHash(tx.PublicKey, hash)
+		if errors.Is(err, ErrKeyNotFound) {
+			return fmt.Errorf("transaction [%d]: private key does not match signer public key %s", i, etx.PublicKey)
+		}
+		if err != nil {
+			return fmt.Errorf("transaction [%d]: %v", i, err)
+		}
+		etx.Signature = hex.EncodeToString(sig)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package txsigner
+
+import (
+	"fmt"
+	"sync"
+)
+
+//PKCS#11常量，取值与pkcs11t.h一致
+const (
+	CKA_CLASS    uint = 0x00000000
+	CKA_KEY_TYPE uint = 0x00000100
+	CKA_ID       uint = 0x00000102
+
+	CKO_PRIVATE_KEY uint = 0x00000003
+	CKK_EC_EDWARDS  uint = 0x00000040
+	CKM_EDDSA       uint = 0x00001057
+)
+
+//PKCS11Attribute 对象属性
+type PKCS11Attribute struct {
+	Type  uint
+	Value []byte
+}
+
+//PKCS11ObjectHandle 对象句柄
+type PKCS11ObjectHandle uint
+
+//PKCS11Session 已登录的PKCS#11会话，方法与C_FindObjectsInit、C_FindObjects、C_FindObjectsFinal、
+//C_SignInit、C_Sign一一对应，由miekg/pkcs11等绑定打开SoftHSM或硬件HSM的会话后适配
+type PKCS11Session interface {
+	FindObjectsInit(template []*PKCS11Attribute) error
+	FindObjects(max int) ([]PKCS11ObjectHandle, bool, error)
+	FindObjectsFinal() error
+	SignInit(mechanism uint, key PKCS11ObjectHandle) error
+	Sign(message []byte) ([]byte, error)
+}
+
+//PKCS11Signer HSM签名器，私钥不出HSM。
+//私钥对象须为CKK_EC_EDWARDS类型，CKA_ID为32字节的ed25519公钥。
+type PKCS11Signer struct {
+	mu      sync.Mutex //同一会话的查找和签名操作不能并发
+	session PKCS11Session
+	handles map[string]PKCS11ObjectHandle //公钥 -> 私钥句柄
+}
+
+//NewPKCS11Signer 使用已登录的会话创建签名器
+func NewPKCS11Signer(session PKCS11Session) *PKCS11Signer {
+	s := PKCS11Signer{}
+	s.session = session
+	s.handles = make(map[string]PKCS11ObjectHandle)
+	return &s
+}
+
+//SignHash 实现Signer，使用CKM_EDDSA签名
+func (s *PKCS11Signer) SignHash(publicKey []byte, hash []byte) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	handle, err := s.findPrivateKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.session.SignInit(CKM_EDDSA, handle); err != nil {
+		return nil, fmt.Errorf("pkcs11 sign init failed: %v", err)
+	}
+	sig, err := s.session.Sign(hash)
+	if err != nil {
+		return nil, fmt.Errorf("pkcs11 sign failed: %v", err)
+	}
+	if err := verifySignature(publicKey, hash, sig); err != nil {
+		return nil, fmt.Errorf("pkcs11 %v", err)
+	}
+	return sig, nil
+}
+
+//findPrivateKey 按CKA_ID查找私钥句柄，结果缓存，调用者需持有锁
+func (s *PKCS11Signer) findPrivateKey(publicKey []byte) (PKCS11ObjectHandle, error) {
+	if handle, exist := s.handles[string(publicKey)]; exist {
+		return handle, nil
+	}
+	template := []*PKCS11Attribute{
+		{Type: CKA_CLASS, Value: ulongBytes(CKO_PRIVATE_KEY)},
+		{Type: CKA_KEY_TYPE, Value: ulongBytes(CKK_EC_EDWARDS)},
+		{Type: CKA_ID, Value: publicKey},
+	}
+	if err := s.session.FindObjectsInit(template); err != nil {
+		return 0, fmt.Errorf("pkcs11 find objects failed: %v", err)
+	}
+	handles, _, err := s.session.FindObjects(1)
+	if finalErr := s.session.FindObjectsFinal(); err == nil && finalErr != nil {
+		err = finalErr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("pkcs11 find objects failed: %v", err)
+	}
+	if len(handles) == 0 {
+		return 0, ErrKeyNotFound
+	}
+	s.handles[string(publicKey)] = handles[0]
+	return handles[0], nil
+}
+
+//ulongBytes CK_ULONG属性值，按本机小端64位编码，与SoftHSM在amd64/arm64上一致
+func ulongBytes(v uint) []byte {
+	buf := make([]byte, 8)
+	for i := range buf {
+		buf[i] = byte(v >> (8 * uint(i)))
+	}
+	return buf
+}
@@ -0,0 +1,92 @@
+package txsigner
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mr-tron/base58"
+)
+
+//RemoteSignTimeout 远程签名默认超时
+const RemoteSignTimeout = 30 * time.Second
+
+//RemoteSignRequest 远程签名请求，POST到签名服务的 /sign
+type RemoteSignRequest struct {
+	PublicKey string `json:"public_key"` //ed25519:<base58>
+	Hash      string `json:"hash"`       //交易哈希，hex
+}
+
+//RemoteSignResponse 远程签名响应，失败时返回非200状态码或Error
+type RemoteSignResponse struct {
+	Signature string `json:"signature"` //ed25519签名，hex
+	Error     string `json:"error,omitempty"`
+}
+
+//RemoteSigner 远程签名服务，私钥不在本进程
+type RemoteSigner struct {
+	URL    string       //签名服务地址
+	Token  string       //Authorization: Bearer <Token>，为空时不发送
+	Client *http.Client //为空时使用RemoteSignTimeout超时的客户端
+}
+
+//NewRemoteSigner 远程签名器
+func NewRemoteSigner(url, token string) *RemoteSigner {
+	s := RemoteSigner{}
+	s.URL = strings.TrimRight(url, "/")
+	s.Token = token
+	s.Client = &http.Client{Timeout: RemoteSignTimeout}
+	return &s
+}
+
+//SignHash 实现Signer，签名服务返回的签名须能用公钥验证
+func (s *RemoteSigner) SignHash(publicKey []byte, hash []byte) ([]byte, error) {
+	body, err := json.Marshal(RemoteSignRequest{
+		PublicKey: "ed25519:" + base58.Encode(publicKey),
+		Hash:      hex.EncodeToString(hash),
+	})
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequest(http.MethodPost, s.URL+"/sign", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if len(s.Token) > 0 {
+		request.Header.Set("Authorization", "Bearer "+s.Token)
+	}
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: RemoteSignTimeout}
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("remote signer request failed: %v", err)
+	}
+	defer response.Body.Close()
+
+	result := RemoteSignResponse{}
+	decodeErr := json.NewDecoder(response.Body).Decode(&result)
+	if response.StatusCode == http.StatusNotFound {
+		return nil, ErrKeyNotFound
+	}
+	if response.StatusCode != http.StatusOK || len(result.Error) > 0 {
+		return nil, fmt.Errorf("remote signer failed, status: %d, error: %s", response.StatusCode, result.Error)
+	}
+	if decodeErr != nil {
+		return nil, fmt.Errorf("remote signer response invalid: %v", decodeErr)
+	}
+	sig, err := hex.DecodeString(result.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("remote signer signature invalid: %v", err)
+	}
+	if err := verifySignature(publicKey, hash, sig); err != nil {
+		return nil, fmt.Errorf("remote signer %v", err)
+	}
+	return sig, nil
+}
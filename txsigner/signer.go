@@ -1,6 +1,7 @@
 package txsigner
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/blocktree/go-owcrypt"
@@ -8,6 +9,15 @@ import (
 
 var Default = &TransactionSigner{}
 
+//ErrKeyNotFound 签名器中没有公钥对应的私钥
+var ErrKeyNotFound = errors.New("signing key not found")
+
+//Signer 签名器，使用公钥对应的私钥签名交易哈希，返回ed25519签名。
+//私钥可以在本进程、HSM或远程签名服务中，实现须并发安全。
+type Signer interface {
+	SignHash(publicKey []byte, hash []byte) ([]byte, error)
+}
+
 type TransactionSigner struct {
 }
 
@@ -20,3 +30,11 @@ func (singer *TransactionSigner) SignTransactionHash(msg []byte, privateKey []by
 	}
 	return sig, nil
 }
+
+//verifySignature 外部签名器返回的签名须能用公钥验证
+func verifySignature(publicKey, hash, sig []byte) error {
+	if owcrypt.Verify(publicKey, nil, 0, hash, uint16(len(hash)), sig, owcrypt.ECC_CURVE_ED25519) != owcrypt.SUCCESS {
+		return errors.New("signature verify failed")
+	}
+	return nil
+}